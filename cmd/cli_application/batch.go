@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/batch"
+	"github.com/B1scuit/example-pattern-service/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// A notification per row of a CSV or JSONL file, sent by route like
+// notify. The results file is the input with how each row went added, and
+// passing it back as --input sends only the rows that failed, to only the
+// channels they failed on
+func (a *app) sendBatchCmd() *cobra.Command {
+	var input, results, template, notificationType, locale string
+	var columns map[string]string
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Send a notification for every row of a CSV or JSONL file",
+		Long: "Send a notification for every row of a CSV or JSONL file.\n\n" +
+			"Columns named after a field (" + strings.Join(batch.Fields, ", ") + ", or recipients.<channel>) fill it, " +
+			"--map field=column reads a field from a column named something else, and every other column is template data. " +
+			"Columns starting with _ are the results' own and are ignored.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := batch.FormatOf(input)
+			if err != nil {
+				return err
+			}
+
+			if results == "" {
+				ext := filepath.Ext(input)
+				results = strings.TrimSuffix(input, ext) + ".results" + ext
+			}
+
+			// The results are written while the input is still being read
+			if filepath.Clean(results) == filepath.Clean(input) {
+				return fmt.Errorf("--results can't be the input file, %v", input)
+			}
+
+			n, err := a.notifier(cmd.Context(), true)
+			if err != nil {
+				return err
+			}
+
+			in, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+
+			out, err := os.Create(results)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			// Every row reports in, only once a second of them is logged
+			var mu sync.Mutex
+			var last time.Time
+			progress := func(p batch.Progress) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if p.Done < p.Total && time.Since(last) < time.Second {
+					return
+				}
+				last = time.Now()
+
+				a.logger.Info("Progress", "done", p.Done, "total", p.Total, "failed", p.Failed, "skipped", p.Skipped)
+			}
+
+			source, err := filepath.Abs(input)
+			if err != nil {
+				return err
+			}
+
+			opts := &batch.ClientOptions{
+				Logger:      a.logger,
+				Sender:      n,
+				Concurrency: concurrency,
+				Columns:     columns,
+				Defaults: &core.Task1Input{
+					From:     a.cfg.Email.From,
+					Template: template,
+					Type:     notificationType,
+					Locale:   locale,
+				},
+				OnProgress: progress,
+				Source:     source,
+			}
+
+			// Through the service a row's key is made from the file and row,
+			// so running the file again after being interrupted doesn't
+			// resend what the service already took
+			if a.cfg.Remote.Server != "" {
+				opts.WithIdempotencyKey = client.WithIdempotencyKey
+			}
+
+			b, err := batch.New(opts)
+			if err != nil {
+				return err
+			}
+
+			p, err := b.Run(cmd.Context(), in, format, out)
+			if err != nil {
+				return err
+			}
+
+			// Rows not reached are in the results as failed, so they're sent
+			// from there like any other
+			if cmd.Context().Err() != nil {
+				return fmt.Errorf("interrupted with %v of %v rows not sent, send %v again to carry on", p.Failed, p.Total, results)
+			}
+
+			if p.Failed > 0 {
+				return fmt.Errorf("%v of %v rows failed, send %v again to retry them", p.Failed, p.Total, results)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&input, "input", "i", "", "CSV or JSONL file with a notification per row")
+	cmd.Flags().StringVar(&results, "results", "", "Where to write each row's result, defaults to the input with .results before its extension")
+	cmd.Flags().StringToStringVar(&columns, "map", nil, "Read a field from a differently named column (to=email,recipients.slack=hook)")
+	cmd.Flags().StringVar(&template, "template", "", "Template for rows that don't name one")
+	cmd.Flags().StringVar(&notificationType, "type", "", "Notification type for rows that don't name one")
+	cmd.Flags().StringVar(&locale, "locale", "", "Locale for rows that don't name one")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "How many rows are sent at once")
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
@@ -1,61 +1,264 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/internal/service"
+	"github.com/B1scuit/example-pattern-service/pkg/client"
+	"github.com/B1scuit/example-pattern-service/pkg/config"
+	"github.com/B1scuit/example-pattern-service/pkg/directory"
 	"github.com/B1scuit/example-pattern-service/pkg/email"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
+	"github.com/B1scuit/example-pattern-service/pkg/scheduler"
+	"github.com/B1scuit/example-pattern-service/pkg/secrets"
+	"github.com/B1scuit/example-pattern-service/pkg/slack"
 	"github.com/B1scuit/example-pattern-service/pkg/sms"
+	"github.com/B1scuit/example-pattern-service/pkg/suppression"
+	"github.com/B1scuit/example-pattern-service/pkg/templates"
 	"github.com/spf13/cobra"
 )
 
 // This creates a CLI service init's from CLI flags
-// as is a common pattern in cli applications
+// as is a common pattern in cli applications, layered over the same
+// config file and env vars the HTTP service reads. Each group of
+// commands lives in its own file, sharing the app loaded here
 func main() {
-	logger := log.New(os.Stdout, "", 0)
-
-	var to, from, subject, body, number, fromNumber string
-	var coreClient *core.Client
+	a := &app{
+		// Replaced once the config has loaded, this only reports that failing
+		logger: logging.Must(logging.New(&logging.ClientOptions{})),
+	}
 
 	var rootCmd = &cobra.Command{
-		// Prerun is a good place to set up client as it acts as a layer before
-		// running the task
-		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
-			coreClient, err = core.New(&core.ClientOptions{
-				Email: email.Must(email.New(&email.ClientOptions{
-					StdLog:      logger,
-					FromAddress: from,
-				})),
-				SMS: sms.Must(sms.New(&sms.ClientOptions{
-					StdLog:     logger,
-					FromNumber: fromNumber,
-				})),
-			})
-
-			return err
-		},
-		// Run the task
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return coreClient.Task1(cmd.Context(), &core.Task1Input{
-				To:      to,
-				From:    from,
-				Number:  number,
-				Subject: subject,
-				Body:    body,
-			})
+		Use:   "cli_application",
+		Short: "Send notifications and look after what the service relies on",
+
+		// Every command shares the config, so it's loaded before any of them run
+		PersistentPreRunE: a.load,
+
+		// Mistakes in flags still print usage, failures past that point don't
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	// Instead of env vars, this time we are loading config via CLI flags,
+	// the config flags (--from, --scheduler-dir and the rest) are shared by
+	// every command
+	rootCmd.PersistentFlags().StringVar(&a.configFile, "config", os.Getenv("CONFIG_FILE"), "TOML config file")
+	config.RegisterFlags(rootCmd.PersistentFlags())
+
+	rootCmd.AddCommand(
+		a.sendCmd(),
+		a.templatesCmd(),
+		a.messagesCmd(),
+		a.suppressCmd(),
+		a.serveCmd(),
+		a.configCmd(),
+		a.secretsCmd(),
+	)
+
+	// Ctrl+C cancels the command's context so it can finish up, a batch
+	// still writes out every row, a second one stops the process outright
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
+		a.logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// What every command shares, filled in by load before any of them run
+type app struct {
+	configFile string
+
+	loadOptions *config.LoadOptions
+	cfg         *config.Config
+	logger      *slog.Logger
+}
+
+func (a *app) load(cmd *cobra.Command, args []string) (err error) {
+	a.loadOptions = &config.LoadOptions{
+		File:  a.configFile,
+		Flags: cmd.Flags(),
+	}
+
+	if a.cfg, err = config.Load(a.loadOptions); err != nil {
+		return err
+	}
+
+	a.logger, err = logging.New(&logging.ClientOptions{
+		Format:    a.cfg.Log.Format,
+		Level:     a.cfg.Log.Level,
+		MessageID: core.MessageID,
+		Redact: redact.Must(redact.New(&redact.ClientOptions{
+			Disabled: !a.cfg.Log.Redact,
+			Body:     a.cfg.Log.RedactBody,
+		})),
+	})
+
+	return err
+}
+
+// What the commands send and look things up through, core when they run
+// here or the HTTP service when --server is set, pkg/client mirrors core
+// so either will do
+type notifier interface {
+	Task1(context.Context, *core.Task1Input) (*core.Task1Output, error)
+	DryRun(context.Context, *core.Task1Input) (*core.DryRunOutput, error)
+	Scheduled(context.Context, string) (*core.Task1Output, error)
+
+	Suppress(context.Context, string, string) error
+	Unsuppress(context.Context, string) error
+	ListSuppressions(context.Context) ([]*core.Suppression, error)
+}
+
+// With a server the notification is sent by the service, with its routes
+// and its provider credentials, so none are needed on this machine
+func (a *app) notifier(ctx context.Context, routed bool) (notifier, error) {
+	if a.cfg.Remote.Server == "" {
+		return a.core(ctx, routed)
+	}
+
+	apiKey, err := a.secret(ctx, a.cfg.Remote.APIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.New(&client.ClientOptions{
+		Logger:  a.logger,
+		BaseURL: a.cfg.Remote.Server,
+		APIKey:  apiKey,
+	})
+}
+
+// Credentials can be secret://name references, looked up once since the
+// CLI doesn't live long enough to see them rotate
+func (a *app) secret(ctx context.Context, value string) (string, error) {
+	if !secrets.IsRef(value) {
+		return value, nil
+	}
+
+	backend, err := a.cfg.Secrets.Open()
+	if err != nil {
+		return "", err
+	}
+
+	return secrets.Must(secrets.New(&secrets.ClientOptions{
+		Logger:  a.logger,
+		Backend: backend,
+	})).Resolve(ctx, value)
+}
+
+// Builds core for the commands that send. Routes are only wanted by
+// "send notify", "send email" and "send sms" name their channel outright
+// and without routes only the channel with an address is sent to
+func (a *app) core(ctx context.Context, routed bool) (*core.Client, error) {
+	slackToken, err := a.secret(ctx, a.cfg.Slack.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelEmail: core.EmailChannel(email.Must(email.New(&email.ClientOptions{
+				Logger:      a.logger,
+				FromAddress: a.cfg.Email.From,
+			}))),
+			core.ChannelSMS: core.SMSChannel(sms.Must(sms.New(&sms.ClientOptions{
+				Logger:     a.logger,
+				FromNumber: a.cfg.SMS.From,
+			}))),
+			core.ChannelSlack: core.SlackChannel(slack.Must(slack.New(&slack.ClientOptions{
+				Logger: a.logger,
+				Token:  slackToken,
+			}))),
 		},
 	}
 
-	// Instead of env vars, this time we are loading config via CLI flags
-	rootCmd.Flags().StringVarP(&to, "to", "t", "", "To email address (example@example.comn)")
-	rootCmd.Flags().StringVarP(&from, "from", "f", "noreply@company.com", "From email address (example@example.comn)")
-	rootCmd.Flags().StringVarP(&subject, "subject", "s", "Default title", "Message subject")
-	rootCmd.Flags().StringVarP(&body, "body", "b", "Default content", "Message content")
-	rootCmd.Flags().StringVarP(&number, "number", "n", "", "Mobile number for SMS (0123456789)")
-	rootCmd.Flags().StringVarP(&fromNumber, "fromnumber", "a", "", "Mobile number to send SMS from (0123456789)")
+	// The CLI exits straight away, so scheduled notifications are only
+	// any use written somewhere the HTTP service will pick them up
+	if schedulerClient, err := a.scheduler(); err != nil {
+		return nil, err
+	} else if schedulerClient != nil {
+		opts.Scheduler = schedulerClient
+	}
+
+	if a.cfg.Suppression.File != "" {
+		suppressionClient, err := a.suppression()
+		if err != nil {
+			return nil, err
+		}
+		opts.Suppressions = service.Suppressions(suppressionClient)
+	}
 
-	if err := rootCmd.Execute(); err != nil {
-		logger.Fatal(err)
+	if a.cfg.Directory.Path != "" {
+		directoryClient, err := directory.New(&directory.ClientOptions{
+			Logger: a.logger,
+			Path:   a.cfg.Directory.Path,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts.Directory = service.Directory(directoryClient)
 	}
+
+	if a.cfg.Templates.Dir != "" {
+		if opts.Templates, err = a.templates(); err != nil {
+			return nil, err
+		}
+	}
+
+	if routed && a.cfg.Routes.File != "" {
+		f, err := os.Open(a.cfg.Routes.File)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		if opts.Routes, err = core.LoadRoutes(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return core.New(opts)
+}
+
+// Nil without a scheduler dir, the in memory scheduler would be gone the
+// moment the command exits
+func (a *app) scheduler() (*scheduler.Client, error) {
+	if a.cfg.Scheduler.Dir == "" {
+		return nil, nil
+	}
+
+	return scheduler.New(&scheduler.ClientOptions{
+		Logger: a.logger,
+		Dir:    a.cfg.Scheduler.Dir,
+	})
+}
+
+func (a *app) suppression() (*suppression.Client, error) {
+	return suppression.New(&suppression.ClientOptions{
+		Logger: a.logger,
+		Path:   a.cfg.Suppression.File,
+	})
+}
+
+func (a *app) templates() (*templates.Client, error) {
+	return templates.New(&templates.ClientOptions{
+		Logger:        a.logger,
+		Dir:           a.cfg.Templates.Dir,
+		DefaultLocale: a.cfg.Templates.DefaultLocale,
+	})
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func (a *app) messagesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "messages",
+		Short: "Look up scheduled notifications",
+	}
+
+	cmd.AddCommand(a.messagesStatusCmd())
+
+	return cmd
+}
+
+// Only notifications waiting to be sent have a status, all that can be
+// said of one that isn't there is that it's been sent, cancelled or never
+// existed. Locally that needs the scheduler dir the service reads
+func (a *app) messagesStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status <id>",
+		Short: "Show whether a scheduled notification is still waiting to be sent",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if a.cfg.Remote.Server == "" && a.cfg.Scheduler.Dir == "" {
+				return errors.New("no scheduler dir configured, set --scheduler-dir or SCHEDULER_DIR")
+			}
+
+			n, err := a.notifier(cmd.Context(), false)
+			if err != nil {
+				return err
+			}
+
+			status := map[string]string{"id": args[0], "status": "not waiting, sent, cancelled or unknown"}
+
+			output, err := n.Scheduled(cmd.Context(), args[0])
+			switch {
+			case errors.Is(err, core.ErrNotFound):
+				// Not waiting, which the status already says
+			case err != nil:
+				return err
+			default:
+				status["status"] = "scheduled"
+				status["send_at"] = output.SendAt.Format(time.RFC3339)
+			}
+
+			b, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+			return err
+		},
+	}
+}
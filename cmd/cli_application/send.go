@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func (a *app) sendCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "send",
+		Short: "Send a notification",
+	}
+
+	cmd.AddCommand(a.sendEmailCmd(), a.sendSMSCmd(), a.sendNotifyCmd(), a.sendBatchCmd())
+
+	return cmd
+}
+
+func (a *app) sendEmailCmd() *cobra.Command {
+	var to, subject, body, sendAt string
+
+	cmd := &cobra.Command{
+		Use:   "email",
+		Short: "Send an email",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.send(cmd, false, sendAt, &core.Task1Input{
+				To:      to,
+				From:    a.cfg.Email.From,
+				Subject: subject,
+				Body:    body,
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&to, "to", "t", "", "To email address (example@example.com)")
+	cmd.Flags().StringVarP(&subject, "subject", "s", "Default title", "Message subject")
+	cmd.Flags().StringVarP(&body, "body", "b", "Default content", "Message content")
+	cmd.Flags().StringVar(&sendAt, "send-at", "", "Send at this time instead of now (2006-01-02T15:04:05Z07:00)")
+	cmd.MarkFlagRequired("to")
+	dryRunFlag(cmd)
+
+	return cmd
+}
+
+func (a *app) sendSMSCmd() *cobra.Command {
+	var number, body, sendAt string
+
+	cmd := &cobra.Command{
+		Use:   "sms",
+		Short: "Send an SMS",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.send(cmd, false, sendAt, &core.Task1Input{
+				Number: number,
+				Body:   body,
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&number, "number", "n", "", "Mobile number for SMS (0123456789)")
+	cmd.Flags().StringVarP(&body, "body", "b", "Default content", "Message content")
+	cmd.Flags().StringVar(&sendAt, "send-at", "", "Send at this time instead of now (2006-01-02T15:04:05Z07:00)")
+	cmd.MarkFlagRequired("number")
+	dryRunFlag(cmd)
+
+	return cmd
+}
+
+// What the CLI always did before it had subcommands, every addressed
+// channel by the notification type's route
+func (a *app) sendNotifyCmd() *cobra.Command {
+	var to, subject, body, number, sendAt, notificationType, slackTo string
+
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Send a notification on every channel it's addressed to, by its route",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := &core.Task1Input{
+				To:      to,
+				From:    a.cfg.Email.From,
+				Number:  number,
+				Subject: subject,
+				Body:    body,
+				Type:    notificationType,
+			}
+
+			if slackTo != "" {
+				in.Recipients = map[string]string{core.ChannelSlack: slackTo}
+			}
+
+			return a.send(cmd, true, sendAt, in)
+		},
+	}
+
+	cmd.Flags().StringVarP(&to, "to", "t", "", "To email address (example@example.com)")
+	cmd.Flags().StringVarP(&subject, "subject", "s", "Default title", "Message subject")
+	cmd.Flags().StringVarP(&body, "body", "b", "Default content", "Message content")
+	cmd.Flags().StringVarP(&number, "number", "n", "", "Mobile number for SMS (0123456789)")
+	cmd.Flags().StringVar(&slackTo, "slack", "", "Slack incoming-webhook URL, or channel ID with a Slack token configured")
+	cmd.Flags().StringVar(&notificationType, "type", "", "Notification type, picks the route it's sent by")
+	cmd.Flags().StringVar(&sendAt, "send-at", "", "Send at this time instead of now (2006-01-02T15:04:05Z07:00)")
+	dryRunFlag(cmd)
+
+	return cmd
+}
+
+func dryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("dry-run", false, "Print what would be sent on each channel, rendered, without sending it")
+}
+
+func (a *app) send(cmd *cobra.Command, routed bool, sendAt string, in *core.Task1Input) error {
+	if sendAt != "" {
+		at, err := time.Parse(time.RFC3339, sendAt)
+		if err != nil {
+			return err
+		}
+		in.SendAt = at
+	}
+
+	n, err := a.notifier(cmd.Context(), routed)
+	if err != nil {
+		return err
+	}
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		output, err := n.DryRun(cmd.Context(), in)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+		return err
+	}
+
+	output, err := n.Task1(cmd.Context(), in)
+	if err != nil {
+		return err
+	}
+
+	if output.ID != "" {
+		a.logger.Info("Scheduled", "id", output.ID, "send_at", output.SendAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
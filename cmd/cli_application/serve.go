@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/B1scuit/example-pattern-service/internal/service"
+	"github.com/B1scuit/example-pattern-service/pkg/config"
+	"github.com/B1scuit/example-pattern-service/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+// The same service cmd/http_service runs, so one binary covers both
+func (a *app) serveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run the HTTP service",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return service.Run(cmd.Context(), a.loadOptions, a.cfg)
+		},
+	}
+}
+
+// "config print" shows the config the commands would run with
+func (a *app) configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration as TOML, secrets masked",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return config.Print(cmd.OutOrStdout(), a.cfg)
+		},
+	})
+
+	return cmd
+}
+
+// Tools for the encrypted secrets backend, "secrets key" makes a key
+// and "secrets seal" encrypts a JSON object of secrets read from stdin
+// with the configured key, writing the file the backend reads to stdout
+func (a *app) secretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage the encrypted secrets file",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "key",
+		Short: "Print a new random key for the encrypted secrets file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := secrets.GenerateKey()
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), key)
+			return err
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "seal",
+		Short: "Encrypt a JSON object of secrets from stdin with SECRETS_KEY",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := secrets.ParseKey(a.cfg.Secrets.Key)
+			if err != nil {
+				return err
+			}
+
+			var values map[string]string
+			if err := json.NewDecoder(cmd.InOrStdin()).Decode(&values); err != nil {
+				return err
+			}
+
+			sealed, err := secrets.Seal(key, values)
+			if err != nil {
+				return err
+			}
+
+			_, err = cmd.OutOrStdout().Write(sealed)
+			return err
+		},
+	})
+
+	return cmd
+}
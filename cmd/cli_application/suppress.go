@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/spf13/cobra"
+)
+
+// Changes the file the HTTP service checks before every send, it picks
+// changes up without a restart. With --server the service changes it
+func (a *app) suppressCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "suppress",
+		Short: "Manage the addresses nothing is sent to",
+	}
+
+	cmd.AddCommand(a.suppressAddCmd(), a.suppressRemoveCmd(), a.suppressListCmd())
+
+	return cmd
+}
+
+func (a *app) suppressAddCmd() *cobra.Command {
+	var reason string
+
+	cmd := &cobra.Command{
+		Use:   "add <address>",
+		Short: "Stop anything being sent to an address",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := a.suppressions(cmd)
+			if err != nil {
+				return err
+			}
+
+			return n.Suppress(cmd.Context(), args[0], reason)
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", "", "Why, bounced, complained, asked to be removed")
+
+	return cmd
+}
+
+func (a *app) suppressRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <address>",
+		Short: "Allow an address to be sent to again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := a.suppressions(cmd)
+			if err != nil {
+				return err
+			}
+
+			err = n.Unsuppress(cmd.Context(), args[0])
+			if errors.Is(err, core.ErrNotFound) {
+				return fmt.Errorf("%v isn't suppressed", args[0])
+			}
+
+			return err
+		},
+	}
+}
+
+func (a *app) suppressListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the suppressed addresses",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := a.suppressions(cmd)
+			if err != nil {
+				return err
+			}
+
+			entries, err := n.ListSuppressions(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			// Printed in full, whoever can run this can read the file anyway
+			for _, entry := range entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%v\t%v\t%v\n", entry.Address, entry.Added.Format(time.RFC3339), entry.Reason)
+			}
+
+			return nil
+		},
+	}
+}
+
+// Locally the list is the suppression file, so there has to be one
+func (a *app) suppressions(cmd *cobra.Command) (notifier, error) {
+	if a.cfg.Remote.Server == "" && a.cfg.Suppression.File == "" {
+		return nil, errors.New("no suppression file configured, set --suppression-file or SUPPRESSION_FILE")
+	}
+
+	return a.notifier(cmd.Context(), false)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func (a *app) templatesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "templates",
+		Short: "Inspect the notification templates",
+	}
+
+	cmd.AddCommand(a.templatesListCmd(), a.templatesRenderCmd())
+
+	return cmd
+}
+
+func (a *app) templatesListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List every template and the locales it has",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			templatesClient, err := a.templates()
+			if err != nil {
+				return err
+			}
+
+			for _, name := range templatesClient.Names() {
+				fmt.Fprintf(cmd.OutOrStdout(), "%v\t%v\n", name, strings.Join(templatesClient.Locales(name), ","))
+			}
+
+			return nil
+		},
+	}
+}
+
+func (a *app) templatesRenderCmd() *cobra.Command {
+	var locale, data string
+
+	cmd := &cobra.Command{
+		Use:   "render <name>",
+		Short: "Render a template, to check it before it's sent",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var values map[string]any
+			if data != "" {
+				if err := json.Unmarshal([]byte(data), &values); err != nil {
+					return errors.New("--data should be a JSON object")
+				}
+			}
+
+			templatesClient, err := a.templates()
+			if err != nil {
+				return err
+			}
+
+			subject, body, err := templatesClient.Render(cmd.Context(), args[0], locale, values)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Subject: %v\n\n%v\n", subject, body)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&locale, "locale", "", "Locale to render (en-GB), defaults to the configured default")
+	cmd.Flags().StringVar(&data, "data", "", `Template data as a JSON object ({"name": "Jo"})`)
+
+	return cmd
+}
@@ -1,38 +1,54 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"os"
 
-	"github.com/B1scuit/example-pattern-service/internal/core"
-	"github.com/B1scuit/example-pattern-service/pkg/email"
-	"github.com/B1scuit/example-pattern-service/pkg/http"
-	"github.com/B1scuit/example-pattern-service/pkg/sms"
+	"github.com/B1scuit/example-pattern-service/internal/service"
+	"github.com/B1scuit/example-pattern-service/pkg/config"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/spf13/pflag"
 )
 
-// This creates a HTTP service init'd from env vars
-// as is a common pattern in microservices
-// You can see each client as it's loaded
-// and what goes into each client
-// the main is a reference for how the packages are being run
+// This creates a HTTP service init'd from its config, the defaults
+// overridden by a TOML file (--config or CONFIG_FILE), then env vars
+// as is a common pattern in microservices, then flags
+// the wiring itself lives in internal/service, shared with the CLI
 func main() {
-	logger := log.New(os.Stdout, "", 0)
+	flags := pflag.NewFlagSet("http_service", pflag.ExitOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "TOML config file")
+	config.RegisterFlags(flags)
+	flags.Parse(os.Args[1:])
 
-	httpServer := http.Must(http.New(&http.ClientOptions{
-		StdLog: logger,
-		Core: core.Must(core.New(&core.ClientOptions{
-			Email: email.Must(email.New(&email.ClientOptions{
-				StdLog:      logger,
-				FromAddress: os.Getenv("FROM_EMAIL_ADDRESS"),
-			})),
-			SMS: sms.Must(sms.New(&sms.ClientOptions{
-				StdLog:     logger,
-				FromNumber: os.Getenv("FROM_SMS_NUMBER"),
-			})),
-		})),
-	}))
+	loadOptions := &config.LoadOptions{
+		File:  *configFile,
+		Flags: flags,
+		// JSON by default since this is what ends up in log aggregation,
+		// LOG_FORMAT=text is easier to read locally
+		Defaults: func(cfg *config.Config) {
+			cfg.Log.Format = logging.FormatJSON
+		},
+	}
+
+	cfg, err := config.Load(loadOptions)
+	if err != nil {
+		// There's no logger yet, it's configured by what failed to load
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// "http_service config print" shows what the service would run with
+	if flags.Arg(0) == "config" && flags.Arg(1) == "print" {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	if err := httpServer.RunServer(); err != nil {
-		logger.Fatal(err)
+	if err := service.Run(context.Background(), loadOptions, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -1,13 +1,11 @@
 module github.com/B1scuit/example-pattern-service
 
-go 1.18
+go 1.21
 
 require (
 	github.com/gorilla/mux v1.8.0
 	github.com/spf13/cobra v1.5.0
+	github.com/spf13/pflag v1.0.5
 )
 
-require (
-	github.com/inconshreveable/mousetrap v1.0.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-)
+require github.com/inconshreveable/mousetrap v1.0.0 // indirect
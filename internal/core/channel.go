@@ -0,0 +1,187 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Message is what core hands to a channel, To is whatever an address
+// means to that channel, an email address, a number, a URL
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Channel is anything core can deliver a notification through
+type Channel interface {
+	Send(context.Context, *Message) error
+}
+
+// ChannelFunc lets a plain function be used as a Channel
+type ChannelFunc func(context.Context, *Message) error
+
+func (f ChannelFunc) Send(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// Rendered is what a provider would be handed for a message, as much of
+// it as the channel can tell without sending anything
+type Rendered struct {
+	// The whole message as it would go over the wire, an email's MIME
+	Raw string `json:"raw,omitempty"`
+
+	// How many parts an SMS is split into, and the encoding deciding that
+	Segments int    `json:"segments,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Previewer is optional for a Channel, the dry run shows what it returns
+// alongside the message, nil means there's nothing more to show
+type Previewer interface {
+	Preview(context.Context, *Message) (*Rendered, error)
+}
+
+// Optional for an EmailService, email.Client has it
+type MIMEService interface {
+	MIME(string, string, string) ([]byte, error)
+}
+
+// Optional for an SMSService, sms.Client has it
+type SegmentService interface {
+	Segments(string) (int, string)
+}
+
+// EmailChannel adapts an EmailService, such as email.Client, into a Channel,
+// previews carry the MIME when the service can build it
+func EmailChannel(svc EmailService) Channel {
+	return &emailChannel{svc: svc}
+}
+
+type emailChannel struct {
+	svc EmailService
+}
+
+func (ec *emailChannel) Send(ctx context.Context, msg *Message) error {
+	return ec.svc.Send(ctx, msg.To, msg.Subject, msg.Body)
+}
+
+func (ec *emailChannel) Preview(ctx context.Context, msg *Message) (*Rendered, error) {
+	m, ok := ec.svc.(MIMEService)
+	if !ok {
+		return nil, nil
+	}
+
+	raw, err := m.MIME(msg.To, msg.Subject, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rendered{Raw: string(raw)}, nil
+}
+
+// SMSChannel adapts an SMSService, such as sms.Client, into a Channel,
+// SMS has no subject so it is dropped, previews carry the segments when
+// the service can count them
+func SMSChannel(svc SMSService) Channel {
+	return &smsChannel{svc: svc}
+}
+
+type smsChannel struct {
+	svc SMSService
+}
+
+func (sc *smsChannel) Send(ctx context.Context, msg *Message) error {
+	return sc.svc.Send(ctx, msg.To, msg.Body)
+}
+
+func (sc *smsChannel) Preview(ctx context.Context, msg *Message) (*Rendered, error) {
+	s, ok := sc.svc.(SegmentService)
+	if !ok {
+		return nil, nil
+	}
+
+	segments, encoding := s.Segments(msg.Body)
+	return &Rendered{Segments: segments, Encoding: encoding}, nil
+}
+
+// WebhookChannel adapts a WebhookService, such as webhook.Client, into a
+// Channel, the recipient address is the endpoint URL
+func WebhookChannel(svc WebhookService) Channel {
+	return ChannelFunc(func(ctx context.Context, msg *Message) error {
+		return svc.Send(ctx, msg.To, msg.Subject, msg.Body)
+	})
+}
+
+// SlackChannel adapts a SlackService, such as slack.Client, into a Channel,
+// the recipient address is an incoming-webhook URL or a channel ID
+func SlackChannel(svc SlackService) Channel {
+	return ChannelFunc(func(ctx context.Context, msg *Message) error {
+		return svc.Send(ctx, msg.To, msg.Subject, msg.Body)
+	})
+}
+
+// PushChannel adapts a PushService, such as push.Client, into a Channel,
+// the recipient address is one or more comma separated device tokens
+func PushChannel(svc PushService) Channel {
+	return ChannelFunc(func(ctx context.Context, msg *Message) error {
+		return svc.Send(ctx, msg.To, msg.Subject, msg.Body)
+	})
+}
+
+// Registry holds channels by name, it is safe to register channels while
+// notifications are being sent
+type Registry struct {
+	mu       sync.RWMutex
+	channels map[string]Channel
+}
+
+func NewRegistry() *Registry {
+	return &Registry{channels: map[string]Channel{}}
+}
+
+// Register adds a channel, names are unique so registering a name twice fails
+func (r *Registry) Register(name string, ch Channel) error {
+	if name == "" {
+		return errors.New("channel name missing")
+	}
+
+	if ch == nil {
+		return fmt.Errorf("channel %q is nil", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.channels[name]; ok {
+		return fmt.Errorf("channel %q already registered", name)
+	}
+
+	r.channels[name] = ch
+	return nil
+}
+
+func (r *Registry) Get(name string) (Channel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ch, ok := r.channels[name]
+	return ch, ok
+}
+
+// Names returns every registered channel, sorted so the order is stable
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.channels))
+	for name := range r.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
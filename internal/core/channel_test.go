@@ -0,0 +1,285 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// Records the messages sent through it, standing in for any channel
+type MockChannel struct {
+	Sent []*core.Message
+}
+
+func (mc *MockChannel) Send(ctx context.Context, msg *core.Message) error {
+	mc.Sent = append(mc.Sent, msg)
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	registry := core.NewRegistry()
+
+	if err := registry.Register("webhook", &MockChannel{}); err != nil {
+		t.Error(err)
+	}
+	if err := registry.Register("slack", &MockChannel{}); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("Duplicate", func(t *testing.T) {
+		if err := registry.Register("slack", &MockChannel{}); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if err := registry.Register("", &MockChannel{}); err == nil {
+			t.Error("error should have been returned")
+		}
+		if err := registry.Register("nil", nil); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		names := registry.Names()
+		if len(names) != 2 || names[0] != "slack" || names[1] != "webhook" {
+			t.Errorf("unexpected names %v", names)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		if _, ok := registry.Get("slack"); !ok {
+			t.Error("slack should be registered")
+		}
+		if _, ok := registry.Get("pigeon"); ok {
+			t.Error("pigeon should not be registered")
+		}
+	})
+}
+
+func TestNewInvalidChannelName(t *testing.T) {
+	_, err := core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{"": &MockChannel{}},
+	})
+
+	if err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestRecipientsPerChannel(t *testing.T) {
+	webhook := &MockChannel{}
+	email := &MockChannel{}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelEmail: email,
+			"webhook":         webhook,
+		},
+	}))
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{
+		To:      "example@example.com",
+		Subject: "Subject",
+		Body:    "Body",
+		Recipients: map[string]string{
+			"webhook": "https://example.com/hook",
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(webhook.Sent) != 1 || webhook.Sent[0].To != "https://example.com/hook" || webhook.Sent[0].Subject != "Subject" {
+		t.Errorf("unexpected webhook messages %+v", webhook.Sent)
+	}
+
+	if len(email.Sent) != 1 || email.Sent[0].To != "example@example.com" {
+		t.Errorf("unexpected email messages %+v", email.Sent)
+	}
+
+	t.Run("RegisterChannel", func(t *testing.T) {
+		slack := &MockChannel{}
+		if err := client.RegisterChannel("slack", slack); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{Recipients: map[string]string{"slack": "#alerts"}}); err != nil {
+			t.Error(err)
+		}
+
+		if len(slack.Sent) != 1 {
+			t.Error("default route should include channels registered later")
+		}
+	})
+}
+
+// The webhook client shares the email shape, subject and all
+type MockWebhookClient struct {
+	SendMock func(context.Context, string, string, string) error
+}
+
+func (mwc *MockWebhookClient) Send(ctx context.Context, url, subject, body string) error {
+	return mwc.SendMock(ctx, url, subject, body)
+}
+
+func TestWebhookChannel(t *testing.T) {
+	var gotURL, gotSubject string
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelWebhook: core.WebhookChannel(&MockWebhookClient{
+				SendMock: func(ctx context.Context, url, subject, body string) error {
+					gotURL, gotSubject = url, subject
+					return nil
+				},
+			}),
+		},
+	}))
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{
+		Subject:    "Subject",
+		Recipients: map[string]string{core.ChannelWebhook: "https://example.com/hook"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if gotURL != "https://example.com/hook" || gotSubject != "Subject" {
+		t.Errorf("unexpected webhook call %q %q", gotURL, gotSubject)
+	}
+}
+
+type MockSlackClient struct {
+	SendMock func(context.Context, string, string, string) error
+}
+
+func (msc *MockSlackClient) Send(ctx context.Context, to, subject, body string) error {
+	return msc.SendMock(ctx, to, subject, body)
+}
+
+func TestSlackChannel(t *testing.T) {
+	var gotTo, gotBody string
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelSlack: core.SlackChannel(&MockSlackClient{
+				SendMock: func(ctx context.Context, to, subject, body string) error {
+					gotTo, gotBody = to, body
+					return nil
+				},
+			}),
+		},
+	}))
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{
+		Body:       "Body",
+		Recipients: map[string]string{core.ChannelSlack: "C123"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if gotTo != "C123" || gotBody != "Body" {
+		t.Errorf("unexpected slack call %q %q", gotTo, gotBody)
+	}
+}
+
+type MockPushClient struct {
+	SendMock func(context.Context, string, string, string) error
+}
+
+func (mpc *MockPushClient) Send(ctx context.Context, tokens, subject, body string) error {
+	return mpc.SendMock(ctx, tokens, subject, body)
+}
+
+func TestPushChannel(t *testing.T) {
+	var gotTokens string
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelPush: core.PushChannel(&MockPushClient{
+				SendMock: func(ctx context.Context, tokens, subject, body string) error {
+					gotTokens = tokens
+					return nil
+				},
+			}),
+		},
+	}))
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{
+		Recipients: map[string]string{core.ChannelPush: "token-1,token-2"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if gotTokens != "token-1,token-2" {
+		t.Errorf("unexpected tokens %q", gotTokens)
+	}
+}
+
+func TestQuietHoursOtherChannels(t *testing.T) {
+	voice := &MockChannel{}
+	sms := &MockChannel{}
+
+	var scheduledKind string
+	var scheduledPayload []byte
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelSMS: sms,
+			"voice":         voice,
+		},
+		QuietHours: &core.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour, Channels: []string{"voice"}},
+		Scheduler: &MockScheduler{
+			ScheduleMock: func(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+				scheduledKind, scheduledPayload = kind, payload
+				return "id", nil
+			},
+		},
+		Now: func() time.Time {
+			return time.Date(2022, 6, 1, 23, 0, 0, 0, time.UTC)
+		},
+	}))
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{
+		Number:     "0123456789",
+		Recipients: map[string]string{"voice": "0123456789"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(sms.Sent) != 1 {
+		t.Error("sms isn't listed so should have been sent")
+	}
+
+	if len(voice.Sent) != 0 {
+		t.Error("voice should have been deferred")
+	}
+
+	if err := client.RunScheduled(context.TODO(), scheduledKind, scheduledPayload); err != nil {
+		t.Error(err)
+	}
+
+	if len(voice.Sent) != 1 || voice.Sent[0].To != "0123456789" {
+		t.Errorf("unexpected voice messages %+v", voice.Sent)
+	}
+
+	t.Run("LegacySMSJob", func(t *testing.T) {
+		if err := client.RunScheduled(context.TODO(), "sms", []byte(`{"Number":"0123456789","Body":"Body"}`)); err != nil {
+			t.Error(err)
+		}
+
+		if len(sms.Sent) != 2 || sms.Sent[1].Body != "Body" {
+			t.Errorf("unexpected sms messages %+v", sms.Sent)
+		}
+	})
+}
@@ -2,6 +2,12 @@ package core
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 )
 
 // These interfaces allow the decoupling and ease of unit testing.
@@ -16,11 +22,123 @@ type SMSService interface {
 	Send(context.Context, string, string) error
 }
 
+type WebhookService interface {
+	Send(context.Context, string, string, string) error
+}
+
+type SlackService interface {
+	Send(context.Context, string, string, string) error
+}
+
+type PushService interface {
+	Send(context.Context, string, string, string) error
+}
+
+// Get returns nil when there's no such recipient, Delete reports
+// whether there was one to delete
+type DirectoryService interface {
+	Get(context.Context, string) (*Recipient, error)
+	List(context.Context) ([]*Recipient, error)
+	Put(context.Context, *Recipient) error
+	Delete(context.Context, string) (bool, error)
+}
+
+// Render takes the template name and locale, returning the subject and body
+type TemplateService interface {
+	Render(context.Context, string, string, map[string]any) (string, string, error)
+}
+
+// When, Cancel and Reschedule report false when the job doesn't exist,
+// or has already run, rather than returning an error
+type SchedulerService interface {
+	Schedule(context.Context, time.Time, string, []byte) (string, error)
+	When(context.Context, string) (time.Time, bool, error)
+	Cancel(context.Context, string) (bool, error)
+	Reschedule(context.Context, string, time.Time) (bool, error)
+}
+
+// Suppressed reports whether nothing should be sent to the address,
+// Remove reports whether it was on the list
+type SuppressionService interface {
+	Suppressed(context.Context, string) (bool, error)
+	Add(context.Context, string, string) error
+	Remove(context.Context, string) (bool, error)
+	List(context.Context) ([]*Suppression, error)
+}
+
+// Returned when a scheduled notification can't be found, callers
+// can check for this with errors.Is to tell it apart from a failure
+var ErrNotFound = errors.New("not found")
+
+// Returned when every address a notification could go to is suppressed
+var ErrSuppressed = errors.New("every address is suppressed")
+
+// InvalidError is returned when the notification itself is at fault, no
+// address to send to or a template that doesn't exist, so sending it
+// again unchanged would fail the same way
+type InvalidError struct {
+	Err error
+}
+
+func (e *InvalidError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+func invalid(err error) error {
+	return &InvalidError{Err: err}
+}
+
+// The kinds of job core hands to the scheduler, RunScheduled uses
+// these to decide what to do with the payload when it comes back
+const (
+	jobKindChannel = "channel"
+	jobKindTask1   = "task1"
+
+	// Deferred SMS written before channels were generic, still
+	// understood so they aren't lost from a durable scheduler
+	jobKindSMS = "sms"
+)
+
 type ClientOptions struct {
 	PassedValue string
 
-	Email EmailService
-	SMS   SMSService
+	// Channels keyed by the name routes and recipients use to refer to them,
+	// wrap email.Client and sms.Client with EmailChannel and SMSChannel
+	Channels map[string]Channel
+
+	// Optional, needed to address notifications by user ID
+	Directory DirectoryService
+
+	// Optional, needed to send notifications by template name
+	Templates TemplateService
+
+	// Optional, holds notifications with a SendAt until they are due
+	// and messages deferred by quiet hours
+	Scheduler SchedulerService
+
+	// Optional, when set messages on the quiet hours channels that would land
+	// inside the window for the recipient are held back until the window ends
+	QuietHours *QuietHours
+
+	// Optional, routes keyed by notification type, anything without a route
+	// uses DefaultRouteName, and without that, every channel addressed
+	Routes map[string]*Route
+
+	// Optional, addresses on it are skipped as if they weren't given
+	Suppressions SuppressionService
+
+	// Optional, told about every delivery
+	Metrics Metrics
+
+	// Optional, spans are started for Task1 and every channel send
+	Tracer Tracer
+
+	// Allows the passing of time to be controlled in tests
+	Now func() time.Time
 }
 
 type Client struct {
@@ -30,8 +148,24 @@ type Client struct {
 	// to make the changes safe
 	passedValue string
 
-	email EmailService
-	sms   SMSService
+	directory    DirectoryService
+	scheduler    SchedulerService
+	suppressions SuppressionService
+
+	// What Reload can change, swapped whole under mu so a notification
+	// never sees half of one configuration and half of another
+	mu       sync.RWMutex
+	settings *settings
+
+	// Channels added with RegisterChannel, carried over by Reload
+	registered map[string]Channel
+
+	inflight inflight
+
+	metrics Metrics
+	tracer  Tracer
+
+	now func() time.Time
 }
 
 // Single point of entry to create a new instance of client
@@ -44,11 +178,42 @@ func New(opts *ClientOptions) (*Client, error) {
 		opts.PassedValue = "Example value"
 	}
 
+	settings, err := newSettings(&ReloadOptions{
+		Channels:   opts.Channels,
+		Templates:  opts.Templates,
+		QuietHours: opts.QuietHours,
+		Routes:     opts.Routes,
+	}, opts.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Metrics == nil {
+		opts.Metrics = noopMetrics{}
+	}
+
+	if opts.Tracer == nil {
+		opts.Tracer = noopTracer{}
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
 	return &Client{
 		passedValue: opts.PassedValue,
 
-		email: opts.Email,
-		sms:   opts.SMS,
+		directory:    opts.Directory,
+		scheduler:    opts.Scheduler,
+		suppressions: opts.Suppressions,
+
+		settings:   settings,
+		registered: map[string]Channel{},
+
+		metrics: opts.Metrics,
+		tracer:  opts.Tracer,
+
+		now: opts.Now,
 	}, nil
 }
 
@@ -61,23 +226,451 @@ func Must(client *Client, err error) *Client {
 	return client
 }
 
+// RegisterChannel adds a channel after the client has been created, routes
+// only see it once they name it, the default route picks it up straight away.
+// It stays through a Reload, which can't bring in a channel of the same name
+func (c *Client) RegisterChannel(name string, ch Channel) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Settings are never changed in place, a send already under way keeps
+	// the channels it started with
+	channels := NewRegistry()
+	for _, existing := range c.settings.channels.Names() {
+		registered, _ := c.settings.channels.Get(existing)
+		channels.Register(existing, registered)
+	}
+
+	if err := channels.Register(name, ch); err != nil {
+		return err
+	}
+
+	updated := *c.settings
+	updated.channels = channels
+	c.settings = &updated
+
+	c.registered[name] = ch
+	return nil
+}
+
 // The actual functions the core controller excutes need to be clear
 // easy to read functions that can execute a task at the highest abstraction
 // level of the service, what this function does is simple to read and follow
 // allowing for a quick knowledge transfer
 //
 // If you have many of these functions, it is worth seperating them into different files
-func (c *Client) Task1(ctx context.Context, in *Task1Input) error {
+func (c *Client) Task1(ctx context.Context, in *Task1Input) (*Task1Output, error) {
+
+	if !c.inflight.begin() {
+		return nil, ErrShuttingDown
+	}
+	defer c.inflight.end()
+
+	ctx, messageID := ensureMessageID(ctx)
+
+	ctx, span := c.tracer.Start(ctx, "core.Task1")
+	span.SetAttribute("message.id", messageID)
+
+	output, err := c.task1(ctx, in)
+	if output != nil && output.ID != "" {
+		span.SetAttribute("notification.id", output.ID)
+	}
+	span.End(err)
+
+	return output, err
+}
+
+func (c *Client) task1(ctx context.Context, in *Task1Input) (*Task1Output, error) {
+
+	if in.IsScheduled(c.now()) {
+		return c.scheduleTask1(ctx, in)
+	}
+
+	// Resolved as late as possible, so a scheduled notification is sent to
+	// wherever the recipient can be reached when it falls due
+	in, err := c.resolve(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.deliver(ctx, c.route(in.Type).only(in.Channels), in); err != nil {
+		return nil, err
+	}
+
+	return &Task1Output{}, nil
+}
+
+func (c *Client) route(notificationType string) *Route {
+	settings := c.current()
+
+	if route, ok := settings.routes[notificationType]; ok {
+		return route
+	}
+
+	if route, ok := settings.routes[DefaultRouteName]; ok {
+		return route
+	}
+
+	// Without any routes everything registered is sent to, so email and sms
+	// alone behave as they always have, email and SMS if there's a number
+	return &Route{
+		Mode:     RouteAll,
+		Channels: settings.channels.Names(),
+	}
+}
+
+// Walks the channels of the route, skipping any the input has no address for.
+// A first_success route doesn't count a channel held by quiet hours as sent,
+// it carries on down the route and only if nothing delivers now is the
+// notification held, with the rest of the route from that channel on left
+// to fall back through
+func (c *Client) deliver(ctx context.Context, route *Route, in *Task1Input) error {
+	deliveryErr := &DeliveryError{}
+	attempted, suppressed := false, false
+
+	var held []string
+	var heldUntil time.Time
+
+	for i, channel := range route.Channels {
+		if !in.HasAddress(channel) {
+			continue
+		}
+
+		if route.Mode == RouteFirstSuccess {
+			at, deferred, err := c.quietUntil(c.current().quietHours, channel, in.Urgent, in.TimeZone)
+			if err != nil {
+				attempted = true
+				deliveryErr.Failures = append(deliveryErr.Failures, ChannelError{Channel: channel, Err: err})
+				continue
+			}
+
+			if deferred {
+				if held == nil {
+					held, heldUntil = route.Channels[i:], at
+				}
+				continue
+			}
+		}
+
+		to, dropped, err := c.unsuppressed(ctx, in.Address(channel))
+		if err != nil {
+			attempted = true
+			deliveryErr.Failures = append(deliveryErr.Failures, ChannelError{Channel: channel, Err: err})
+			continue
+		}
+
+		for i := 0; i < dropped; i++ {
+			c.metrics.Suppressed(channel)
+		}
+
+		if to == "" {
+			suppressed = true
+			continue
+		}
+		attempted = true
+
+		err = c.sendChannel(ctx, channel, in.Urgent, in.TimeZone, &Message{
+			To:      to,
+			Subject: in.Subject,
+			Body:    in.Body,
+		})
+		if err == nil && route.Mode == RouteFirstSuccess {
+			return nil
+		}
+
+		if err != nil {
+			deliveryErr.Failures = append(deliveryErr.Failures, ChannelError{Channel: channel, Err: err})
+		}
+	}
+
+	if len(held) > 0 {
+		return c.hold(ctx, in, held, heldUntil)
+	}
+
+	if !attempted && suppressed {
+		return ErrSuppressed
+	}
+
+	if !attempted {
+		return invalid(fmt.Errorf("no address for any of %v", strings.Join(route.Channels, ", ")))
+	}
+
+	if len(deliveryErr.Failures) > 0 {
+		return deliveryErr
+	}
+
+	return nil
+}
+
+// Holds a first_success notification until quiet hours end for the first
+// of channels, it then goes through the route again limited to them so
+// one that fails still falls back to the next
+func (c *Client) hold(ctx context.Context, in *Task1Input, channels []string, at time.Time) error {
+	job := *in
+	job.Channels = channels
 
-	if err := c.email.Send(ctx, in.To, in.Subject, in.Body); err != nil {
+	payload, err := json.Marshal(&job)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.scheduler.Schedule(ctx, at, jobKindTask1, payload); err != nil {
+		return err
+	}
+
+	c.metrics.Deferred(channels[0])
+	return nil
+}
+
+// Sends the message now, or hands it to the scheduler if the channel observes
+// quiet hours, the recipient is currently inside them and it isn't urgent
+func (c *Client) sendChannel(ctx context.Context, channel string, urgent bool, timeZone string, msg *Message) error {
+	settings := c.current()
+
+	ch, ok := settings.channels.Get(channel)
+	if !ok {
+		return fmt.Errorf("channel %q not registered", channel)
+	}
+
+	at, deferred, err := c.quietUntil(settings.quietHours, channel, urgent, timeZone)
+	if err != nil {
+		return err
+	}
+
+	if !deferred {
+		return c.send(ctx, channel, ch, msg)
+	}
+
+	payload, err := json.Marshal(&scheduledMessage{
+		Channel:   channel,
+		Message:   msg,
+		MessageID: MessageID(ctx),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.scheduler.Schedule(ctx, at, jobKindChannel, payload); err != nil {
+		return err
+	}
+
+	c.metrics.Deferred(channel)
+	return nil
+}
+
+// Reports whether quiet hours hold the message back on the channel, and
+// until when, urgent messages and channels they don't apply to never are
+func (c *Client) quietUntil(quietHours *QuietHours, channel string, urgent bool, timeZone string) (time.Time, bool, error) {
+	if quietHours == nil || urgent || !quietHours.Applies(channel) {
+		return time.Time{}, false, nil
+	}
+
+	loc, err := quietHours.location(timeZone)
+	if err != nil {
+		return time.Time{}, false, invalid(fmt.Errorf("invalid time zone: %w", err))
+	}
+
+	at, deferred := quietHours.Defer(c.now().In(loc))
+	return at, deferred, nil
+}
+
+// The payload stored with a deferred message
+type scheduledMessage struct {
+	Channel   string
+	Message   *Message
+	MessageID string `json:",omitempty"`
+}
+
+// Holds the whole notification in the scheduler until SendAt, when it comes
+// back through RunScheduled it is run again as if it had just arrived
+func (c *Client) scheduleTask1(ctx context.Context, in *Task1Input) (*Task1Output, error) {
+	if c.scheduler == nil {
+		return nil, errors.New("scheduling requires a scheduler")
+	}
+
+	sendAt := in.SendAt
+
+	job := *in
+	job.SendAt = time.Time{}
+
+	payload, err := json.Marshal(&job)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := c.scheduler.Schedule(ctx, sendAt, jobKindTask1, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Task1Output{
+		ID:     id,
+		SendAt: sendAt,
+	}, nil
+}
+
+// Scheduled looks up a notification that's waiting to be sent, one that's
+// been sent or cancelled is ErrNotFound like one that never existed
+func (c *Client) Scheduled(ctx context.Context, id string) (*Task1Output, error) {
+	if c.scheduler == nil {
+		return nil, ErrNotFound
+	}
+
+	sendAt, found, err := c.scheduler.When(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	return &Task1Output{
+		ID:     id,
+		SendAt: sendAt,
+	}, nil
+}
+
+// CancelScheduled stops a scheduled notification from being sent
+func (c *Client) CancelScheduled(ctx context.Context, id string) error {
+	if c.scheduler == nil {
+		return ErrNotFound
+	}
+
+	found, err := c.scheduler.Cancel(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Reschedule moves a scheduled notification to a new send time
+func (c *Client) Reschedule(ctx context.Context, id string, sendAt time.Time) error {
+	if c.scheduler == nil {
+		return ErrNotFound
+	}
+
+	if sendAt.IsZero() {
+		return invalid(errors.New("send time missing"))
+	}
+
+	found, err := c.scheduler.Reschedule(ctx, id, sendAt)
+	if err != nil {
 		return err
 	}
 
-	if in.IsNumberSet() {
-		if err := c.sms.Send(ctx, in.Number, in.Body); err != nil {
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// The payload stored with a deferred SMS by older versions
+type scheduledSMS struct {
+	Number string
+	Body   string
+}
+
+// RunScheduled is handed jobs back from the scheduler once they are due
+func (c *Client) RunScheduled(ctx context.Context, kind string, payload []byte) error {
+	if !c.inflight.begin() {
+		return ErrShuttingDown
+	}
+	defer c.inflight.end()
+
+	ctx, span := c.tracer.Start(ctx, "core.RunScheduled")
+	span.SetAttribute("job.kind", kind)
+	err := c.runScheduled(ctx, kind, payload)
+	span.End(err)
+
+	return err
+}
+
+func (c *Client) runScheduled(ctx context.Context, kind string, payload []byte) error {
+	switch kind {
+	case jobKindChannel:
+		var job scheduledMessage
+		if err := json.Unmarshal(payload, &job); err != nil {
 			return err
 		}
+
+		if job.MessageID != "" {
+			ctx = WithMessageID(ctx, job.MessageID)
+		}
+
+		return c.sendNow(ctx, job.Channel, job.Message)
+
+	case jobKindSMS:
+		var job scheduledSMS
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return err
+		}
+
+		return c.sendNow(ctx, ChannelSMS, &Message{To: job.Number, Body: job.Body})
+
+	case jobKindTask1:
+		var in Task1Input
+		if err := json.Unmarshal(payload, &in); err != nil {
+			return err
+		}
+
+		ctx, _ = ensureMessageID(ctx)
+		_, err := c.task1(ctx, &in)
+		return err
 	}
 
-	return nil
+	return fmt.Errorf("unknown scheduled job kind %q", kind)
+}
+
+// Sends without any of the quiet hours checks, for messages that
+// have already been through them. Suppressions are checked again, an
+// address may have bounced or unsubscribed while the message was held
+func (c *Client) sendNow(ctx context.Context, channel string, msg *Message) error {
+	ch, ok := c.current().channels.Get(channel)
+	if !ok {
+		return fmt.Errorf("channel %q not registered", channel)
+	}
+
+	to, dropped, err := c.unsuppressed(ctx, msg.To)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < dropped; i++ {
+		c.metrics.Suppressed(channel)
+	}
+
+	// Nothing left to send to isn't a failure, the job is done
+	if to == "" {
+		return nil
+	}
+
+	unsuppressed := *msg
+	unsuppressed.To = to
+
+	return c.send(ctx, channel, ch, &unsuppressed)
+}
+
+// Every provider call goes through here so it's timed, counted and traced
+func (c *Client) send(ctx context.Context, channel string, ch Channel, msg *Message) error {
+	ctx, span := c.tracer.Start(ctx, "channel.Send")
+	span.SetAttribute("channel", channel)
+
+	start := time.Now()
+	err := ch.Send(ctx, msg)
+	span.End(err)
+
+	outcome := OutcomeSent
+	if err != nil {
+		outcome = OutcomeFailed
+	}
+	c.metrics.Delivered(channel, outcome, time.Since(start))
+
+	return err
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/B1scuit/example-pattern-service/internal/core"
 )
@@ -46,12 +47,19 @@ var mockSMSClient core.SMSService = &MockSMSClient{
 	},
 }
 
+// Registers the mocks under the names the real clients use
+func channels(email core.EmailService, sms core.SMSService) map[string]core.Channel {
+	return map[string]core.Channel{
+		core.ChannelEmail: core.EmailChannel(email),
+		core.ChannelSMS:   core.SMSChannel(sms),
+	}
+}
+
 // Testing for clean init of the client
 func TestClient(t *testing.T) {
 
 	client, err := core.New(&core.ClientOptions{
-		Email: mockEmailClient,
-		SMS:   mockSMSClient,
+		Channels: channels(mockEmailClient, mockSMSClient),
 	})
 
 	if err != nil {
@@ -62,7 +70,7 @@ func TestClient(t *testing.T) {
 	// you can make client package level if you want to
 	// test these independantly
 	t.Run("Task1", func(t *testing.T) {
-		if err := client.Task1(context.TODO(), &core.Task1Input{}); err != nil {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com"}); err != nil {
 			t.Error(err)
 		}
 	})
@@ -76,8 +84,7 @@ func TestEmailErr(t *testing.T) {
 	}
 
 	client, err := core.New(&core.ClientOptions{
-		Email: mockEmailClient,
-		SMS:   mockSMSClient,
+		Channels: channels(mockEmailClient, mockSMSClient),
 	})
 
 	if err != nil {
@@ -88,7 +95,7 @@ func TestEmailErr(t *testing.T) {
 	// you can make client package level if you want to
 	// test these independantly
 	t.Run("Task1", func(t *testing.T) {
-		if err := client.Task1(context.TODO(), &core.Task1Input{}); err == nil {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com"}); err == nil {
 			t.Error("error should have been returned")
 		}
 	})
@@ -107,8 +114,7 @@ func TestSMSErr(t *testing.T) {
 	}
 
 	client, err := core.New(&core.ClientOptions{
-		Email: mockEmailClient,
-		SMS:   mockSMSClient,
+		Channels: channels(mockEmailClient, mockSMSClient),
 	})
 
 	if err != nil {
@@ -119,7 +125,7 @@ func TestSMSErr(t *testing.T) {
 	// you can make client package level if you want to
 	// test these independantly
 	t.Run("Task1", func(t *testing.T) {
-		if err := client.Task1(context.TODO(), &core.Task1Input{Number: "0123456789"}); err == nil {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com", Number: "0123456789"}); err == nil {
 			t.Error("error should have been returned")
 		}
 	})
@@ -148,3 +154,270 @@ func TestMustPanic(t *testing.T) {
 
 	core.Must(&core.Client{}, errors.New("Example"))
 }
+
+// Holds onto whatever is scheduled so the test can check what was deferred
+type MockScheduler struct {
+	ScheduleMock   func(context.Context, time.Time, string, []byte) (string, error)
+	WhenMock       func(context.Context, string) (time.Time, bool, error)
+	CancelMock     func(context.Context, string) (bool, error)
+	RescheduleMock func(context.Context, string, time.Time) (bool, error)
+}
+
+func (ms *MockScheduler) Schedule(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+	return ms.ScheduleMock(ctx, at, kind, payload)
+}
+
+func (ms *MockScheduler) When(ctx context.Context, id string) (time.Time, bool, error) {
+	return ms.WhenMock(ctx, id)
+}
+
+func (ms *MockScheduler) Cancel(ctx context.Context, id string) (bool, error) {
+	return ms.CancelMock(ctx, id)
+}
+
+func (ms *MockScheduler) Reschedule(ctx context.Context, id string, at time.Time) (bool, error) {
+	return ms.RescheduleMock(ctx, id, at)
+}
+
+func TestNewQuietHoursWithoutScheduler(t *testing.T) {
+	_, err := core.New(&core.ClientOptions{
+		Channels:   channels(mockEmailClient, mockSMSClient),
+		QuietHours: &core.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour},
+	})
+
+	if err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestQuietHoursDefersSMS(t *testing.T) {
+	var sent int
+	var scheduledAt time.Time
+	var scheduledKind string
+	var scheduledPayload []byte
+
+	smsClient := &MockSMSClient{
+		SendMock: func(ctx context.Context, s1, s2 string) error {
+			sent++
+			return nil
+		},
+	}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels:   channels(mockEmailClient, smsClient),
+		QuietHours: &core.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour},
+		Scheduler: &MockScheduler{
+			ScheduleMock: func(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+				scheduledAt, scheduledKind, scheduledPayload = at, kind, payload
+				return "id", nil
+			},
+		},
+		// 02:00 UTC is 03:00 in London during the summer
+		Now: func() time.Time {
+			return time.Date(2022, 6, 1, 2, 0, 0, 0, time.UTC)
+		},
+	}))
+
+	t.Run("Deferred", func(t *testing.T) {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{Number: "0123456789", TimeZone: "Europe/London"}); err != nil {
+			t.Error(err)
+		}
+
+		if sent != 0 {
+			t.Error("sms should not have been sent during quiet hours")
+		}
+
+		if want := time.Date(2022, 6, 1, 7, 0, 0, 0, time.UTC); !scheduledAt.Equal(want) {
+			t.Errorf("scheduled for %v, want %v", scheduledAt, want)
+		}
+
+		// Hand the job back as the scheduler would once it's due
+		if err := client.RunScheduled(context.TODO(), scheduledKind, scheduledPayload); err != nil {
+			t.Error(err)
+		}
+
+		if sent != 1 {
+			t.Error("scheduled sms should have been sent")
+		}
+	})
+
+	t.Run("Urgent", func(t *testing.T) {
+		sent = 0
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{Number: "0123456789", Urgent: true}); err != nil {
+			t.Error(err)
+		}
+
+		if sent != 1 {
+			t.Error("urgent sms should have been sent straight away")
+		}
+	})
+
+	t.Run("InvalidTimeZone", func(t *testing.T) {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{Number: "0123456789", TimeZone: "Nowhere/Special"}); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+
+	t.Run("UnknownJob", func(t *testing.T) {
+		if err := client.RunScheduled(context.TODO(), "unknown", nil); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+}
+
+func TestSendAt(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var emailed int
+	var scheduledKind string
+	var scheduledPayload []byte
+
+	emailClient := &MockEmailClient{
+		SendMock: func(ctx context.Context, s1, s2, s3 string) error {
+			emailed++
+			return nil
+		},
+	}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(emailClient, mockSMSClient),
+		Scheduler: &MockScheduler{
+			ScheduleMock: func(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+				scheduledKind, scheduledPayload = kind, payload
+				return "id", nil
+			},
+			WhenMock: func(ctx context.Context, id string) (time.Time, bool, error) {
+				return now.Add(time.Hour), id == "id", nil
+			},
+			CancelMock: func(ctx context.Context, id string) (bool, error) {
+				return id == "id", nil
+			},
+			RescheduleMock: func(ctx context.Context, id string, at time.Time) (bool, error) {
+				return id == "id", nil
+			},
+		},
+		Now: func() time.Time { return now },
+	}))
+
+	t.Run("Scheduled", func(t *testing.T) {
+		output, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com", SendAt: now.Add(time.Hour)})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if output.ID != "id" {
+			t.Errorf("unexpected id %q", output.ID)
+		}
+
+		if emailed != 0 {
+			t.Error("email should not have been sent yet")
+		}
+
+		if err := client.RunScheduled(context.TODO(), scheduledKind, scheduledPayload); err != nil {
+			t.Error(err)
+		}
+
+		if emailed != 1 {
+			t.Error("email should have been sent once due")
+		}
+	})
+
+	t.Run("InThePast", func(t *testing.T) {
+		output, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com", SendAt: now.Add(-time.Hour)})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if output.ID != "" {
+			t.Error("a send time in the past should send straight away")
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		output, err := client.Scheduled(context.TODO(), "id")
+		if err != nil || output.ID != "id" || !output.SendAt.Equal(now.Add(time.Hour)) {
+			t.Errorf("unexpected status %+v (%v)", output, err)
+		}
+
+		if _, err := client.Scheduled(context.TODO(), "missing"); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("expected not found, got %v", err)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		if err := client.CancelScheduled(context.TODO(), "id"); err != nil {
+			t.Error(err)
+		}
+
+		if err := client.CancelScheduled(context.TODO(), "missing"); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("expected not found, got %v", err)
+		}
+	})
+
+	t.Run("Reschedule", func(t *testing.T) {
+		if err := client.Reschedule(context.TODO(), "id", now.Add(time.Hour)); err != nil {
+			t.Error(err)
+		}
+
+		if err := client.Reschedule(context.TODO(), "missing", now.Add(time.Hour)); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("expected not found, got %v", err)
+		}
+
+		if err := client.Reschedule(context.TODO(), "id", time.Time{}); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+}
+
+func TestSendAtWithoutScheduler(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	if _, err := client.Task1(context.TODO(), &core.Task1Input{SendAt: time.Now().Add(time.Hour)}); err == nil {
+		t.Error("error should have been returned")
+	}
+
+	if _, err := client.Scheduled(context.TODO(), "id"); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if err := client.CancelScheduled(context.TODO(), "id"); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	var ids []string
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(&MockEmailClient{
+			SendMock: func(ctx context.Context, s1, s2, s3 string) error {
+				ids = append(ids, core.MessageID(ctx))
+				return nil
+			},
+		}, mockSMSClient),
+	}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com"}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if len(ids) != 2 || ids[0] == "" || ids[0] == ids[1] {
+		t.Errorf("each notification should get its own ID, got %v", ids)
+	}
+
+	// One already in the context is kept
+	ctx := core.WithMessageID(context.TODO(), "abc")
+	if _, err := client.Task1(ctx, &core.Task1Input{To: "example@example.com"}); err != nil {
+		t.Error(err)
+	}
+
+	if ids[2] != "abc" {
+		t.Errorf("message ID %q, want abc", ids[2])
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Returned to new work once Drain has been called, callers can check
+// for this with errors.Is to tell the caller to try elsewhere
+var ErrShuttingDown = errors.New("shutting down")
+
+// Counts notifications in flight so shutdown can wait for them to finish
+type inflight struct {
+	mu      sync.Mutex
+	closing bool
+	wg      sync.WaitGroup
+	active  int64
+}
+
+// begin reports false once closing, otherwise the caller must call end
+func (i *inflight) begin() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closing {
+		return false
+	}
+
+	i.wg.Add(1)
+	atomic.AddInt64(&i.active, 1)
+	return true
+}
+
+func (i *inflight) end() {
+	atomic.AddInt64(&i.active, -1)
+	i.wg.Done()
+}
+
+// Drain stops the client accepting new notifications and waits for those
+// already in flight to finish, if ctx ends first it reports how many were
+// abandoned part way through
+func (c *Client) Drain(ctx context.Context) error {
+	c.inflight.mu.Lock()
+	c.inflight.closing = true
+	c.inflight.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inflight.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%v in-flight notifications abandoned", atomic.LoadInt64(&c.inflight.active))
+	}
+}
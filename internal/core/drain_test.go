@@ -0,0 +1,67 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+func TestDrainRejectsNewWork(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	if err := client.Drain(context.TODO()); err != nil {
+		t.Error(err)
+	}
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com"})
+	if !errors.Is(err, core.ErrShuttingDown) {
+		t.Errorf("expected ErrShuttingDown, got %v", err)
+	}
+}
+
+func TestDrainWaitsForInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(&MockEmailClient{
+			SendMock: func(context.Context, string, string, string) error {
+				close(started)
+				<-release
+				return nil
+			},
+		}, mockSMSClient),
+	}))
+
+	done := make(chan error)
+	go func() {
+		_, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com"})
+		done <- err
+	}()
+	<-started
+
+	// Gives up while the send is still blocked
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := client.Drain(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 in-flight") {
+		t.Errorf("expected the in-flight send to be reported, got %v", err)
+	}
+
+	// Once it finishes a second drain completes cleanly
+	close(release)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if err := client.Drain(context.TODO()); err != nil {
+		t.Error(err)
+	}
+}
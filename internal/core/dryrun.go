@@ -0,0 +1,188 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// What a dry run found would happen on a channel
+const (
+	DeliverySend = "send"
+
+	// Held back by quiet hours until DeferredUntil
+	DeliveryDeferred = "deferred"
+
+	// Every address on the channel is suppressed
+	DeliverySuppressed = "suppressed"
+
+	// A first_success route only gets to it if the channels before fail
+	DeliveryFallback = "fallback"
+
+	// Would fail before reaching the provider, Error says why
+	DeliveryFailed = "failed"
+)
+
+// Delivery is what a dry run would hand a channel, To is the addresses
+// left once suppressed ones are dropped
+type Delivery struct {
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+
+	DeferredUntil *time.Time `json:"deferred_until,omitempty"`
+
+	// Filled in by channels that can preview, see Previewer
+	Rendered *Rendered `json:"rendered,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// What came of a dry run, SendAt is only set when the notification would
+// be scheduled, the deliveries are then what it would be if sent right now
+type DryRunOutput struct {
+	SendAt     *time.Time  `json:"send_at,omitempty"`
+	Route      *Route      `json:"route"`
+	Deliveries []*Delivery `json:"deliveries"`
+}
+
+// DryRun goes through everything Task1 would, recipient lookup, templates,
+// suppressions, routing and quiet hours, without calling a provider or the
+// scheduler. It fails the way Task1 would, a channel that would fail on
+// its own is a failed delivery like the DeliveryError Task1 would return
+func (c *Client) DryRun(ctx context.Context, in *Task1Input) (*DryRunOutput, error) {
+	ctx, span := c.tracer.Start(ctx, "core.DryRun")
+	output, err := c.dryRun(ctx, in)
+	span.End(err)
+
+	return output, err
+}
+
+func (c *Client) dryRun(ctx context.Context, in *Task1Input) (*DryRunOutput, error) {
+	output := &DryRunOutput{}
+
+	if in.IsScheduled(c.now()) {
+		if c.scheduler == nil {
+			return nil, errors.New("scheduling requires a scheduler")
+		}
+		sendAt := in.SendAt
+		output.SendAt = &sendAt
+	}
+
+	in, err := c.resolve(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	route := c.route(in.Type).only(in.Channels)
+	output.Route = route
+
+	attempted, suppressed, sending := false, false, false
+	var held []*Delivery
+
+	for _, channel := range route.Channels {
+		if !in.HasAddress(channel) {
+			continue
+		}
+
+		delivery := &Delivery{
+			Channel: channel,
+			To:      in.Address(channel),
+			Subject: in.Subject,
+			Body:    in.Body,
+		}
+		output.Deliveries = append(output.Deliveries, delivery)
+
+		to, _, err := c.unsuppressed(ctx, delivery.To)
+		if err != nil {
+			attempted = true
+			delivery.fail(err)
+			continue
+		}
+
+		if to == "" {
+			suppressed = true
+			delivery.Status = DeliverySuppressed
+			continue
+		}
+		attempted = true
+		delivery.To = to
+
+		c.preview(ctx, in, delivery)
+		if delivery.Status == DeliveryFailed {
+			continue
+		}
+
+		if route.Mode == RouteFirstSuccess && sending {
+			delivery.Status = DeliveryFallback
+		}
+
+		// Task1 passes over a first_success channel in quiet hours, it's
+		// only held if nothing after it can send now
+		if route.Mode == RouteFirstSuccess && delivery.Status == DeliveryDeferred {
+			held = append(held, delivery)
+			continue
+		}
+		sending = true
+	}
+
+	if sending {
+		for _, delivery := range held {
+			delivery.Status = DeliveryFallback
+		}
+	}
+
+	if !attempted && suppressed {
+		return nil, ErrSuppressed
+	}
+
+	if !attempted {
+		return nil, invalid(fmt.Errorf("no address for any of %v", strings.Join(route.Channels, ", ")))
+	}
+
+	return output, nil
+}
+
+// The dry run's sendChannel, filling in the delivery instead of sending
+func (c *Client) preview(ctx context.Context, in *Task1Input, delivery *Delivery) {
+	settings := c.current()
+
+	ch, ok := settings.channels.Get(delivery.Channel)
+	if !ok {
+		delivery.fail(fmt.Errorf("channel %q not registered", delivery.Channel))
+		return
+	}
+
+	at, deferred, err := c.quietUntil(settings.quietHours, delivery.Channel, in.Urgent, in.TimeZone)
+	if err != nil {
+		delivery.fail(err)
+		return
+	}
+
+	delivery.Status = DeliverySend
+	if deferred {
+		delivery.Status, delivery.DeferredUntil = DeliveryDeferred, &at
+	}
+
+	if p, ok := ch.(Previewer); ok {
+		rendered, err := p.Preview(ctx, &Message{
+			To:      delivery.To,
+			Subject: delivery.Subject,
+			Body:    delivery.Body,
+		})
+		if err != nil {
+			delivery.fail(err)
+			return
+		}
+		delivery.Rendered = rendered
+	}
+}
+
+func (d *Delivery) fail(err error) {
+	d.Status, d.Error = DeliveryFailed, err.Error()
+}
@@ -0,0 +1,213 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// Email and SMS clients that can preview as well, like the real ones
+type MockPreviewEmailClient struct {
+	MockEmailClient
+	MIMEMock func(string, string, string) ([]byte, error)
+}
+
+func (mpec *MockPreviewEmailClient) MIME(to, subject, body string) ([]byte, error) {
+	return mpec.MIMEMock(to, subject, body)
+}
+
+type MockPreviewSMSClient struct {
+	MockSMSClient
+	SegmentsMock func(string) (int, string)
+}
+
+func (mpsc *MockPreviewSMSClient) Segments(body string) (int, string) {
+	return mpsc.SegmentsMock(body)
+}
+
+func TestDryRun(t *testing.T) {
+	var sent, scheduled int
+
+	emailClient := &MockPreviewEmailClient{
+		MockEmailClient: MockEmailClient{
+			SendMock: func(context.Context, string, string, string) error {
+				sent++
+				return nil
+			},
+		},
+		MIMEMock: func(to, subject, body string) ([]byte, error) {
+			if to == "broken" {
+				return nil, errMockSend
+			}
+			return []byte("To: " + to + "\r\nSubject: " + subject + "\r\n\r\n" + body), nil
+		},
+	}
+
+	smsClient := &MockPreviewSMSClient{
+		MockSMSClient: MockSMSClient{
+			SendMock: func(context.Context, string, string) error {
+				sent++
+				return nil
+			},
+		},
+		SegmentsMock: func(body string) (int, string) {
+			return 2, "GSM-7"
+		},
+	}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels:     channels(emailClient, smsClient),
+		Templates:    mockTemplates,
+		Suppressions: suppressing("gone@example.com"),
+		Directory: &MockDirectory{Recipients: map[string]*core.Recipient{
+			"jo": {ID: "jo", Email: "jo@example.com", Phone: "0123456789", Locale: "fr-FR"},
+		}},
+		Routes: map[string]*core.Route{
+			"fallback": {Mode: core.RouteFirstSuccess, Channels: []string{core.ChannelSMS, core.ChannelEmail}},
+		},
+		QuietHours: &core.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour, Channels: []string{core.ChannelSMS}},
+		Scheduler: &MockScheduler{
+			ScheduleMock: func(context.Context, time.Time, string, []byte) (string, error) {
+				scheduled++
+				return "id", nil
+			},
+		},
+		Now: func() time.Time {
+			return time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		},
+	}))
+
+	t.Run("Rendered", func(t *testing.T) {
+		output, err := client.DryRun(context.TODO(), &core.Task1Input{
+			UserID:   "jo",
+			Template: "welcome",
+			Data:     map[string]any{"name": "Jo"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(output.Deliveries) != 2 {
+			t.Fatalf("expected email and sms, got %+v", output.Deliveries)
+		}
+
+		email, sms := output.Deliveries[0], output.Deliveries[1]
+
+		if email.Status != core.DeliverySend || email.To != "jo@example.com" || email.Subject != "Bienvenue" || email.Body != "Salut Jo" {
+			t.Errorf("unexpected email %+v", email)
+		}
+
+		if email.Rendered == nil || email.Rendered.Raw != "To: jo@example.com\r\nSubject: Bienvenue\r\n\r\nSalut Jo" {
+			t.Errorf("unexpected mime %+v", email.Rendered)
+		}
+
+		if sms.Status != core.DeliverySend || sms.To != "0123456789" || sms.Rendered == nil || sms.Rendered.Segments != 2 {
+			t.Errorf("unexpected sms %+v", sms)
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		output, err := client.DryRun(context.TODO(), &core.Task1Input{Type: "fallback", To: "al@example.com", Number: "0123456789"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output.Route.Mode != core.RouteFirstSuccess {
+			t.Errorf("unexpected route %+v", output.Route)
+		}
+
+		if output.Deliveries[0].Status != core.DeliverySend || output.Deliveries[1].Status != core.DeliveryFallback {
+			t.Errorf("email should only be a fallback for sms, got %v then %v", output.Deliveries[0].Status, output.Deliveries[1].Status)
+		}
+	})
+
+	t.Run("FailedFallsThrough", func(t *testing.T) {
+		output, err := client.DryRun(context.TODO(), &core.Task1Input{
+			Type:     "fallback",
+			To:       "al@example.com",
+			Number:   "0123456789",
+			TimeZone: "Nowhere/Special",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output.Deliveries[0].Status != core.DeliveryFailed || output.Deliveries[0].Error == "" {
+			t.Errorf("sms with an invalid time zone should fail, got %+v", output.Deliveries[0])
+		}
+
+		if output.Deliveries[1].Status != core.DeliverySend {
+			t.Errorf("email should be sent once sms fails, got %v", output.Deliveries[1].Status)
+		}
+	})
+
+	t.Run("PreviewErr", func(t *testing.T) {
+		output, err := client.DryRun(context.TODO(), &core.Task1Input{To: "broken"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output.Deliveries[0].Status != core.DeliveryFailed || output.Deliveries[0].Error != errMockSend.Error() {
+			t.Errorf("an email that can't be built should fail, got %+v", output.Deliveries[0])
+		}
+	})
+
+	t.Run("Suppressed", func(t *testing.T) {
+		output, err := client.DryRun(context.TODO(), &core.Task1Input{To: "gone@example.com", Number: "0123456789"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output.Deliveries[0].Status != core.DeliverySuppressed || output.Deliveries[0].Rendered != nil {
+			t.Errorf("unexpected email %+v", output.Deliveries[0])
+		}
+
+		if _, err := client.DryRun(context.TODO(), &core.Task1Input{To: "gone@example.com"}); !errors.Is(err, core.ErrSuppressed) {
+			t.Errorf("expected ErrSuppressed, got %v", err)
+		}
+	})
+
+	t.Run("Deferred", func(t *testing.T) {
+		output, err := client.DryRun(context.TODO(), &core.Task1Input{Number: "0123456789", TimeZone: "Asia/Tokyo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Noon in London is 21:00 in Tokyo, quiet until 08:00 there
+		want := time.Date(2022, 6, 1, 23, 0, 0, 0, time.UTC)
+		if sms := output.Deliveries[0]; sms.Status != core.DeliveryDeferred || sms.DeferredUntil == nil || !sms.DeferredUntil.Equal(want) {
+			t.Errorf("unexpected sms %+v, want deferred until %v", sms, want)
+		}
+	})
+
+	t.Run("Scheduled", func(t *testing.T) {
+		sendAt := time.Date(2022, 6, 2, 12, 0, 0, 0, time.UTC)
+		output, err := client.DryRun(context.TODO(), &core.Task1Input{To: "al@example.com", SendAt: sendAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output.SendAt == nil || !output.SendAt.Equal(sendAt) || output.Deliveries[0].Status != core.DeliverySend {
+			t.Errorf("unexpected output %+v", output)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, in := range map[string]*core.Task1Input{
+			"no address":       {},
+			"unknown template": {To: "al@example.com", Template: "missing"},
+			"unknown user":     {UserID: "nobody"},
+		} {
+			if _, err := client.DryRun(context.TODO(), in); err == nil {
+				t.Errorf("%v should be an error", name)
+			}
+		}
+	})
+
+	if sent != 0 || scheduled != 0 {
+		t.Errorf("a dry run shouldn't send or schedule anything, sent %v scheduled %v", sent, scheduled)
+	}
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type messageIDKey struct{}
+
+// WithMessageID returns ctx carrying the ID of the notification being sent,
+// so anything logging along the way can say which notification it was for
+func WithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIDKey{}, id)
+}
+
+// MessageID returns the ID of the notification ctx belongs to, empty outside of one
+func MessageID(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// Reuses the ID already in ctx, a notification keeps its ID when it's
+// handed back by the scheduler
+func ensureMessageID(ctx context.Context) (context.Context, string) {
+	if id := MessageID(ctx); id != "" {
+		return ctx, id
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	return WithMessageID(ctx, id), id
+}
@@ -0,0 +1,30 @@
+package core
+
+import "time"
+
+// How a delivery attempt turned out, as reported to Metrics
+const (
+	OutcomeSent   = "sent"
+	OutcomeFailed = "failed"
+)
+
+// Metrics is told about every delivery so it can be counted and timed, core
+// doesn't know or care what ends up exporting it (see pkg/metrics)
+type Metrics interface {
+	// A channel was called, took is how long the provider took to answer
+	Delivered(channel, outcome string, took time.Duration)
+
+	// A message was held back by quiet hours rather than sent
+	Deferred(channel string)
+
+	// An address was skipped because it's on the suppression list, once
+	// per address so a push to three tokens with one suppressed counts one
+	Suppressed(channel string)
+}
+
+// Used when no Metrics are passed so the client never has to check
+type noopMetrics struct{}
+
+func (noopMetrics) Delivered(string, string, time.Duration) {}
+func (noopMetrics) Deferred(string)                         {}
+func (noopMetrics) Suppressed(string)                       {}
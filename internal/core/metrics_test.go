@@ -0,0 +1,103 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// Records what core reported so the test can check it
+type MockMetrics struct {
+	Deliveries  []string
+	Deferrals   []string
+	Suppressals []string
+}
+
+func (mm *MockMetrics) Delivered(channel, outcome string, took time.Duration) {
+	mm.Deliveries = append(mm.Deliveries, channel+":"+outcome)
+}
+
+func (mm *MockMetrics) Deferred(channel string) {
+	mm.Deferrals = append(mm.Deferrals, channel)
+}
+
+func (mm *MockMetrics) Suppressed(channel string) {
+	mm.Suppressals = append(mm.Suppressals, channel)
+}
+
+func TestMetrics(t *testing.T) {
+	var metrics MockMetrics
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, &MockSMSClient{
+			SendMock: func(context.Context, string, string) error {
+				return errMockSend
+			},
+		}),
+		Metrics: &metrics,
+	}))
+
+	client.Task1(context.TODO(), &core.Task1Input{
+		To:     "example@example.com",
+		Number: "0123456789",
+	})
+
+	if len(metrics.Deliveries) != 2 || metrics.Deliveries[0] != "email:sent" || metrics.Deliveries[1] != "sms:failed" {
+		t.Errorf("unexpected deliveries %v", metrics.Deliveries)
+	}
+}
+
+func TestMetricsDeferred(t *testing.T) {
+	var metrics MockMetrics
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels:   channels(mockEmailClient, mockSMSClient),
+		QuietHours: &core.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour},
+		Scheduler: &MockScheduler{
+			ScheduleMock: func(context.Context, time.Time, string, []byte) (string, error) {
+				return "id", nil
+			},
+		},
+		Metrics: &metrics,
+		Now: func() time.Time {
+			return time.Date(2022, 6, 1, 2, 0, 0, 0, time.UTC)
+		},
+	}))
+
+	if _, err := client.Task1(context.TODO(), &core.Task1Input{Number: "0123456789"}); err != nil {
+		t.Error(err)
+	}
+
+	if len(metrics.Deferrals) != 1 || len(metrics.Deliveries) != 0 {
+		t.Errorf("expected one deferral and no deliveries, got %v and %v", metrics.Deferrals, metrics.Deliveries)
+	}
+}
+
+func TestMetricsSuppressed(t *testing.T) {
+	var metrics MockMetrics
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels:     channels(mockEmailClient, mockSMSClient),
+		Suppressions: suppressing("bounced@example.com", "0123456789"),
+		Metrics:      &metrics,
+	}))
+
+	client.Task1(context.TODO(), &core.Task1Input{
+		To:     "jo@example.com, bounced@example.com",
+		Number: "0123456789",
+	})
+
+	if len(metrics.Suppressals) != 2 || metrics.Suppressals[0] != "email" || metrics.Suppressals[1] != "sms" {
+		t.Errorf("unexpected suppressals %v", metrics.Suppressals)
+	}
+
+	// A dry run only reports what would be skipped
+	metrics.Suppressals = nil
+	client.DryRun(context.TODO(), &core.Task1Input{To: "bounced@example.com"})
+
+	if len(metrics.Suppressals) != 0 {
+		t.Errorf("dry run counted %v", metrics.Suppressals)
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window, in the recipient's local time, where SMS (or
+// whichever channels are listed) shouldn't be sent. Start and End are offsets
+// from local midnight, when Start is after End the window runs over midnight
+// (21:00-08:00)
+type QuietHours struct {
+	Start time.Duration
+	End   time.Duration
+
+	// Used when the recipient has no time zone of their own, defaults to UTC
+	Location *time.Location
+
+	// The channels quiet hours hold back, defaults to just sms
+	Channels []string
+}
+
+// Applies reports whether messages on the channel are held back
+func (q *QuietHours) Applies(channel string) bool {
+	if len(q.Channels) == 0 {
+		return channel == ChannelSMS
+	}
+
+	for _, c := range q.Channels {
+		if c == channel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseQuietHours reads a window written as "21:00-08:00"
+func ParseQuietHours(s string) (*QuietHours, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("quiet hours %q should look like 21:00-08:00", s)
+	}
+
+	startOffset, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+
+	endOffset, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuietHours{
+		Start:    startOffset,
+		End:      endOffset,
+		Location: time.UTC,
+	}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: %w", s, err)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Defer reports whether t falls inside the window and, if so, when the
+// window next ends. t should already be in the recipient's location
+func (q *QuietHours) Defer(t time.Time) (time.Time, bool) {
+	if q.Start == q.End {
+		return t, false
+	}
+
+	offset := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	// End of the window on the same calendar day as t, built from the date
+	// rather than adding the offset so DST changes land on the wall clock time
+	end := time.Date(t.Year(), t.Month(), t.Day(),
+		int(q.End/time.Hour), int(q.End%time.Hour/time.Minute), 0, 0, t.Location())
+
+	if q.Start < q.End {
+		if offset >= q.Start && offset < q.End {
+			return end, true
+		}
+
+		return t, false
+	}
+
+	// The window wraps midnight
+	switch {
+	case offset >= q.Start:
+		return end.AddDate(0, 0, 1), true
+	case offset < q.End:
+		return end, true
+	}
+
+	return t, false
+}
+
+func (q *QuietHours) location(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		if q.Location == nil {
+			return time.UTC, nil
+		}
+		return q.Location, nil
+	}
+
+	return time.LoadLocation(timeZone)
+}
@@ -0,0 +1,69 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	qh, err := core.ParseQuietHours("21:00-08:30")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if qh.Start != 21*time.Hour || qh.End != 8*time.Hour+30*time.Minute {
+		t.Errorf("unexpected window %v-%v", qh.Start, qh.End)
+	}
+}
+
+func TestParseQuietHoursInvalid(t *testing.T) {
+	for _, in := range []string{"", "21:00", "21:00-25:00", "nine-five"} {
+		if _, err := core.ParseQuietHours(in); err == nil {
+			t.Errorf("%q should not have parsed", in)
+		}
+	}
+}
+
+func TestQuietHoursDefer(t *testing.T) {
+	day := func(h, m int) time.Time {
+		return time.Date(2022, 6, 1, h, m, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		window   string
+		at       time.Time
+		deferred bool
+		until    time.Time
+	}{
+		{"before overnight window", "21:00-08:00", day(20, 59), false, time.Time{}},
+		{"late evening", "21:00-08:00", day(23, 0), true, day(8, 0).AddDate(0, 0, 1)},
+		{"early morning", "21:00-08:00", day(3, 0), true, day(8, 0)},
+		{"window end is allowed", "21:00-08:00", day(8, 0), false, time.Time{}},
+		{"inside daytime window", "12:00-14:00", day(13, 0), true, day(14, 0)},
+		{"outside daytime window", "12:00-14:00", day(15, 0), false, time.Time{}},
+		{"empty window", "09:00-09:00", day(9, 0), false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qh, err := core.ParseQuietHours(tt.window)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			until, deferred := qh.Defer(tt.at)
+			if deferred != tt.deferred {
+				t.Errorf("deferred = %v, want %v", deferred, tt.deferred)
+			}
+
+			if deferred && !until.Equal(tt.until) {
+				t.Errorf("deferred until %v, want %v", until, tt.until)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// Recipient is someone notifications can be addressed to by ID alone,
+// core looks up where to send and what they've agreed to receive
+type Recipient struct {
+	ID       string `json:"id"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Locale   string `json:"locale"`
+	TimeZone string `json:"time_zone"`
+
+	// Addresses on any other channel keyed by channel name, push tokens,
+	// slack member IDs and so on
+	Addresses map[string]string `json:"addresses"`
+
+	// The channels they've opted into, empty means every channel
+	Channels []string `json:"channels"`
+}
+
+// Address returns where to reach the recipient on the channel, empty if
+// they have no address there or haven't opted into it
+func (r *Recipient) Address(channel string) string {
+	if !r.OptedIn(channel) {
+		return ""
+	}
+
+	switch channel {
+	case ChannelEmail:
+		return r.Email
+	case ChannelSMS:
+		return r.Phone
+	}
+
+	return r.Addresses[channel]
+}
+
+func (r *Recipient) OptedIn(channel string) bool {
+	if len(r.Channels) == 0 {
+		return true
+	}
+
+	for _, c := range r.Channels {
+		if c == channel {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Recipient) validate() error {
+	if r == nil || r.ID == "" {
+		return invalid(errors.New("recipient id missing"))
+	}
+
+	return nil
+}
+
+// GetRecipient looks up a recipient by ID
+func (c *Client) GetRecipient(ctx context.Context, id string) (*Recipient, error) {
+	if c.directory == nil {
+		return nil, ErrNotFound
+	}
+
+	recipient, err := c.directory.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if recipient == nil {
+		return nil, ErrNotFound
+	}
+
+	return recipient, nil
+}
+
+// ListRecipients returns everyone in the directory
+func (c *Client) ListRecipients(ctx context.Context) ([]*Recipient, error) {
+	if c.directory == nil {
+		return nil, errors.New("no recipient directory configured")
+	}
+
+	return c.directory.List(ctx)
+}
+
+// PutRecipient creates or replaces a recipient
+func (c *Client) PutRecipient(ctx context.Context, recipient *Recipient) error {
+	if c.directory == nil {
+		return errors.New("no recipient directory configured")
+	}
+
+	if err := recipient.validate(); err != nil {
+		return err
+	}
+
+	return c.directory.Put(ctx, recipient)
+}
+
+// DeleteRecipient removes a recipient
+func (c *Client) DeleteRecipient(ctx context.Context, id string) error {
+	if c.directory == nil {
+		return ErrNotFound
+	}
+
+	found, err := c.directory.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Fills in the addresses, time zone, locale and content of a notification addressed
+// by user ID and/or template name, returning a copy so the caller's input,
+// and anything scheduled from it, is left as it was
+func (c *Client) resolve(ctx context.Context, in *Task1Input) (*Task1Input, error) {
+	resolved := *in
+
+	if in.UserID != "" {
+		recipient, err := c.GetRecipient(ctx, in.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Addresses only ever come from the profile so a caller can't reach
+		// a channel the recipient hasn't opted into
+		resolved.To = recipient.Address(ChannelEmail)
+		resolved.Number = recipient.Address(ChannelSMS)
+		resolved.Recipients = map[string]string{}
+		for channel := range recipient.Addresses {
+			if address := recipient.Address(channel); address != "" {
+				resolved.Recipients[channel] = address
+			}
+		}
+
+		if resolved.TimeZone == "" {
+			resolved.TimeZone = recipient.TimeZone
+		}
+
+		if resolved.Locale == "" {
+			resolved.Locale = recipient.Locale
+		}
+	}
+
+	if in.Template != "" {
+		templates := c.current().templates
+		if templates == nil {
+			return nil, errors.New("no templates configured")
+		}
+
+		// A template that's missing or wants data it wasn't given is the
+		// caller's mistake
+		subject, body, err := templates.Render(ctx, in.Template, resolved.Locale, in.Data)
+		if err != nil {
+			return nil, invalid(err)
+		}
+
+		resolved.Subject, resolved.Body = subject, body
+	}
+
+	return &resolved, nil
+}
@@ -0,0 +1,225 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// A map backed directory, enough to stand in for pkg/directory
+type MockDirectory struct {
+	Recipients map[string]*core.Recipient
+}
+
+func (md *MockDirectory) Get(ctx context.Context, id string) (*core.Recipient, error) {
+	return md.Recipients[id], nil
+}
+
+func (md *MockDirectory) List(ctx context.Context) ([]*core.Recipient, error) {
+	var recipients []*core.Recipient
+	for _, r := range md.Recipients {
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+func (md *MockDirectory) Put(ctx context.Context, r *core.Recipient) error {
+	md.Recipients[r.ID] = r
+	return nil
+}
+
+func (md *MockDirectory) Delete(ctx context.Context, id string) (bool, error) {
+	_, ok := md.Recipients[id]
+	delete(md.Recipients, id)
+	return ok, nil
+}
+
+type MockTemplates struct {
+	RenderMock func(context.Context, string, string, map[string]any) (string, string, error)
+}
+
+func (mt *MockTemplates) Render(ctx context.Context, name, locale string, data map[string]any) (string, string, error) {
+	return mt.RenderMock(ctx, name, locale, data)
+}
+
+var mockTemplates = &MockTemplates{
+	RenderMock: func(ctx context.Context, name, locale string, data map[string]any) (string, string, error) {
+		if name != "welcome" {
+			return "", "", errors.New("template not found")
+		}
+		if locale == "fr-FR" {
+			return "Bienvenue", "Salut " + data["name"].(string), nil
+		}
+		return "Welcome", "Hi " + data["name"].(string), nil
+	},
+}
+
+func TestRecipientAddressing(t *testing.T) {
+	email := &MockChannel{}
+	sms := &MockChannel{}
+	push := &MockChannel{}
+
+	directory := &MockDirectory{Recipients: map[string]*core.Recipient{
+		"everything": {
+			ID:        "everything",
+			Email:     "everything@example.com",
+			Phone:     "0123456789",
+			Addresses: map[string]string{core.ChannelPush: "token"},
+		},
+		"email_only": {
+			ID:        "email_only",
+			Email:     "email@example.com",
+			Phone:     "0123456789",
+			Addresses: map[string]string{core.ChannelPush: "token"},
+			Channels:  []string{core.ChannelEmail},
+		},
+		"french": {
+			ID:       "french",
+			Email:    "french@example.com",
+			Locale:   "fr-FR",
+			Channels: []string{core.ChannelEmail},
+		},
+	}}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelEmail: email,
+			core.ChannelSMS:   sms,
+			core.ChannelPush:  push,
+		},
+		Directory: directory,
+		Templates: mockTemplates,
+	}))
+
+	reset := func() {
+		email.Sent, sms.Sent, push.Sent = nil, nil, nil
+	}
+
+	t.Run("EveryChannel", func(t *testing.T) {
+		reset()
+		in := &core.Task1Input{UserID: "everything", Template: "welcome", Data: map[string]any{"name": "Sam"}}
+		if _, err := client.Task1(context.TODO(), in); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(email.Sent) != 1 || email.Sent[0].To != "everything@example.com" || email.Sent[0].Body != "Hi Sam" {
+			t.Errorf("unexpected email %+v", email.Sent)
+		}
+		if len(sms.Sent) != 1 || len(push.Sent) != 1 {
+			t.Errorf("sms %v and push %v should have been sent once", len(sms.Sent), len(push.Sent))
+		}
+
+		if in.To != "" || in.Body != "" {
+			t.Error("the caller's input should not have been changed")
+		}
+	})
+
+	t.Run("OptedInOnly", func(t *testing.T) {
+		reset()
+		// The number passed by the caller is ignored, it's the profile that counts
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{UserID: "email_only", Number: "0999999999"}); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(email.Sent) != 1 || len(sms.Sent) != 0 || len(push.Sent) != 0 {
+			t.Errorf("only email should have been sent, got %v %v %v", len(email.Sent), len(sms.Sent), len(push.Sent))
+		}
+	})
+
+	t.Run("RecipientLocale", func(t *testing.T) {
+		reset()
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{UserID: "french", Template: "welcome", Data: map[string]any{"name": "Sam"}}); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(email.Sent) != 1 || email.Sent[0].Subject != "Bienvenue" {
+			t.Errorf("unexpected email %+v", email.Sent)
+		}
+	})
+
+	t.Run("InputLocaleWins", func(t *testing.T) {
+		reset()
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{UserID: "french", Locale: "en-GB", Template: "welcome", Data: map[string]any{"name": "Sam"}}); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(email.Sent) != 1 || email.Sent[0].Subject != "Welcome" {
+			t.Errorf("unexpected email %+v", email.Sent)
+		}
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{UserID: "nobody"}); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("expected not found, got %v", err)
+		}
+	})
+
+	t.Run("UnknownTemplate", func(t *testing.T) {
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{UserID: "everything", Template: "missing"}); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+}
+
+func TestRecipientCRUD(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Directory: &MockDirectory{Recipients: map[string]*core.Recipient{}},
+	}))
+
+	if err := client.PutRecipient(context.TODO(), &core.Recipient{ID: "u1", Email: "example@example.com"}); err != nil {
+		t.Error(err)
+	}
+
+	if err := client.PutRecipient(context.TODO(), &core.Recipient{}); err == nil {
+		t.Error("a recipient without an id should be rejected")
+	}
+
+	recipient, err := client.GetRecipient(context.TODO(), "u1")
+	if err != nil || recipient.Email != "example@example.com" {
+		t.Errorf("unexpected recipient %+v (%v)", recipient, err)
+	}
+
+	if recipients, err := client.ListRecipients(context.TODO()); err != nil || len(recipients) != 1 {
+		t.Errorf("unexpected recipients %+v (%v)", recipients, err)
+	}
+
+	if err := client.DeleteRecipient(context.TODO(), "u1"); err != nil {
+		t.Error(err)
+	}
+
+	if err := client.DeleteRecipient(context.TODO(), "u1"); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if _, err := client.GetRecipient(context.TODO(), "u1"); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestWithoutDirectoryOrTemplates(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	if _, err := client.Task1(context.TODO(), &core.Task1Input{UserID: "u1"}); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com", Template: "welcome"}); err == nil {
+		t.Error("error should have been returned")
+	}
+
+	if err := client.PutRecipient(context.TODO(), &core.Recipient{ID: "u1"}); err == nil {
+		t.Error("error should have been returned")
+	}
+
+	if _, err := client.ListRecipients(context.TODO()); err == nil {
+		t.Error("error should have been returned")
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The parts of the client that can be changed while it's running, each one
+// replaces what the client has, just as the same field of ClientOptions
+// would, so leaving one nil turns it off
+type ReloadOptions struct {
+	// Every channel, any the client has that aren't here are dropped other
+	// than those added with RegisterChannel
+	Channels map[string]Channel
+
+	Templates TemplateService
+
+	QuietHours *QuietHours
+
+	Routes map[string]*Route
+}
+
+// Only ever replaced, never changed, so once read it can be used
+// without holding the lock
+type settings struct {
+	channels   *Registry
+	templates  TemplateService
+	quietHours *QuietHours
+	routes     map[string]*Route
+}
+
+func newSettings(opts *ReloadOptions, scheduler SchedulerService) (*settings, error) {
+	channels := NewRegistry()
+	for name, ch := range opts.Channels {
+		if err := channels.Register(name, ch); err != nil {
+			return nil, err
+		}
+	}
+
+	// Quiet hours without somewhere to hold the deferred messages would
+	// silently drop them, so refuse to start instead
+	if opts.QuietHours != nil && scheduler == nil {
+		return nil, errors.New("quiet hours require a scheduler")
+	}
+
+	for name, route := range opts.Routes {
+		if err := route.validate(); err != nil {
+			return nil, fmt.Errorf("route %q: %w", name, err)
+		}
+
+		for _, channel := range route.Channels {
+			if _, ok := channels.Get(channel); !ok {
+				return nil, fmt.Errorf("route %q: channel %q not registered", name, channel)
+			}
+		}
+	}
+
+	return &settings{
+		channels:   channels,
+		templates:  opts.Templates,
+		quietHours: opts.QuietHours,
+		routes:     opts.Routes,
+	}, nil
+}
+
+// Reload swaps in new channels, templates, quiet hours and routes, checking
+// them the same way New does first. When they don't pass the client carries
+// on with what it had, and notifications already being sent finish with the
+// settings they started with
+func (c *Client) Reload(opts *ReloadOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Channels registered at runtime aren't in the config being reloaded,
+	// so they're added back rather than dropped
+	channels := map[string]Channel{}
+	for name, ch := range opts.Channels {
+		channels[name] = ch
+	}
+
+	for name, ch := range c.registered {
+		if _, ok := channels[name]; ok {
+			return fmt.Errorf("channel %q was registered at runtime, it can't be reloaded", name)
+		}
+		channels[name] = ch
+	}
+
+	reloaded := *opts
+	reloaded.Channels = channels
+
+	settings, err := newSettings(&reloaded, c.scheduler)
+	if err != nil {
+		return err
+	}
+
+	c.settings = settings
+	return nil
+}
+
+func (c *Client) current() *settings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.settings
+}
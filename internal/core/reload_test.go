@@ -0,0 +1,138 @@
+package core_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+func TestReload(t *testing.T) {
+	var mu sync.Mutex
+	var from []string
+
+	sender := func(name string) *MockEmailClient {
+		return &MockEmailClient{
+			SendMock: func(ctx context.Context, s1, s2, s3 string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				from = append(from, name)
+				return nil
+			},
+		}
+	}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(sender("old"), mockSMSClient),
+	}))
+
+	in := &core.Task1Input{To: "john@example.com", Type: "welcome"}
+
+	if _, err := client.Task1(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+
+	// Routes naming a channel that isn't there are turned away, and the
+	// client carries on with what it had
+	err := client.Reload(&core.ReloadOptions{
+		Channels: channels(sender("rejected"), mockSMSClient),
+		Routes:   map[string]*core.Route{"welcome": {Mode: core.RouteAll, Channels: []string{"pigeon"}}},
+	})
+	if err == nil {
+		t.Error("expected the reload to be rejected")
+	}
+
+	if _, err := client.Task1(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Reload(&core.ReloadOptions{
+		Channels: channels(sender("new"), mockSMSClient),
+		Routes:   map[string]*core.Route{"welcome": {Mode: core.RouteAll, Channels: []string{core.ChannelEmail}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Task1(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(from) != 3 || from[0] != "old" || from[1] != "old" || from[2] != "new" {
+		t.Errorf("sent by %v, want [old old new]", from)
+	}
+}
+
+func TestReloadKeepsRegistered(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	slack := &MockChannel{}
+	if err := client.RegisterChannel("slack", slack); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Reload(&core.ReloadOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+		Routes:   map[string]*core.Route{"alert": {Mode: core.RouteAll, Channels: []string{"slack"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Task1(context.Background(), &core.Task1Input{Type: "alert", Recipients: map[string]string{"slack": "#alerts"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(slack.Sent) != 1 {
+		t.Error("the registered channel was dropped by the reload")
+	}
+
+	// A config can't bring in a channel of the same name
+	reloaded := channels(mockEmailClient, mockSMSClient)
+	reloaded["slack"] = &MockChannel{}
+	if err := client.Reload(&core.ReloadOptions{Channels: reloaded}); err == nil {
+		t.Error("expected a clash with the registered channel to be rejected")
+	}
+}
+
+func TestReloadQuietHoursNeedScheduler(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	qh, err := core.ParseQuietHours("21:00-08:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Reload(&core.ReloadOptions{
+		Channels:   channels(mockEmailClient, mockSMSClient),
+		QuietHours: qh,
+	}); err == nil {
+		t.Error("expected quiet hours without a scheduler to be rejected")
+	}
+}
+
+// Sends while reloading, go test -race catches any unguarded access
+func TestReloadConcurrent(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			client.Task1(context.Background(), &core.Task1Input{To: "john@example.com"})
+		}()
+
+		go func() {
+			defer wg.Done()
+			client.Reload(&core.ReloadOptions{Channels: channels(mockEmailClient, mockSMSClient)})
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// How a route treats the channels it lists
+const (
+	// Every addressed channel is sent to, any failure fails the notification
+	RouteAll = "all"
+	// Channels are tried in order until one succeeds, so a route of
+	// sms then email falls back to email when the SMS fails
+	RouteFirstSuccess = "first_success"
+)
+
+// The names the clients are conventionally registered under, Task1Input's
+// To and Number address email and sms, everything else uses Recipients
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+	ChannelPush    = "push"
+)
+
+// Routes with this name are used for any notification type that doesn't
+// have a route of its own
+const DefaultRouteName = "default"
+
+// Route declares which channels a notification type goes out on
+type Route struct {
+	Mode     string   `json:"mode"`
+	Channels []string `json:"channels"`
+}
+
+// LoadRoutes reads routes keyed by notification type from JSON, channel names
+// are checked against what's registered when the routes are passed to New
+//
+//	{"password_reset": {"mode": "first_success", "channels": ["sms", "email"]}}
+func LoadRoutes(r io.Reader) (map[string]*Route, error) {
+	var routes map[string]*Route
+	if err := json.NewDecoder(r).Decode(&routes); err != nil {
+		return nil, err
+	}
+
+	for name, route := range routes {
+		if err := route.validate(); err != nil {
+			return nil, fmt.Errorf("route %q: %w", name, err)
+		}
+	}
+
+	return routes, nil
+}
+
+func (r *Route) validate() error {
+	if r == nil {
+		return fmt.Errorf("route is empty")
+	}
+
+	switch r.Mode {
+	case RouteAll, RouteFirstSuccess:
+	default:
+		return fmt.Errorf("unknown mode %q", r.Mode)
+	}
+
+	if len(r.Channels) == 0 {
+		return fmt.Errorf("no channels")
+	}
+
+	return nil
+}
+
+// Returns the route with only the channels named, in the route's order,
+// the route as it is when none are
+func (r *Route) only(channels []string) *Route {
+	if len(channels) == 0 {
+		return r
+	}
+
+	limited := &Route{Mode: r.Mode}
+	for _, channel := range r.Channels {
+		for _, wanted := range channels {
+			if channel == wanted {
+				limited.Channels = append(limited.Channels, channel)
+				break
+			}
+		}
+	}
+
+	return limited
+}
+
+// DeliveryError is returned when a route fails, holding what went wrong on
+// each channel in the order they were tried
+type DeliveryError struct {
+	Failures []ChannelError
+}
+
+type ChannelError struct {
+	Channel string
+	Err     error
+}
+
+func (e *DeliveryError) Error() string {
+	parts := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		parts = append(parts, f.Channel+": "+f.Err.Error())
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// Is and As look through every channel's error, rather than relying on
+// Unwrap() []error which older toolchains' errors package ignores
+func (e *DeliveryError) Is(target error) bool {
+	for _, f := range e.Failures {
+		if errors.Is(f.Err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *DeliveryError) As(target any) bool {
+	for _, f := range e.Failures {
+		if errors.As(f.Err, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,258 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+var errMockSend = errors.New("mock send error")
+
+func TestLoadRoutes(t *testing.T) {
+	routes, err := core.LoadRoutes(strings.NewReader(`{
+		"password_reset": {"mode": "first_success", "channels": ["sms", "email"]},
+		"default": {"mode": "all", "channels": ["email"]}
+	}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(routes) != 2 || routes["password_reset"].Channels[0] != core.ChannelSMS {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+}
+
+func TestLoadRoutesInvalid(t *testing.T) {
+	for _, in := range []string{
+		`{`,
+		`{"a": null}`,
+		`{"a": {"mode": "sometimes", "channels": ["email"]}}`,
+		`{"a": {"mode": "all", "channels": []}}`,
+	} {
+		if _, err := core.LoadRoutes(strings.NewReader(in)); err == nil {
+			t.Errorf("%v should not have loaded", in)
+		}
+	}
+}
+
+func TestNewInvalidRoute(t *testing.T) {
+	for _, route := range []*core.Route{
+		{Mode: "sometimes", Channels: []string{core.ChannelEmail}},
+		{Mode: core.RouteAll, Channels: []string{"pigeon"}},
+	} {
+		_, err := core.New(&core.ClientOptions{
+			Channels: channels(mockEmailClient, mockSMSClient),
+			Routes:   map[string]*core.Route{"a": route},
+		})
+
+		if err == nil {
+			t.Errorf("%+v should have been rejected", route)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	var sent []string
+	var emailErr, smsErr error
+
+	emailClient := &MockEmailClient{
+		SendMock: func(ctx context.Context, s1, s2, s3 string) error {
+			sent = append(sent, core.ChannelEmail)
+			return emailErr
+		},
+	}
+
+	smsClient := &MockSMSClient{
+		SendMock: func(ctx context.Context, s1, s2 string) error {
+			sent = append(sent, core.ChannelSMS)
+			return smsErr
+		},
+	}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(emailClient, smsClient),
+		Routes: map[string]*core.Route{
+			"fallback":   {Mode: core.RouteFirstSuccess, Channels: []string{core.ChannelSMS, core.ChannelEmail}},
+			"email_only": {Mode: core.RouteAll, Channels: []string{core.ChannelEmail}},
+		},
+	}))
+
+	input := func(notificationType string) *core.Task1Input {
+		return &core.Task1Input{
+			Type:   notificationType,
+			To:     "example@example.com",
+			Number: "0123456789",
+		}
+	}
+
+	tests := []struct {
+		name      string
+		in        *core.Task1Input
+		emailErr  error
+		smsErr    error
+		wantSent  string
+		wantError bool
+	}{
+		{"default sends everything", input(""), nil, nil, "email,sms", false},
+		{"default reports sms failure", input(""), nil, errMockSend, "email,sms", true},
+		{"fallback stops on success", input("fallback"), nil, nil, "sms", false},
+		{"fallback to email", input("fallback"), nil, errMockSend, "sms,email", false},
+		{"fallback exhausted", input("fallback"), errMockSend, errMockSend, "sms,email", true},
+		{"fallback skips unaddressed", &core.Task1Input{Type: "fallback", To: "example@example.com"}, nil, nil, "email", false},
+		{"email only", input("email_only"), nil, nil, "email", false},
+		{"unknown type uses default", input("unknown"), nil, nil, "email,sms", false},
+		{"nothing addressed", &core.Task1Input{Type: "email_only", Number: "0123456789"}, nil, nil, "", true},
+		{"limited to sms", &core.Task1Input{To: "example@example.com", Number: "0123456789", Channels: []string{core.ChannelSMS}}, nil, nil, "sms", false},
+		{"limit outside the route", &core.Task1Input{Type: "email_only", Number: "0123456789", Channels: []string{core.ChannelSMS}}, nil, nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent, emailErr, smsErr = nil, tt.emailErr, tt.smsErr
+
+			_, err := client.Task1(context.TODO(), tt.in)
+			if (err != nil) != tt.wantError {
+				t.Errorf("error = %v, want error %v", err, tt.wantError)
+			}
+
+			if got := strings.Join(sent, ","); got != tt.wantSent {
+				t.Errorf("sent to %q, want %q", got, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestRoutingInvalid(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{Subject: "Nobody to send to"})
+
+	var invalidErr *core.InvalidError
+	if !errors.As(err, &invalidErr) {
+		t.Errorf("a notification without an address should be invalid, got %v", err)
+	}
+}
+
+func TestDeliveryError(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(&MockEmailClient{
+			SendMock: func(ctx context.Context, s1, s2, s3 string) error {
+				return errMockSend
+			},
+		}, mockSMSClient),
+	}))
+
+	_, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com", Number: "0123456789"})
+
+	var deliveryErr *core.DeliveryError
+	if !errors.As(err, &deliveryErr) {
+		t.Errorf("expected a delivery error, got %v", err)
+		return
+	}
+
+	if len(deliveryErr.Failures) != 1 || deliveryErr.Failures[0].Channel != core.ChannelEmail {
+		t.Errorf("unexpected failures %+v", deliveryErr.Failures)
+	}
+
+	if !errors.Is(err, errMockSend) {
+		t.Error("delivery error should unwrap to the channel error")
+	}
+
+	wrapped := &core.DeliveryError{Failures: []core.ChannelError{
+		{Channel: core.ChannelEmail, Err: errMockSend},
+		{Channel: core.ChannelSMS, Err: &os.PathError{Op: "open", Path: "sms", Err: errMockSend}},
+	}}
+
+	var pathErr *os.PathError
+	if !errors.As(wrapped, &pathErr) || pathErr.Path != "sms" {
+		t.Error("delivery error should find an error of the type on any channel")
+	}
+}
+
+func TestRoutingQuietHours(t *testing.T) {
+	var sent []string
+	var emailErr, smsErr error
+
+	emailClient := &MockEmailClient{
+		SendMock: func(ctx context.Context, s1, s2, s3 string) error {
+			sent = append(sent, core.ChannelEmail)
+			return emailErr
+		},
+	}
+
+	smsClient := &MockSMSClient{
+		SendMock: func(ctx context.Context, s1, s2 string) error {
+			sent = append(sent, core.ChannelSMS)
+			return smsErr
+		},
+	}
+
+	var scheduled int
+	var scheduledAt time.Time
+	var scheduledKind string
+	var scheduledPayload []byte
+
+	// Quiet hours only hold SMS back, it's 23:00
+	now := time.Date(2022, 6, 1, 23, 0, 0, 0, time.UTC)
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(emailClient, smsClient),
+		Routes: map[string]*core.Route{
+			"fallback": {Mode: core.RouteFirstSuccess, Channels: []string{core.ChannelSMS, core.ChannelEmail}},
+		},
+		QuietHours: &core.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour, Channels: []string{core.ChannelSMS}},
+		Scheduler: &MockScheduler{
+			ScheduleMock: func(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+				scheduled++
+				scheduledAt, scheduledKind, scheduledPayload = at, kind, payload
+				return "id", nil
+			},
+		},
+		Now: func() time.Time { return now },
+	}))
+
+	in := &core.Task1Input{Type: "fallback", To: "example@example.com", Number: "0123456789"}
+
+	t.Run("FallsBackNow", func(t *testing.T) {
+		if _, err := client.Task1(context.TODO(), in); err != nil {
+			t.Error(err)
+		}
+
+		if got := strings.Join(sent, ","); got != "email" || scheduled != 0 {
+			t.Errorf("sent to %q and scheduled %v, want email and nothing held", got, scheduled)
+		}
+	})
+
+	t.Run("HeldWhenNothingSends", func(t *testing.T) {
+		sent, emailErr = nil, errMockSend
+
+		if _, err := client.Task1(context.TODO(), in); err != nil {
+			t.Error(err)
+		}
+
+		if want := time.Date(2022, 6, 2, 8, 0, 0, 0, time.UTC); scheduled != 1 || !scheduledAt.Equal(want) {
+			t.Errorf("scheduled %v for %v, want once for %v", scheduled, scheduledAt, want)
+		}
+	})
+
+	t.Run("HeldFallsBack", func(t *testing.T) {
+		sent, emailErr, smsErr = nil, nil, errMockSend
+		now = scheduledAt
+
+		if err := client.RunScheduled(context.TODO(), scheduledKind, scheduledPayload); err != nil {
+			t.Error(err)
+		}
+
+		if got := strings.Join(sent, ","); got != "sms,email" {
+			t.Errorf("sent to %q, want sms then email", got)
+		}
+	})
+}
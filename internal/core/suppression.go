@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Suppression is an address nothing is sent to, whatever channel it's on
+type Suppression struct {
+	Address string    `json:"address"`
+	Reason  string    `json:"reason,omitempty"`
+	Added   time.Time `json:"added"`
+}
+
+// Suppress stops anything being sent to the address, suppressing one
+// already on the list updates the reason
+func (c *Client) Suppress(ctx context.Context, address, reason string) error {
+	if c.suppressions == nil {
+		return errors.New("no suppression list configured")
+	}
+
+	if strings.TrimSpace(address) == "" {
+		return invalid(errors.New("address missing"))
+	}
+
+	return c.suppressions.Add(ctx, address, reason)
+}
+
+// Unsuppress allows an address to be sent to again
+func (c *Client) Unsuppress(ctx context.Context, address string) error {
+	if c.suppressions == nil {
+		return ErrNotFound
+	}
+
+	found, err := c.suppressions.Remove(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListSuppressions returns every suppressed address
+func (c *Client) ListSuppressions(ctx context.Context) ([]*Suppression, error) {
+	if c.suppressions == nil {
+		return nil, errors.New("no suppression list configured")
+	}
+
+	return c.suppressions.List(ctx)
+}
+
+// Drops any suppressed addresses from a comma separated list, returning
+// empty when none are left and how many were dropped
+func (c *Client) unsuppressed(ctx context.Context, to string) (string, int, error) {
+	if c.suppressions == nil {
+		return to, 0, nil
+	}
+
+	var kept []string
+	dropped := 0
+	for _, address := range strings.Split(to, ",") {
+		address = strings.TrimSpace(address)
+
+		suppressed, err := c.suppressions.Suppressed(ctx, address)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if suppressed {
+			dropped++
+			continue
+		}
+		kept = append(kept, address)
+	}
+
+	return strings.Join(kept, ","), dropped, nil
+}
@@ -0,0 +1,242 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+type MockSuppressionClient struct {
+	SuppressedMock func(context.Context, string) (bool, error)
+	AddMock        func(context.Context, string, string) error
+	RemoveMock     func(context.Context, string) (bool, error)
+	ListMock       func(context.Context) ([]*core.Suppression, error)
+}
+
+func (msc *MockSuppressionClient) Suppressed(ctx context.Context, address string) (bool, error) {
+	return msc.SuppressedMock(ctx, address)
+}
+
+func (msc *MockSuppressionClient) Add(ctx context.Context, address, reason string) error {
+	return msc.AddMock(ctx, address, reason)
+}
+
+func (msc *MockSuppressionClient) Remove(ctx context.Context, address string) (bool, error) {
+	return msc.RemoveMock(ctx, address)
+}
+
+func (msc *MockSuppressionClient) List(ctx context.Context) ([]*core.Suppression, error) {
+	return msc.ListMock(ctx)
+}
+
+// A list held in a map, starting with the addresses given
+func suppressing(addresses ...string) *MockSuppressionClient {
+	list := map[string]string{}
+	for _, address := range addresses {
+		list[address] = ""
+	}
+
+	return &MockSuppressionClient{
+		SuppressedMock: func(ctx context.Context, address string) (bool, error) {
+			_, ok := list[address]
+			return ok, nil
+		},
+		AddMock: func(ctx context.Context, address, reason string) error {
+			list[address] = reason
+			return nil
+		},
+		RemoveMock: func(ctx context.Context, address string) (bool, error) {
+			_, ok := list[address]
+			delete(list, address)
+			return ok, nil
+		},
+		ListMock: func(ctx context.Context) ([]*core.Suppression, error) {
+			var suppressions []*core.Suppression
+			for address, reason := range list {
+				suppressions = append(suppressions, &core.Suppression{Address: address, Reason: reason})
+			}
+			return suppressions, nil
+		},
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	var emailed, texted []string
+
+	emailClient := &MockEmailClient{
+		SendMock: func(ctx context.Context, to, subject, body string) error {
+			emailed = append(emailed, to)
+			return nil
+		},
+	}
+
+	smsClient := &MockSMSClient{
+		SendMock: func(ctx context.Context, number, body string) error {
+			texted = append(texted, number)
+			return nil
+		},
+	}
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels:     channels(emailClient, smsClient),
+		Suppressions: suppressing("bounced@example.com", "0123456789"),
+	}))
+
+	t.Run("SkipsSuppressedChannel", func(t *testing.T) {
+		emailed, texted = nil, nil
+
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "bounced@example.com", Number: "0987654321"}); err != nil {
+			t.Error(err)
+		}
+
+		if len(emailed) != 0 || len(texted) != 1 {
+			t.Errorf("emailed %v, texted %v, only the SMS should have gone", emailed, texted)
+		}
+	})
+
+	t.Run("SkipsSuppressedAddress", func(t *testing.T) {
+		emailed, texted = nil, nil
+
+		if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "jo@example.com, bounced@example.com"}); err != nil {
+			t.Error(err)
+		}
+
+		if len(emailed) != 1 || emailed[0] != "jo@example.com" {
+			t.Errorf("emailed %v, want only jo@example.com", emailed)
+		}
+	})
+
+	t.Run("AllSuppressed", func(t *testing.T) {
+		emailed, texted = nil, nil
+
+		_, err := client.Task1(context.TODO(), &core.Task1Input{To: "bounced@example.com", Number: "0123456789"})
+		if !errors.Is(err, core.ErrSuppressed) {
+			t.Errorf("err = %v, want ErrSuppressed", err)
+		}
+
+		if len(emailed) != 0 || len(texted) != 0 {
+			t.Errorf("emailed %v, texted %v, nothing should have gone", emailed, texted)
+		}
+	})
+}
+
+func TestSuppressionDeferred(t *testing.T) {
+	voice := &MockChannel{}
+	var metrics MockMetrics
+	suppressions := suppressing()
+
+	var scheduledKind string
+	var scheduledPayload []byte
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels:     map[string]core.Channel{"voice": voice},
+		QuietHours:   &core.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour, Channels: []string{"voice"}},
+		Suppressions: suppressions,
+		Metrics:      &metrics,
+		Scheduler: &MockScheduler{
+			ScheduleMock: func(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+				scheduledKind, scheduledPayload = kind, payload
+				return "id", nil
+			},
+		},
+		Now: func() time.Time {
+			return time.Date(2022, 6, 1, 23, 0, 0, 0, time.UTC)
+		},
+	}))
+
+	if _, err := client.Task1(context.TODO(), &core.Task1Input{Recipients: map[string]string{"voice": "0123456789, 0987654321"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unsubscribing while the message is held back stops it going out
+	suppressions.Add(context.TODO(), "0123456789", "unsubscribed")
+
+	if err := client.RunScheduled(context.TODO(), scheduledKind, scheduledPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(voice.Sent) != 1 || voice.Sent[0].To != "0987654321" {
+		t.Errorf("unexpected voice messages %+v", voice.Sent)
+	}
+
+	if len(metrics.Suppressals) != 1 || metrics.Suppressals[0] != "voice" {
+		t.Errorf("unexpected suppressals %v", metrics.Suppressals)
+	}
+
+	// With every address suppressed there's nothing to send, and no error
+	suppressions.Add(context.TODO(), "0987654321", "bounced")
+	voice.Sent = nil
+
+	if err := client.RunScheduled(context.TODO(), scheduledKind, scheduledPayload); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(voice.Sent) != 0 {
+		t.Errorf("sent %+v to suppressed addresses", voice.Sent)
+	}
+}
+
+func TestSuppressionErr(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+		Suppressions: &MockSuppressionClient{
+			SuppressedMock: func(context.Context, string) (bool, error) {
+				return false, errors.New("Example error")
+			},
+		},
+	}))
+
+	// Not knowing is treated as a failure rather than sending anyway
+	if _, err := client.Task1(context.TODO(), &core.Task1Input{To: "example@example.com"}); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestSuppressionCRUD(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels:     channels(mockEmailClient, mockSMSClient),
+		Suppressions: suppressing(),
+	}))
+
+	if err := client.Suppress(context.TODO(), "jo@example.com", "bounced"); err != nil {
+		t.Error(err)
+	}
+
+	if err := client.Suppress(context.TODO(), " ", ""); err == nil {
+		t.Error("an empty address should be refused")
+	}
+
+	suppressions, err := client.ListSuppressions(context.TODO())
+	if err != nil || len(suppressions) != 1 || suppressions[0].Reason != "bounced" {
+		t.Errorf("unexpected suppressions %+v (%v)", suppressions, err)
+	}
+
+	if err := client.Unsuppress(context.TODO(), "jo@example.com"); err != nil {
+		t.Error(err)
+	}
+
+	if err := client.Unsuppress(context.TODO(), "jo@example.com"); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestWithoutSuppressions(t *testing.T) {
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, mockSMSClient),
+	}))
+
+	if err := client.Suppress(context.TODO(), "jo@example.com", ""); err == nil {
+		t.Error("error should have been returned")
+	}
+
+	if err := client.Unsuppress(context.TODO(), "jo@example.com"); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if _, err := client.ListSuppressions(context.TODO()); err == nil {
+		t.Error("error should have been returned")
+	}
+}
@@ -1,15 +1,82 @@
 package core
 
+import "time"
+
 // Dont have to do this this way, just saves a long func call
 type Task1Input struct {
-	To      string
-	From    string
-	Number  string
-	Subject string
-	Body    string
+	To      string `json:"to"`
+	From    string `json:"from"`
+	Number  string `json:"number"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+
+	// Optional, addresses the notification to someone in the recipient
+	// directory, any addresses passed alongside are ignored
+	UserID string `json:"user_id"`
+
+	// Optional, renders Subject and Body from the named template with Data
+	Template string         `json:"template"`
+	Data     map[string]any `json:"data"`
+
+	// Picks the template variant (en-GB, fr-FR), defaults to the recipient's
+	Locale string `json:"locale"`
+
+	// Addresses keyed by channel name, To and Number are shorthand
+	// for the email and sms channels and are used if these are missing
+	Recipients map[string]string `json:"recipients"`
+
+	// Picks the route the notification is sent by, see Route
+	Type string `json:"type"`
+
+	// Optional, limits the route to these of its channels, for sending
+	// again to only the ones a DeliveryError says failed
+	Channels []string `json:"channels,omitempty"`
+
+	// IANA name of the recipient's time zone (Europe/London), used to work
+	// out whether they are in quiet hours, empty uses the configured default
+	TimeZone string `json:"time_zone"`
+
+	// Urgent messages ignore quiet hours
+	Urgent bool `json:"urgent"`
+
+	// Optional, when in the future the notification is held by the
+	// scheduler and sent once it's due
+	SendAt time.Time `json:"send_at"`
+}
+
+// What came of running Task1, ID and SendAt are only set when the
+// notification was scheduled rather than sent
+type Task1Output struct {
+	ID     string    `json:"id"`
+	SendAt time.Time `json:"send_at"`
 }
 
 // Provides clear, simple to read calls to make decisions from / define behaviour
 func (ti *Task1Input) IsNumberSet() bool {
 	return ti.Number != ""
 }
+
+// Where to send to on the named channel, empty if nowhere
+func (ti *Task1Input) Address(channel string) string {
+	if address := ti.Recipients[channel]; address != "" {
+		return address
+	}
+
+	switch channel {
+	case ChannelEmail:
+		return ti.To
+	case ChannelSMS:
+		return ti.Number
+	}
+
+	return ""
+}
+
+// Whether there is somewhere to send to on the named channel
+func (ti *Task1Input) HasAddress(channel string) bool {
+	return ti.Address(channel) != ""
+}
+
+func (ti *Task1Input) IsScheduled(now time.Time) bool {
+	return ti.SendAt.After(now)
+}
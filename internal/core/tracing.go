@@ -0,0 +1,29 @@
+package core
+
+import "context"
+
+// Span is one timed piece of work within a trace
+type Span interface {
+	SetAttribute(key, value string)
+
+	// End finishes the span, a non nil err marks it as failed
+	End(err error)
+}
+
+// Tracer starts spans as children of whatever span is already in ctx,
+// returning a context carrying the new one. pkg/tracing implements this
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Used when no Tracer is passed so the client never has to check
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, string) {}
+func (noopSpan) End(error)                   {}
@@ -0,0 +1,67 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/tracing"
+)
+
+// tracing keeps its own span type, this hands it over the way the service does
+type Tracer struct {
+	*tracing.Client
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, core.Span) {
+	return t.Client.Start(ctx, name)
+}
+
+func TestTracing(t *testing.T) {
+	var exporter tracing.MemoryExporter
+	tracer := tracing.Must(tracing.New(&tracing.ClientOptions{Exporter: &exporter}))
+
+	client := core.Must(core.New(&core.ClientOptions{
+		Channels: channels(mockEmailClient, &MockSMSClient{
+			SendMock: func(context.Context, string, string) error {
+				return errMockSend
+			},
+		}),
+		Tracer: &Tracer{tracer},
+	}))
+
+	client.Task1(context.TODO(), &core.Task1Input{
+		To:     "example@example.com",
+		Number: "0123456789",
+	})
+
+	if err := tracer.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("exported %v spans, want 3", len(spans))
+	}
+
+	// Children end first so the Task1 span comes last
+	email, sms, task := spans[0], spans[1], spans[2]
+
+	if task.Name != "core.Task1" || task.Error == "" {
+		t.Errorf("unexpected task span %+v", task)
+	}
+
+	for _, span := range []*tracing.SpanData{email, sms} {
+		if span.Name != "channel.Send" || span.ParentSpanID != task.SpanID {
+			t.Errorf("unexpected channel span %+v", span)
+		}
+	}
+
+	if email.Attributes["channel"] != core.ChannelEmail || email.Error != "" {
+		t.Errorf("unexpected email span %+v", email)
+	}
+
+	if sms.Attributes["channel"] != core.ChannelSMS || sms.Error != errMockSend.Error() {
+		t.Errorf("unexpected sms span %+v", sms)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/directory"
+	"github.com/B1scuit/example-pattern-service/pkg/suppression"
+	"github.com/B1scuit/example-pattern-service/pkg/tracing"
+)
+
+// The pkg clients keep their own types so they stay free of core, these
+// hand them across. The struct types match field for field so each is a
+// plain conversion
+
+// Directory lets core look recipients up in a directory.Client
+func Directory(client *directory.Client) core.DirectoryService {
+	return &directoryAdapter{client}
+}
+
+type directoryAdapter struct {
+	*directory.Client
+}
+
+func (d *directoryAdapter) Get(ctx context.Context, id string) (*core.Recipient, error) {
+	recipient, err := d.Client.Get(ctx, id)
+	return (*core.Recipient)(recipient), err
+}
+
+func (d *directoryAdapter) List(ctx context.Context) ([]*core.Recipient, error) {
+	recipients, err := d.Client.List(ctx)
+
+	converted := make([]*core.Recipient, len(recipients))
+	for i, recipient := range recipients {
+		converted[i] = (*core.Recipient)(recipient)
+	}
+
+	return converted, err
+}
+
+func (d *directoryAdapter) Put(ctx context.Context, recipient *core.Recipient) error {
+	return d.Client.Put(ctx, (*directory.Recipient)(recipient))
+}
+
+// Suppressions lets core check and change a suppression.Client
+func Suppressions(client *suppression.Client) core.SuppressionService {
+	return &suppressionAdapter{client}
+}
+
+type suppressionAdapter struct {
+	*suppression.Client
+}
+
+func (s *suppressionAdapter) List(ctx context.Context) ([]*core.Suppression, error) {
+	suppressions, err := s.Client.List(ctx)
+
+	converted := make([]*core.Suppression, len(suppressions))
+	for i, suppression := range suppressions {
+		converted[i] = (*core.Suppression)(suppression)
+	}
+
+	return converted, err
+}
+
+// Tracer lets core and http start spans on a tracing.Client, it satisfies
+// both their Tracer interfaces
+func Tracer(client *tracing.Client) *TracerAdapter {
+	return &TracerAdapter{client}
+}
+
+type TracerAdapter struct {
+	*tracing.Client
+}
+
+func (t *TracerAdapter) Start(ctx context.Context, name string) (context.Context, core.Span) {
+	return t.Client.Start(ctx, name)
+}
@@ -0,0 +1,508 @@
+// service
+//
+// Wires every package together into the HTTP service, kept out of main so the
+// CLI's serve command runs exactly the same service as cmd/http_service. You can
+// see each client as it's loaded and what goes into each client, this is the
+// reference for how the packages are being run
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/config"
+	"github.com/B1scuit/example-pattern-service/pkg/directory"
+	"github.com/B1scuit/example-pattern-service/pkg/email"
+	"github.com/B1scuit/example-pattern-service/pkg/http"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/B1scuit/example-pattern-service/pkg/metrics"
+	"github.com/B1scuit/example-pattern-service/pkg/push"
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
+	"github.com/B1scuit/example-pattern-service/pkg/sandbox"
+	"github.com/B1scuit/example-pattern-service/pkg/scheduler"
+	"github.com/B1scuit/example-pattern-service/pkg/secrets"
+	"github.com/B1scuit/example-pattern-service/pkg/slack"
+	"github.com/B1scuit/example-pattern-service/pkg/sms"
+	"github.com/B1scuit/example-pattern-service/pkg/suppression"
+	"github.com/B1scuit/example-pattern-service/pkg/templates"
+	"github.com/B1scuit/example-pattern-service/pkg/tracing"
+	"github.com/B1scuit/example-pattern-service/pkg/webhook"
+)
+
+// Run serves until ctx is done or SIGINT/SIGTERM, cfg is what it starts
+// with and load is how it's loaded again when it changes
+func Run(ctx context.Context, load *config.LoadOptions, cfg *config.Config) error {
+	// Addresses and content are masked in logs and error responses unless
+	// turned off, the body is hashed, truncated or kept as configured
+	redactClient := redact.Must(redact.New(&redact.ClientOptions{
+		Disabled: !cfg.Log.Redact,
+		Body:     cfg.Log.RedactBody,
+	}))
+
+	logger := logging.Must(logging.New(&logging.ClientOptions{
+		Format:    cfg.Log.Format,
+		Level:     cfg.Log.Level,
+		Redact:    redactClient,
+		MessageID: core.MessageID,
+	}))
+
+	// Everything below reports into this, scraped from /metrics
+	metricsClient := metrics.Must(metrics.New(&metrics.ClientOptions{
+		Logger: logger,
+	}))
+	notificationMetrics := metrics.NewNotifications(metricsClient)
+
+	// With a scheduler dir set scheduled notifications survive a restart
+	schedulerClient := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+		Logger:     logger,
+		Dir:        cfg.Scheduler.Dir,
+		MaxPending: cfg.Scheduler.MaxPending,
+	}))
+
+	// Recipients addressed by user ID, a directory path keeps them across restarts
+	directoryClient := directory.Must(directory.New(&directory.ClientOptions{
+		Logger: logger,
+		Path:   cfg.Directory.Path,
+	}))
+
+	// Addresses on the list are never sent to, the CLI's suppress commands
+	// change the same file and changes are picked up as they're made
+	suppressionClient := suppression.Must(suppression.New(&suppression.ClientOptions{
+		Logger: logger,
+		Path:   cfg.Suppression.File,
+	}))
+
+	// In development emails and SMS can be kept to be looked at on /sandbox/
+	// rather than sent, it outlives reloads so nothing caught is lost
+	var sandboxClient *sandbox.Client
+	if cfg.Sandbox.Enabled {
+		sandboxClient = sandbox.Must(sandbox.New(&sandbox.ClientOptions{
+			Logger: logger,
+			Limit:  cfg.Sandbox.Limit,
+		}))
+		logger.Warn("Sandbox enabled, emails and SMS are kept on /sandbox/ and not sent, slack, webhooks and push are off")
+	}
+
+	// Credentials in the config can be secret://name references, looked up
+	// in the configured backend and fetched again every refresh interval,
+	// a rotated secret reloads the providers that use it
+	var watcher *config.Watcher
+	secretsBackend, err := cfg.Secrets.Open()
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+
+	secretsClient := secrets.Must(secrets.New(&secrets.ClientOptions{
+		Logger:          logger,
+		Backend:         secretsBackend,
+		RefreshInterval: cfg.Secrets.RefreshInterval,
+		OnRotate: func(ctx context.Context, name string) {
+			watcher.Reload(ctx)
+		},
+	}))
+
+	// Everything a reload can change is built from the config here, and
+	// again each time it changes
+	var active atomic.Pointer[providers]
+	build := func(cfg *config.Config) (*providers, error) {
+		return newProviders(cfg, logger, secretsClient, directoryClient, sandboxClient, notificationMetrics)
+	}
+
+	initial, err := build(cfg)
+	if err != nil {
+		return err
+	}
+	active.Store(initial)
+
+	// Traces go to an OpenTelemetry collector when its endpoint is set,
+	// the nil interfaces otherwise leave core and http untraced
+	var coreTracer core.Tracer
+	var httpTracer http.Tracer
+
+	tracingClient := tracer(logger, redactClient, cfg)
+	if tracingClient != nil {
+		adapter := Tracer(tracingClient)
+		coreTracer, httpTracer = adapter, adapter
+	}
+
+	coreClient := core.Must(core.New(&core.ClientOptions{
+		Channels:   initial.reload.Channels,
+		Directory:  Directory(directoryClient),
+		Templates:  initial.reload.Templates,
+		QuietHours: initial.reload.QuietHours,
+		Scheduler:  schedulerClient,
+		Routes:     initial.reload.Routes,
+		Metrics:    notificationMetrics,
+		Tracer:     coreTracer,
+
+		Suppressions: Suppressions(suppressionClient),
+	}))
+
+	metricsClient.Gauge("scheduler_queue_depth", "Scheduled jobs waiting to run.", func() float64 {
+		return float64(schedulerClient.Pending())
+	})
+
+	// The scheduler hands deferred work back to core once it's due
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go schedulerClient.Run(ctx, coreClient.RunScheduled)
+
+	// SIGHUP, or editing the config file, templates or routes, swaps in the
+	// new providers without a restart, a config that fails to build is
+	// logged and the running one kept
+	watcher = config.MustWatcher(config.NewWatcher(&config.WatcherOptions{
+		Logger:  logger,
+		Load:    load,
+		Current: cfg,
+		Apply: func(ctx context.Context, current, next *config.Config) (*config.Config, error) {
+			p, err := build(next)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := coreClient.Reload(p.reload); err != nil {
+				return nil, err
+			}
+			active.Store(p)
+
+			// What's still running is reported as it is, so the warning
+			// comes back on every reload until the service is restarted
+			keys := needRestart(current, next)
+			if len(keys) > 0 {
+				logger.WarnContext(ctx, "Config changes need a restart to apply", "settings", keys)
+			}
+
+			return config.Keep(current, next, keys), nil
+		},
+	}))
+	go watcher.Run(ctx)
+	go secretsClient.Run(ctx)
+
+	// The scheduler goes first so jobs it has claimed finish before core
+	// stops taking work, tracing last so it flushes the spans of both
+	drainers := []http.Drainer{schedulerClient, coreClient}
+	if tracingClient != nil {
+		go tracingClient.Run(ctx)
+		drainers = append(drainers, tracingClient)
+	}
+
+	// With a key set callers need it as a bearer token, read on every
+	// request so a rotated key takes effect straight away
+	var apiKey http.Secret
+	if cfg.HTTP.APIKey != "" {
+		key, err := secretsClient.Ref(ctx, cfg.HTTP.APIKey)
+		if err != nil {
+			return err
+		}
+		apiKey = key
+	}
+
+	httpOpts := &http.ClientOptions{
+		Logger:         logger,
+		Addr:           cfg.HTTP.Addr,
+		Core:           coreClient,
+		DrainTimeout:   cfg.HTTP.DrainTimeout,
+		ReadinessGrace: cfg.HTTP.ReadyGrace,
+		Drainers:       drainers,
+
+		Metrics:        notificationMetrics,
+		MetricsHandler: metricsClient,
+		Tracer:         httpTracer,
+		Redact:         redactClient,
+		APIKey:         apiKey,
+
+		HealthChecks: map[string]http.HealthChecker{
+			"email": http.HealthCheckFunc(func(ctx context.Context) error {
+				return active.Load().email.Check(ctx)
+			}),
+			"sms": http.HealthCheckFunc(func(ctx context.Context) error {
+				return active.Load().sms.Check(ctx)
+			}),
+			"scheduler": schedulerClient,
+			"directory": directoryClient,
+		},
+	}
+
+	if sandboxClient != nil {
+		httpOpts.SandboxHandler = sandboxClient
+	}
+
+	return http.Must(http.New(httpOpts)).RunServer(ctx)
+}
+
+// The OTLP endpoint is the collector's base URL, as the OpenTelemetry
+// SDKs read OTEL_EXPORTER_OTLP_ENDPOINT, with the service name naming us
+func tracer(logger *slog.Logger, redactClient *redact.Client, cfg *config.Config) *tracing.Client {
+	if cfg.Tracing.OTLPEndpoint == "" {
+		return nil
+	}
+
+	return tracing.Must(tracing.New(&tracing.ClientOptions{
+		Logger:      logger,
+		ServiceName: cfg.Tracing.ServiceName,
+		Redact:      redactClient,
+		Exporter: &tracing.OTLPExporter{
+			Endpoint: strings.TrimSuffix(cfg.Tracing.OTLPEndpoint, "/") + "/v1/traces",
+		},
+	}))
+}
+
+// The clients a reload replaces, swapped together so the health checks
+// always look at the ones notifications are being sent through
+type providers struct {
+	email *email.Client
+	sms   *sms.Client
+
+	reload *core.ReloadOptions
+}
+
+// The config sections newProviders reads, changes anywhere else need a restart
+var reloadable = map[string]bool{
+	"email": true, "sms": true, "slack": true, "webhook": true, "push": true,
+	"templates": true, "quiet_hours": true, "routes": true,
+}
+
+func needRestart(current, next *config.Config) []string {
+	var keys []string
+	for _, key := range config.Diff(current, next) {
+		section, _, _ := strings.Cut(key, ".")
+		if !reloadable[section] {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Builds the channels, templates, quiet hours and routes, returning an error
+// rather than exiting since a reload must leave the service running
+func newProviders(cfg *config.Config, logger *slog.Logger, secretsClient *secrets.Client, directoryClient *directory.Client, sandboxClient *sandbox.Client, notificationMetrics *metrics.Notifications) (*providers, error) {
+	ctx := context.Background()
+
+	// The SMTP server and SMS provider are what /readyz checks are reachable
+	emailOpts := &email.ClientOptions{
+		Logger:       logger,
+		FromAddress:  cfg.Email.From,
+		SMTPAddr:     cfg.Email.SMTPAddr,
+		SMTPUsername: cfg.Email.SMTPUsername,
+	}
+
+	smsOpts := &sms.ClientOptions{
+		Logger:      logger,
+		FromNumber:  cfg.SMS.From,
+		ProviderURL: cfg.SMS.ProviderURL,
+	}
+
+	// Only set when enabled, a nil *sandbox.Client would still be a non-nil Sandbox
+	if sandboxClient != nil {
+		emailOpts.Sandbox = sandboxClient
+		smsOpts.Sandbox = sandboxClient
+	}
+
+	// Email and SMS health checks read their credentials on every check, so
+	// they follow a rotation without waiting for the rebuild it triggers
+	if cfg.Email.SMTPPassword != "" {
+		password, err := secretsClient.Ref(ctx, cfg.Email.SMTPPassword)
+		if err != nil {
+			return nil, err
+		}
+		emailOpts.SMTPPassword = password
+	}
+
+	if cfg.SMS.APIToken != "" {
+		token, err := secretsClient.Ref(ctx, cfg.SMS.APIToken)
+		if err != nil {
+			return nil, err
+		}
+		smsOpts.APIToken = token
+	}
+
+	emailClient, err := email.New(emailOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	smsClient, err := sms.New(smsOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The rest take their credentials as they're built
+	slackToken, err := secretsClient.Resolve(ctx, cfg.Slack.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookSecret, err := secretsClient.Resolve(ctx, cfg.Webhook.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	pushToken, err := secretsClient.Resolve(ctx, cfg.Push.AuthToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Incoming-webhook URLs need no token, a bot token allows channel IDs
+	slackClient, err := slack.New(&slack.ClientOptions{
+		Logger: logger,
+		Token:  slackToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	channels := map[string]core.Channel{
+		core.ChannelEmail: core.EmailChannel(emailClient),
+		core.ChannelSMS:   core.SMSChannel(smsClient),
+	}
+
+	// Slack posts to incoming-webhook URLs without any config, so it has to
+	// be left out for the sandbox to send nothing. Config validation keeps
+	// webhooks and push turned off alongside it
+	if sandboxClient == nil {
+		channels[core.ChannelSlack] = core.SlackChannel(slackClient)
+	}
+
+	// Webhooks are only offered when there's a secret to sign them with
+	if secret := webhookSecret; secret != "" {
+		endpoints, err := webhookEndpoints(ctx, cfg, secretsClient)
+		if err != nil {
+			return nil, err
+		}
+
+		webhookClient, err := webhook.New(&webhook.ClientOptions{
+			Logger:     logger,
+			Secret:     secret,
+			Timeout:    cfg.Webhook.Timeout,
+			MaxRetries: 3,
+			Endpoints:  endpoints,
+
+			AllowedHosts:         strings.Split(cfg.Webhook.AllowedHosts, ","),
+			AllowPrivateNetworks: cfg.Webhook.AllowPrivate,
+
+			OnRetry: func(string) {
+				notificationMetrics.Retried(core.ChannelWebhook)
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		channels[core.ChannelWebhook] = core.WebhookChannel(webhookClient)
+	}
+
+	// The push provider is apns or fcm, with the rest of the push settings
+	// filling in whichever that provider needs
+	if provider := cfg.Push.Provider; provider != "" {
+		pushClient, err := push.New(&push.ClientOptions{
+			Logger:    logger,
+			Provider:  provider,
+			BaseURL:   cfg.Push.BaseURL,
+			AuthToken: pushToken,
+			Topic:     cfg.Push.Topic,
+			ProjectID: cfg.Push.ProjectID,
+			// Tokens the provider rejects are dropped from recipient profiles
+			OnInvalidToken: func(ctx context.Context, token string) {
+				if err := directoryClient.PruneAddress(ctx, core.ChannelPush, token); err != nil {
+					logger.ErrorContext(ctx, "Pruning device token failed", "error", err)
+				}
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		channels[core.ChannelPush] = core.PushChannel(pushClient)
+	}
+
+	templatesClient, err := templates.New(&templates.ClientOptions{
+		Logger:        logger,
+		Dir:           cfg.Templates.Dir,
+		DefaultLocale: cfg.Templates.DefaultLocale,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := routes(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &providers{
+		email: emailClient,
+		sms:   smsClient,
+
+		reload: &core.ReloadOptions{
+			Channels:   channels,
+			Templates:  templatesClient,
+			QuietHours: quietHours(cfg),
+			Routes:     routes,
+		},
+	}, nil
+}
+
+// Quiet hours are optional, a window of "21:00-08:00" turns them on and the
+// time zone sets the one used for recipients without their own, both were
+// checked when the config loaded
+func quietHours(cfg *config.Config) *core.QuietHours {
+	if cfg.QuietHours.Window == "" {
+		return nil
+	}
+
+	qh, _ := core.ParseQuietHours(cfg.QuietHours.Window)
+	if cfg.QuietHours.TimeZone != "" {
+		qh.Location, _ = time.LoadLocation(cfg.QuietHours.TimeZone)
+	}
+
+	return qh
+}
+
+// The webhook endpoints file is JSON keyed by URL, each endpoint's secret
+// can be a secret reference like any secret setting
+func webhookEndpoints(ctx context.Context, cfg *config.Config, secretsClient *secrets.Client) (map[string]webhook.Endpoint, error) {
+	if cfg.Webhook.EndpointsFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(cfg.Webhook.EndpointsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	endpoints, err := webhook.LoadEndpoints(f)
+	if err != nil {
+		return nil, fmt.Errorf("webhook endpoints: %w", err)
+	}
+
+	for url, endpoint := range endpoints {
+		if endpoint.Secret, err = secretsClient.Resolve(ctx, endpoint.Secret); err != nil {
+			return nil, err
+		}
+		endpoints[url] = endpoint
+	}
+
+	return endpoints, nil
+}
+
+// The routes file is JSON keyed by notification type, without it
+// everything goes by email, and SMS when there is a number
+func routes(cfg *config.Config) (map[string]*core.Route, error) {
+	if cfg.Routes.File == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(cfg.Routes.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return core.LoadRoutes(f)
+}
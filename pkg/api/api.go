@@ -0,0 +1,82 @@
+// api
+//
+// The types that go over the wire to and from the HTTP service, shared by pkg/http which
+// serves them and pkg/client which calls it so the two can't drift apart. Where core
+// already has the type it's an alias of it, which also lets code outside this module use
+// them, it can't import internal/core itself
+package api
+
+import (
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+type (
+	Task1Input  = core.Task1Input
+	Task1Output = core.Task1Output
+	Recipient   = core.Recipient
+	Suppression = core.Suppression
+
+	DryRunOutput = core.DryRunOutput
+	Delivery     = core.Delivery
+	Rendered     = core.Rendered
+
+	DeliveryError = core.DeliveryError
+	ChannelError  = core.ChannelError
+	InvalidError  = core.InvalidError
+)
+
+// The errors core returns, which pkg/client's errors match with errors.Is
+var (
+	ErrNotFound     = core.ErrNotFound
+	ErrSuppressed   = core.ErrSuppressed
+	ErrShuttingDown = core.ErrShuttingDown
+)
+
+// Sent with a POST so a retry of it is answered with the first response
+// rather than sending the notification again
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// Set on a response that's a replay of the first one sent under its key
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+// Set on a 500 from POST / when some of the route's channels failed, the
+// comma separated channels that did, any others may have been sent to
+const HeaderFailedChannels = "Failed-Channels"
+
+// Query parameter that makes POST / a dry run, answered with what would
+// be sent rather than sending it
+const QueryDryRun = "dry_run"
+
+// The most notifications one bulk request can carry
+const MaxBulk = 1000
+
+// Body of PATCH /v1/notifications/{id}
+type RescheduleInput struct {
+	SendAt time.Time `json:"send_at"`
+}
+
+// Body of PUT /v1/suppressions/{address}, the reason is optional
+type SuppressInput struct {
+	Reason string `json:"reason"`
+}
+
+// Body of POST /v1/bulk
+type BulkInput struct {
+	Notifications []*Task1Input `json:"notifications"`
+}
+
+// Answer to POST /v1/bulk, a result per notification in the order sent
+type BulkOutput struct {
+	Results []*BulkResult `json:"results"`
+}
+
+// Status is the code the notification would have got sent on its own,
+// ID and SendAt are only set when it was scheduled
+type BulkResult struct {
+	Status int       `json:"status"`
+	ID     string    `json:"id,omitempty"`
+	SendAt time.Time `json:"send_at"`
+	Error  string    `json:"error,omitempty"`
+}
@@ -0,0 +1,644 @@
+// batch
+//
+// Sends a notification for every row of a CSV or JSONL file, through core or the HTTP
+// service's SDK, so unlike the provider clients it works in core's own Task1Input. Each
+// row is written to a results file with how it went, in the same format with a few
+// columns added, so the results file can be fed straight back in and only the rows that
+// failed are sent again, to only the channels they failed on
+package batch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// Sends one notification, core and pkg/client both do
+type Sender interface {
+	Task1(context.Context, *core.Task1Input) (*core.Task1Output, error)
+}
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// The columns added to each row of the results, anything starting with
+// an underscore is ours and never read as a field or template data
+const (
+	ColumnRow    = "_row"
+	ColumnStatus = "_status"
+	ColumnID     = "_id"
+	ColumnError  = "_error"
+
+	// The channels a failed row failed on, comma separated, the rest of
+	// its route may have gone out so only these are sent to next time
+	ColumnFailedChannels = "_failed_channels"
+
+	// How many times the row has been sent, part of its idempotency key
+	ColumnAttempt = "_attempt"
+)
+
+// What became of a row, rows already sent or scheduled are skipped when
+// a results file is sent again
+const (
+	StatusSent      = "sent"
+	StatusScheduled = "scheduled"
+	StatusFailed    = "failed"
+)
+
+// The Task1Input fields a column can fill, recipients.<channel> also
+// addresses the named channel
+var Fields = []string{"to", "from", "number", "subject", "body", "user_id", "template", "locale", "type", "time_zone", "urgent", "send_at"}
+
+type Progress struct {
+	Total   int
+	Done    int
+	Failed  int
+	Skipped int
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	Sender Sender
+
+	// How many rows are sent at once, defaults to 4
+	Concurrency int
+
+	// Optional, the column each field is read from keyed by field, a
+	// column named after a field is used when it isn't mapped
+	Columns map[string]string
+
+	// Optional, the fields every row starts with before its columns
+	// are read, a template or type shared by the whole file
+	Defaults *core.Task1Input
+
+	// Optional, called after every row
+	OnProgress func(Progress)
+
+	// Optional, gives each send the idempotency key made from Source, the
+	// row and its attempt, so a row sent again after an interrupted run
+	// is answered rather than sent twice. client.WithIdempotencyKey
+	WithIdempotencyKey func(ctx context.Context, key string) context.Context
+
+	// Identifies the input in idempotency keys, its path
+	Source string
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	sender      Sender
+	concurrency int
+
+	columns  map[string]string
+	defaults *core.Task1Input
+
+	onProgress func(Progress)
+
+	withIdempotencyKey func(ctx context.Context, key string) context.Context
+	source             string
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "batch")
+	}
+
+	if opts.Sender == nil {
+		return nil, errors.New("sender missing")
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	for field := range opts.Columns {
+		if !isField(field) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %v or recipients.<channel>", field, strings.Join(Fields, ", "))
+		}
+	}
+
+	if opts.Defaults == nil {
+		opts.Defaults = &core.Task1Input{}
+	}
+
+	if opts.OnProgress == nil {
+		opts.OnProgress = func(Progress) {}
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		sender:      opts.Sender,
+		concurrency: opts.Concurrency,
+
+		columns:  opts.Columns,
+		defaults: opts.Defaults,
+
+		onProgress: opts.OnProgress,
+
+		withIdempotencyKey: opts.WithIdempotencyKey,
+		source:             opts.Source,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// FormatOf picks the format from a file's extension
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONL, nil
+	}
+
+	return "", fmt.Errorf("%v: expected a .csv or .jsonl file", path)
+}
+
+// One line of the file, with the columns in the order they were read so
+// the results keep them that way
+type row struct {
+	number  int
+	columns []string
+	values  map[string]any
+}
+
+// Run sends every row of in, writing each to results as it finishes. The
+// error is only for the files, rows that fail are counted in the progress
+func (c *Client) Run(ctx context.Context, in io.Reader, format string, results io.Writer) (Progress, error) {
+	rows, err := read(in, format)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	w, err := newWriter(results, format, rows)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	progress := Progress{Total: len(rows)}
+
+	var mu sync.Mutex
+	var writeErr error
+
+	// Each row is written the moment it's done so an interrupted run
+	// still records what it got through
+	finish := func(r *row, status, id string, failed []string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		progress.Done++
+		switch status {
+		case StatusFailed:
+			progress.Failed++
+		case "":
+			progress.Skipped++
+		}
+
+		if status != "" {
+			r.values[ColumnStatus], r.values[ColumnID], r.values[ColumnError] = status, id, ""
+			if err != nil {
+				r.values[ColumnError] = err.Error()
+			}
+			r.values[ColumnFailedChannels] = strings.Join(failed, ",")
+		}
+
+		if err := w.write(r); err != nil && writeErr == nil {
+			writeErr = err
+		}
+
+		c.onProgress(progress)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.concurrency)
+
+	for _, r := range rows {
+		// Already dealt with in an earlier run
+		if status := fmt.Sprint(r.values[ColumnStatus]); status == StatusSent || status == StatusScheduled {
+			finish(r, "", "", nil, nil)
+			continue
+		}
+
+		// Checked once there's a slot, the run may have been cancelled while
+		// waiting for one. Nothing was sent, so the channels it failed on
+		// before still stand
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			finish(r, StatusFailed, "", failedChannels(r), ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(r *row) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			status, id, failed, err := c.send(ctx, r)
+			finish(r, status, id, failed, err)
+		}(r)
+	}
+
+	wg.Wait()
+
+	if err := w.flush(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+
+	return progress, writeErr
+}
+
+// Sends the row, returning the channels it failed on when the route only
+// partly failed
+func (c *Client) send(ctx context.Context, r *row) (string, string, []string, error) {
+	in, err := c.input(r)
+	if err != nil {
+		return StatusFailed, "", failedChannels(r), err
+	}
+
+	// Counted before sending, a key is never used for two different sends
+	attempt, _ := strconv.Atoi(fmt.Sprint(r.values[ColumnAttempt]))
+	attempt++
+	r.values[ColumnAttempt] = attempt
+
+	if c.withIdempotencyKey != nil {
+		ctx = c.withIdempotencyKey(ctx, c.idempotencyKey(r, attempt))
+	}
+
+	output, err := c.sender.Task1(ctx, in)
+	if err != nil {
+		c.logger.ErrorContext(ctx, "Row failed", "row", r.number, "error", err)
+
+		// Any other error sent nothing, so what it failed on before stands
+		failed := failedChannels(r)
+
+		var deliveryErr *core.DeliveryError
+		if errors.As(err, &deliveryErr) {
+			failed = nil
+			for _, failure := range deliveryErr.Failures {
+				failed = append(failed, failure.Channel)
+			}
+		}
+
+		return StatusFailed, "", failed, err
+	}
+
+	if output != nil && output.ID != "" {
+		return StatusScheduled, output.ID, nil, nil
+	}
+
+	return StatusSent, "", nil, nil
+}
+
+// The same row and attempt always get the same key, a results file fed
+// back in keeps the row number it was first read with
+func (c *Client) idempotencyKey(r *row, attempt int) string {
+	number, ok := r.values[ColumnRow]
+	if !ok {
+		number = r.number
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%v\x00%v\x00%v", c.source, number, attempt)))
+	return fmt.Sprintf("batch-%x", sum[:16])
+}
+
+// The channels the row failed on in an earlier run, if it only partly failed
+func failedChannels(r *row) []string {
+	failed := fmt.Sprint(r.values[ColumnFailedChannels])
+	if r.values[ColumnFailedChannels] == nil || failed == "" {
+		return nil
+	}
+
+	return strings.Split(failed, ",")
+}
+
+// Builds the notification for a row, its mapped columns fill the fields
+// and every other column is template data
+func (c *Client) input(r *row) (*core.Task1Input, error) {
+	in := *c.defaults
+	in.Data = map[string]any{}
+	for k, v := range c.defaults.Data {
+		in.Data[k] = v
+	}
+	in.Recipients = map[string]string{}
+	for k, v := range c.defaults.Recipients {
+		in.Recipients[k] = v
+	}
+
+	mapped := map[string]bool{}
+	for _, column := range r.columns {
+		if strings.HasPrefix(column, "_") {
+			mapped[column] = true
+		}
+	}
+
+	fields := append(append([]string{}, Fields...), recipientFields(r.columns, c.columns)...)
+	for _, field := range fields {
+		column, ok := c.columns[field]
+		if !ok {
+			column = field
+		}
+
+		value, ok := r.values[column]
+		if !ok {
+			continue
+		}
+		mapped[column] = true
+
+		if err := set(&in, field, value); err != nil {
+			return nil, fmt.Errorf("column %v: %w", column, err)
+		}
+	}
+
+	for _, column := range r.columns {
+		if !mapped[column] {
+			in.Data[column] = r.values[column]
+		}
+	}
+
+	// What went out last time isn't sent again
+	in.Channels = failedChannels(r)
+
+	return &in, nil
+}
+
+// The recipients.<channel> fields this row could fill, from the mapping
+// and from columns named that way
+func recipientFields(columns []string, mapping map[string]string) []string {
+	seen := map[string]bool{}
+	for field := range mapping {
+		if strings.HasPrefix(field, "recipients.") {
+			seen[field] = true
+		}
+	}
+
+	for _, column := range columns {
+		if strings.HasPrefix(column, "recipients.") {
+			seen[column] = true
+		}
+	}
+
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+func isField(field string) bool {
+	if channel, ok := strings.CutPrefix(field, "recipients."); ok {
+		return channel != ""
+	}
+
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Empty values leave the field as it was, so a default isn't blanked out
+// by a row that doesn't have one
+func set(in *core.Task1Input, field string, value any) error {
+	if value == nil {
+		return nil
+	}
+
+	if field == "urgent" {
+		switch v := value.(type) {
+		case bool:
+			in.Urgent = v
+			return nil
+		case string:
+			if v == "" {
+				return nil
+			}
+			urgent, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			in.Urgent = urgent
+			return nil
+		}
+		return fmt.Errorf("urgent should be true or false, not %v", value)
+	}
+
+	s := fmt.Sprint(value)
+	if s == "" {
+		return nil
+	}
+
+	switch field {
+	case "to":
+		in.To = s
+	case "from":
+		in.From = s
+	case "number":
+		in.Number = s
+	case "subject":
+		in.Subject = s
+	case "body":
+		in.Body = s
+	case "user_id":
+		in.UserID = s
+	case "template":
+		in.Template = s
+	case "locale":
+		in.Locale = s
+	case "type":
+		in.Type = s
+	case "time_zone":
+		in.TimeZone = s
+	case "send_at":
+		at, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		in.SendAt = at
+	default:
+		in.Recipients[strings.TrimPrefix(field, "recipients.")] = s
+	}
+
+	return nil
+}
+
+func read(in io.Reader, format string) ([]*row, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(in)
+	case FormatJSONL:
+		return readJSONL(in)
+	}
+
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// The first line names the columns
+func readCSV(in io.Reader) ([]*row, error) {
+	r := csv.NewReader(in)
+
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*row
+	for number := 1; ; number++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]any, len(header))
+		for i, column := range header {
+			values[column] = record[i]
+		}
+
+		rows = append(rows, &row{number: number, columns: header, values: values})
+	}
+}
+
+// A JSON object a line, blank lines are skipped
+func readJSONL(in io.Reader) ([]*row, error) {
+	d := json.NewDecoder(in)
+	d.UseNumber()
+
+	var rows []*row
+	for number := 1; ; number++ {
+		var values map[string]any
+		err := d.Decode(&values)
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", number, err)
+		}
+
+		columns := make([]string, 0, len(values))
+		for column := range values {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		rows = append(rows, &row{number: number, columns: columns, values: values})
+	}
+}
+
+type writer interface {
+	write(*row) error
+	flush() error
+}
+
+func newWriter(out io.Writer, format string, rows []*row) (writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(out, rows)
+	case FormatJSONL:
+		return &jsonlWriter{encoder: json.NewEncoder(out)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// Writes the input's columns then ours, every row has the same ones
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func newCSVWriter(out io.Writer, rows []*row) (*csvWriter, error) {
+	var columns []string
+	if len(rows) > 0 {
+		for _, column := range rows[0].columns {
+			if !strings.HasPrefix(column, "_") {
+				columns = append(columns, column)
+			}
+		}
+	}
+	columns = append(columns, ColumnRow, ColumnStatus, ColumnID, ColumnError, ColumnFailedChannels, ColumnAttempt)
+
+	w := &csvWriter{w: csv.NewWriter(out), columns: columns}
+	if err := w.w.Write(columns); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (cw *csvWriter) write(r *row) error {
+	if _, ok := r.values[ColumnRow]; !ok {
+		r.values[ColumnRow] = r.number
+	}
+
+	record := make([]string, len(cw.columns))
+	for i, column := range cw.columns {
+		if v, ok := r.values[column]; ok && v != nil {
+			record[i] = fmt.Sprint(v)
+		}
+	}
+
+	if err := cw.w.Write(record); err != nil {
+		return err
+	}
+
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (jw *jsonlWriter) write(r *row) error {
+	if _, ok := r.values[ColumnRow]; !ok {
+		r.values[ColumnRow] = r.number
+	}
+
+	return jw.encoder.Encode(r.values)
+}
+
+func (jw *jsonlWriter) flush() error {
+	return nil
+}
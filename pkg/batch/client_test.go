@@ -0,0 +1,440 @@
+package batch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/batch"
+)
+
+var errMock = errors.New("mock error")
+
+type MockSender struct {
+	mu   sync.Mutex
+	sent []*core.Task1Input
+
+	Task1Mock func(context.Context, *core.Task1Input) (*core.Task1Output, error)
+}
+
+func (ms *MockSender) Task1(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+	ms.mu.Lock()
+	ms.sent = append(ms.sent, in)
+	ms.mu.Unlock()
+
+	if ms.Task1Mock == nil {
+		return &core.Task1Output{}, nil
+	}
+
+	return ms.Task1Mock(ctx, in)
+}
+
+// The sent notifications keyed by who they went to, rows are sent at
+// once so don't arrive in order
+func (ms *MockSender) byTo() map[string]*core.Task1Input {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sent := map[string]*core.Task1Input{}
+	for _, in := range ms.sent {
+		sent[in.To] = in
+	}
+
+	return sent
+}
+
+func readCSV(t *testing.T, b []byte) []map[string]string {
+	t.Helper()
+
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func TestNewClient(t *testing.T) {
+	if _, err := batch.New(&batch.ClientOptions{}); err == nil {
+		t.Error("a missing sender should be refused")
+	}
+
+	if _, err := batch.New(&batch.ClientOptions{
+		Sender:  &MockSender{},
+		Columns: map[string]string{"colour": "c"},
+	}); err == nil {
+		t.Error("an unknown field should be refused")
+	}
+
+	if _, err := batch.New(&batch.ClientOptions{
+		Sender:  &MockSender{},
+		Columns: map[string]string{"to": "email", "recipients.slack": "hook"},
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"rows.csv":     batch.FormatCSV,
+		"ROWS.CSV":     batch.FormatCSV,
+		"rows.jsonl":   batch.FormatJSONL,
+		"rows.ndjson":  batch.FormatJSONL,
+		"rows.results": "",
+	} {
+		got, err := batch.FormatOf(path)
+		if got != want || (want == "") != (err != nil) {
+			t.Errorf("%v: got %q, %v want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestRunCSV(t *testing.T) {
+	sender := &MockSender{
+		Task1Mock: func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+			switch in.To {
+			case "al@example.com":
+				return nil, errMock
+			case "jo@example.com":
+				return &core.Task1Output{ID: "abc", SendAt: in.SendAt}, nil
+			}
+			return &core.Task1Output{}, nil
+		},
+	}
+
+	var progress []batch.Progress
+	client := batch.Must(batch.New(&batch.ClientOptions{
+		Sender:      sender,
+		Concurrency: 2,
+		Columns:     map[string]string{"to": "email"},
+		Defaults:    &core.Task1Input{Template: "welcome", Type: "account"},
+		OnProgress:  func(p batch.Progress) { progress = append(progress, p) },
+	}))
+
+	in := "email,name,urgent,send_at\n" +
+		"sam@example.com,Sam,true,\n" +
+		"al@example.com,Al,,\n" +
+		"jo@example.com,Jo,,2030-01-01T09:00:00Z\n"
+
+	var results bytes.Buffer
+	got, err := client.Run(context.TODO(), strings.NewReader(in), batch.FormatCSV, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != (batch.Progress{Total: 3, Done: 3, Failed: 1}) {
+		t.Errorf("unexpected progress %+v", got)
+	}
+
+	if len(progress) != 3 || progress[2] != got {
+		t.Errorf("progress should be reported for every row, got %+v", progress)
+	}
+
+	t.Run("Mapping", func(t *testing.T) {
+		sent := sender.byTo()
+
+		sam := sent["sam@example.com"]
+		if sam == nil {
+			t.Fatal("sam wasn't sent to")
+		}
+
+		if sam.Template != "welcome" || sam.Type != "account" || !sam.Urgent {
+			t.Errorf("defaults or columns weren't applied %+v", sam)
+		}
+
+		if len(sam.Data) != 1 || sam.Data["name"] != "Sam" {
+			t.Errorf("only unmapped columns should be template data, got %v", sam.Data)
+		}
+
+		if jo := sent["jo@example.com"]; jo == nil || !jo.SendAt.Equal(time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)) {
+			t.Errorf("send_at wasn't read %+v", jo)
+		}
+	})
+
+	rows := readCSV(t, results.Bytes())
+
+	t.Run("Results", func(t *testing.T) {
+		if len(rows) != 3 {
+			t.Fatalf("expected a result per row, got %v", len(rows))
+		}
+
+		byRow := map[string]map[string]string{}
+		for _, row := range rows {
+			byRow[row[batch.ColumnRow]] = row
+		}
+
+		if row := byRow["1"]; row["email"] != "sam@example.com" || row[batch.ColumnStatus] != batch.StatusSent {
+			t.Errorf("unexpected result %v", row)
+		}
+
+		if row := byRow["2"]; row[batch.ColumnStatus] != batch.StatusFailed || row[batch.ColumnError] != errMock.Error() {
+			t.Errorf("unexpected result %v", row)
+		}
+
+		if row := byRow["3"]; row[batch.ColumnStatus] != batch.StatusScheduled || row[batch.ColumnID] != "abc" {
+			t.Errorf("unexpected result %v", row)
+		}
+	})
+
+	t.Run("Rerun", func(t *testing.T) {
+		retry := &MockSender{}
+		client := batch.Must(batch.New(&batch.ClientOptions{
+			Sender:  retry,
+			Columns: map[string]string{"to": "email"},
+		}))
+
+		var again bytes.Buffer
+		got, err := client.Run(context.TODO(), bytes.NewReader(results.Bytes()), batch.FormatCSV, &again)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != (batch.Progress{Total: 3, Done: 3, Skipped: 2}) {
+			t.Errorf("unexpected progress %+v", got)
+		}
+
+		sent := retry.byTo()
+		if len(sent) != 1 || sent["al@example.com"] == nil {
+			t.Errorf("only the failed row should be sent again, got %v", sent)
+		}
+
+		if data := sent["al@example.com"].Data; len(data) != 1 {
+			t.Errorf("result columns shouldn't be template data, got %v", data)
+		}
+
+		for _, row := range readCSV(t, again.Bytes()) {
+			if row[batch.ColumnStatus] == batch.StatusFailed {
+				t.Errorf("row %v should have been sent", row[batch.ColumnRow])
+			}
+			if row[batch.ColumnRow] == "3" && row[batch.ColumnID] != "abc" {
+				t.Errorf("a skipped row should keep its result, got %v", row)
+			}
+		}
+	})
+}
+
+func TestRunPartial(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	withKey := func(ctx context.Context, key string) context.Context {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, key)
+		return ctx
+	}
+
+	// The email goes, the SMS doesn't
+	sender := &MockSender{
+		Task1Mock: func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+			return nil, &core.DeliveryError{Failures: []core.ChannelError{{Channel: core.ChannelSMS, Err: errMock}}}
+		},
+	}
+
+	newClient := func(sender batch.Sender) *batch.Client {
+		return batch.Must(batch.New(&batch.ClientOptions{
+			Sender:             sender,
+			WithIdempotencyKey: withKey,
+			Source:             "people.csv",
+		}))
+	}
+
+	in := "to,number\nsam@example.com,0123456789\n"
+
+	var results bytes.Buffer
+	if _, err := newClient(sender).Run(context.TODO(), strings.NewReader(in), batch.FormatCSV, &results); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := readCSV(t, results.Bytes())
+	if len(rows) != 1 || rows[0][batch.ColumnFailedChannels] != core.ChannelSMS || rows[0][batch.ColumnAttempt] != "1" {
+		t.Fatalf("unexpected results %v", rows)
+	}
+
+	t.Run("SameKey", func(t *testing.T) {
+		// Running the same file again, as after an interrupted run, uses
+		// the same key so the service answers rather than sends
+		newClient(sender).Run(context.TODO(), strings.NewReader(in), batch.FormatCSV, &bytes.Buffer{})
+
+		if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+			t.Errorf("unexpected keys %v", keys)
+		}
+	})
+
+	t.Run("Rerun", func(t *testing.T) {
+		retry := &MockSender{}
+
+		var again bytes.Buffer
+		if _, err := newClient(retry).Run(context.TODO(), bytes.NewReader(results.Bytes()), batch.FormatCSV, &again); err != nil {
+			t.Fatal(err)
+		}
+
+		sam := retry.byTo()["sam@example.com"]
+		if sam == nil || len(sam.Channels) != 1 || sam.Channels[0] != core.ChannelSMS {
+			t.Fatalf("only the failed channel should be sent again, got %+v", sam)
+		}
+
+		// A new attempt is a new send, it mustn't be answered with the failure
+		if keys[len(keys)-1] == keys[0] {
+			t.Error("the rerun reused the first attempt's key")
+		}
+
+		rows := readCSV(t, again.Bytes())
+		if rows[0][batch.ColumnStatus] != batch.StatusSent || rows[0][batch.ColumnFailedChannels] != "" || rows[0][batch.ColumnAttempt] != "2" {
+			t.Errorf("unexpected results %v", rows)
+		}
+	})
+}
+
+// Cancelling part way still writes out every row, those it didn't get
+// to are failed so sending the results again picks them up
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sender := &MockSender{
+		Task1Mock: func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+			if in.To == "1@example.com" {
+				return &core.Task1Output{}, nil
+			}
+
+			// The second row is in flight when the run is cancelled
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	in := "to\n"
+	for i := 1; i <= 10; i++ {
+		in += fmt.Sprintf("%v@example.com\n", i)
+	}
+
+	client := batch.Must(batch.New(&batch.ClientOptions{Sender: sender, Concurrency: 1}))
+
+	var results bytes.Buffer
+	progress, err := client.Run(ctx, strings.NewReader(in), batch.FormatCSV, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if progress.Done != 10 || progress.Failed != 9 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+
+	rows := readCSV(t, results.Bytes())
+	if len(rows) != 10 {
+		t.Fatalf("%v rows in the results, want all 10", len(rows))
+	}
+
+	for _, row := range rows {
+		want := batch.StatusFailed
+		if row["to"] == "1@example.com" {
+			want = batch.StatusSent
+		}
+
+		if row[batch.ColumnStatus] != want {
+			t.Errorf("%v: status %q, want %q", row["to"], row[batch.ColumnStatus], want)
+		}
+	}
+
+	// Only the rows it got to were sent
+	if sent := len(sender.byTo()); sent != 2 {
+		t.Errorf("%v rows sent, want 2", sent)
+	}
+}
+
+func TestRunJSONL(t *testing.T) {
+	sender := &MockSender{}
+	client := batch.Must(batch.New(&batch.ClientOptions{Sender: sender}))
+
+	in := `{"to":"sam@example.com","template":"invoice","urgent":true,"total":12.5,"recipients.slack":"C123"}` + "\n\n" +
+		`{"to":"al@example.com","send_at":"tomorrow"}` + "\n"
+
+	var results bytes.Buffer
+	got, err := client.Run(context.TODO(), strings.NewReader(in), batch.FormatJSONL, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != (batch.Progress{Total: 2, Done: 2, Failed: 1}) {
+		t.Errorf("unexpected progress %+v", got)
+	}
+
+	sam := sender.byTo()["sam@example.com"]
+	if sam == nil || sam.Template != "invoice" || !sam.Urgent || sam.Recipients["slack"] != "C123" {
+		t.Fatalf("fields weren't read %+v", sam)
+	}
+
+	if total, ok := sam.Data["total"].(json.Number); !ok || total.String() != "12.5" {
+		t.Errorf("template data should keep its JSON value, got %#v", sam.Data["total"])
+	}
+
+	d := json.NewDecoder(&results)
+	for d.More() {
+		var row map[string]any
+		if err := d.Decode(&row); err != nil {
+			t.Fatal(err)
+		}
+
+		if row["to"] == "al@example.com" && (row[batch.ColumnStatus] != batch.StatusFailed || row[batch.ColumnError] == "") {
+			t.Errorf("a row that doesn't parse should fail without being sent, got %v", row)
+		}
+	}
+}
+
+func TestRunErr(t *testing.T) {
+	client := batch.Must(batch.New(&batch.ClientOptions{Sender: &MockSender{}}))
+
+	if _, err := client.Run(context.TODO(), strings.NewReader("a,b\n1\n"), batch.FormatCSV, &bytes.Buffer{}); err == nil {
+		t.Error("a short row should be an error")
+	}
+
+	if _, err := client.Run(context.TODO(), strings.NewReader("{"), batch.FormatJSONL, &bytes.Buffer{}); err == nil {
+		t.Error("broken JSON should be an error")
+	}
+
+	if _, err := client.Run(context.TODO(), strings.NewReader(""), "xml", &bytes.Buffer{}); err == nil {
+		t.Error("an unknown format should be an error")
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	batch.Must(&batch.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	batch.Must(&batch.Client{}, errMock)
+}
@@ -0,0 +1,438 @@
+// client
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, calling a running HTTP service, and is what other services
+// should import rather than hand rolling JSON. The methods are named after the core ones
+// they reach so anything written against core can be pointed at a remote service instead,
+// which is how the CLI's --server mode works. Requests that fail in a way that might not
+// the next time are retried, sends carry an Idempotency-Key so a retry is never a resend
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/api"
+)
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	HttpClient *http.Client
+
+	// Where the service is, https://notify.example.com
+	BaseURL string
+
+	// Optional, sent as a bearer token when the service needs one
+	APIKey string
+
+	// Attempts after the first, defaults to 3, -1 turns retries off.
+	// RetryBackoff doubles between each unless the service says how
+	// long to wait with Retry-After, and defaults to 500ms
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	httpClient *http.Client
+
+	baseURL string
+	apiKey  string
+
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "client")
+	}
+
+	if opts.HttpClient == nil {
+		opts.HttpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	if opts.BaseURL == "" {
+		return nil, errors.New("base url missing")
+	}
+
+	if _, err := url.Parse(opts.BaseURL); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.MaxRetries == 0:
+		opts.MaxRetries = 3
+	case opts.MaxRetries < 0:
+		opts.MaxRetries = 0
+	}
+
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		httpClient: opts.HttpClient,
+
+		baseURL: strings.TrimSuffix(opts.BaseURL, "/"),
+		apiKey:  opts.APIKey,
+
+		maxRetries:   opts.MaxRetries,
+		retryBackoff: opts.RetryBackoff,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Error is any response that wasn't a success, errors.Is matches it
+// against the api error the status stands for, so callers can check for
+// api.ErrNotFound, the same error core returns, whether core is local or not
+type Error struct {
+	StatusCode int
+	Message    string
+
+	// The channels a send failed on, when the service said which
+	FailedChannels []string
+
+	// The service answered with what it kept from an earlier request under
+	// the same Idempotency-Key, asking again gets the same answer
+	Replayed bool
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("service responded %v", http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("service responded %v: %v", http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return target == api.ErrNotFound
+	case http.StatusUnprocessableEntity:
+		return target == api.ErrSuppressed
+	case http.StatusServiceUnavailable:
+		return target == api.ErrShuttingDown
+	}
+
+	return false
+}
+
+// As gives a send that failed on some channels as the *api.DeliveryError
+// core would have returned, each failure carrying the service's message,
+// and a request the service turned away as invalid as an *api.InvalidError
+func (e *Error) As(target any) bool {
+	if invalidErr, ok := target.(**api.InvalidError); ok && e.StatusCode == http.StatusBadRequest {
+		*invalidErr = &api.InvalidError{Err: errors.New(e.Message)}
+		return true
+	}
+
+	deliveryErr, ok := target.(**api.DeliveryError)
+	if !ok || len(e.FailedChannels) == 0 {
+		return false
+	}
+
+	*deliveryErr = &api.DeliveryError{}
+	for _, channel := range e.FailedChannels {
+		(*deliveryErr).Failures = append((*deliveryErr).Failures, api.ChannelError{Channel: channel, Err: errors.New(e.Message)})
+	}
+
+	return true
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey sets the key the next send made with ctx carries,
+// for callers that retry themselves and need every attempt to match,
+// without it each send makes up its own
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// Task1 sends a notification, or schedules it when SendAt is in the future
+// in which case the output carries the ID to look it up by
+func (c *Client) Task1(ctx context.Context, in *api.Task1Input) (*api.Task1Output, error) {
+	var output api.Task1Output
+	if err := c.do(ctx, http.MethodPost, "/", in, &output); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// DryRun answers with what Task1 would send on each channel, rendered as
+// the providers would get it, without sending anything. It fails the way
+// Task1 would
+func (c *Client) DryRun(ctx context.Context, in *api.Task1Input) (*api.DryRunOutput, error) {
+	var output api.DryRunOutput
+	if err := c.do(ctx, http.MethodPost, "/?"+api.QueryDryRun+"=true", in, &output); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// Bulk sends up to api.MaxBulk notifications in one request, an error is
+// only returned if the request failed, how each notification went is in
+// its result
+func (c *Client) Bulk(ctx context.Context, in []*api.Task1Input) ([]*api.BulkResult, error) {
+	var output api.BulkOutput
+	if err := c.do(ctx, http.MethodPost, "/v1/bulk", &api.BulkInput{Notifications: in}, &output); err != nil {
+		return nil, err
+	}
+
+	return output.Results, nil
+}
+
+// Scheduled looks up a notification that's waiting to be sent
+func (c *Client) Scheduled(ctx context.Context, id string) (*api.Task1Output, error) {
+	var output api.Task1Output
+	if err := c.do(ctx, http.MethodGet, "/v1/notifications/"+url.PathEscape(id), nil, &output); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+// CancelScheduled stops a scheduled notification from being sent
+func (c *Client) CancelScheduled(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/notifications/"+url.PathEscape(id), nil, nil)
+}
+
+// Reschedule moves a scheduled notification to a new send time
+func (c *Client) Reschedule(ctx context.Context, id string, sendAt time.Time) error {
+	return c.do(ctx, http.MethodPatch, "/v1/notifications/"+url.PathEscape(id), &api.RescheduleInput{SendAt: sendAt}, nil)
+}
+
+// GetRecipient looks up a recipient by ID
+func (c *Client) GetRecipient(ctx context.Context, id string) (*api.Recipient, error) {
+	var recipient api.Recipient
+	if err := c.do(ctx, http.MethodGet, "/v1/recipients/"+url.PathEscape(id), nil, &recipient); err != nil {
+		return nil, err
+	}
+
+	return &recipient, nil
+}
+
+// ListRecipients returns everyone in the directory
+func (c *Client) ListRecipients(ctx context.Context) ([]*api.Recipient, error) {
+	var recipients []*api.Recipient
+	if err := c.do(ctx, http.MethodGet, "/v1/recipients", nil, &recipients); err != nil {
+		return nil, err
+	}
+
+	return recipients, nil
+}
+
+// PutRecipient creates or replaces a recipient
+func (c *Client) PutRecipient(ctx context.Context, recipient *api.Recipient) error {
+	return c.do(ctx, http.MethodPut, "/v1/recipients/"+url.PathEscape(recipient.ID), recipient, nil)
+}
+
+// DeleteRecipient removes a recipient
+func (c *Client) DeleteRecipient(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/recipients/"+url.PathEscape(id), nil, nil)
+}
+
+// Suppress stops anything being sent to the address
+func (c *Client) Suppress(ctx context.Context, address, reason string) error {
+	return c.do(ctx, http.MethodPut, "/v1/suppressions/"+url.PathEscape(address), &api.SuppressInput{Reason: reason}, nil)
+}
+
+// Unsuppress allows an address to be sent to again
+func (c *Client) Unsuppress(ctx context.Context, address string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/suppressions/"+url.PathEscape(address), nil, nil)
+}
+
+// ListSuppressions returns every suppressed address
+func (c *Client) ListSuppressions(ctx context.Context) ([]*api.Suppression, error) {
+	var suppressions []*api.Suppression
+	if err := c.do(ctx, http.MethodGet, "/v1/suppressions", nil, &suppressions); err != nil {
+		return nil, err
+	}
+
+	return suppressions, nil
+}
+
+// Sends in as JSON and decodes a JSON response into out, a response that
+// isn't JSON (the "Done" of an immediate send) leaves out as it was. Every
+// route is safe to retry, the POSTs only because of their Idempotency-Key
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var b []byte
+	if in != nil {
+		var err error
+		if b, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	var key string
+	if method == http.MethodPost {
+		key, _ = ctx.Value(idempotencyKey{}).(string)
+		if key == "" {
+			key = newKey()
+		}
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.attempt(ctx, method, path, b, key, out)
+		if err == nil || !retryable(err) || attempt >= c.maxRetries {
+			return err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+
+		c.logger.WarnContext(ctx, "Request failed, retrying", "method", method, "path", path, "backoff", wait, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// One go at the request, returning how long the service asked us to
+// wait before the next if it said
+func (c *Client) attempt(ctx context.Context, method, path string, b []byte, key string, out any) (time.Duration, error) {
+	var body io.Reader
+	if b != nil {
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return 0, &permanentError{err}
+	}
+
+	if b != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if key != "" {
+		req.Header.Set(api.HeaderIdempotencyKey, key)
+	}
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Our own deadline or cancellation isn't worth retrying
+		if ctx.Err() != nil {
+			return 0, &permanentError{err}
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		serviceErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+		if failed := resp.Header.Get(api.HeaderFailedChannels); failed != "" {
+			serviceErr.FailedChannels = strings.Split(failed, ",")
+		}
+		serviceErr.Replayed = resp.Header.Get(api.HeaderIdempotentReplayed) != ""
+
+		return parseRetryAfter(resp.Header.Get("Retry-After")), serviceErr
+	}
+
+	if out == nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return 0, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, &permanentError{err}
+	}
+
+	return 0, nil
+}
+
+// Failures that might go the other way next time, the service being busy
+// or briefly down and the network dropping the request. Anything else is
+// the service telling us the request is wrong, sending it again won't
+// change its mind, and neither will a replayed answer
+func retryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return !serviceErr.Replayed && (serviceErr.StatusCode == http.StatusTooManyRequests || serviceErr.StatusCode >= http.StatusInternalServerError)
+	}
+
+	return true
+}
+
+// Retry-After is either a number of seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+
+	return 0
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Random enough that two callers never pick the same one
+func newKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
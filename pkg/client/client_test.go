@@ -0,0 +1,437 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/api"
+	"github.com/B1scuit/example-pattern-service/pkg/client"
+)
+
+var errMock = errors.New("mock error")
+
+// Records what each request asked for and answers with whatever the
+// test sets, failing with Failures first when there are any
+type MockService struct {
+	Method, Path, Query, Auth, Body string
+
+	// The Idempotency-Key of every request, in order
+	Keys []string
+
+	Failures   []int
+	RetryAfter string
+
+	Status      int
+	ContentType string
+	Response    string
+}
+
+func (ms *MockService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	ms.Method, ms.Path, ms.Query, ms.Auth, ms.Body = r.Method, r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Get("Authorization"), string(b)
+	ms.Keys = append(ms.Keys, r.Header.Get(api.HeaderIdempotencyKey))
+
+	if len(ms.Failures) > 0 {
+		if ms.RetryAfter != "" {
+			w.Header().Set("Retry-After", ms.RetryAfter)
+		}
+		w.WriteHeader(ms.Failures[0])
+		ms.Failures = ms.Failures[1:]
+		return
+	}
+
+	if ms.ContentType != "" {
+		w.Header().Set("Content-Type", ms.ContentType)
+	}
+	w.WriteHeader(ms.Status)
+	fmt.Fprint(w, ms.Response)
+}
+
+func newClient(t *testing.T, service *MockService) *client.Client {
+	server := httptest.NewServer(service)
+	t.Cleanup(server.Close)
+
+	return client.Must(client.New(&client.ClientOptions{
+		BaseURL:      server.URL + "/",
+		APIKey:       "s3cret",
+		RetryBackoff: time.Millisecond,
+	}))
+}
+
+func TestNewMissingBaseURL(t *testing.T) {
+	if _, err := client.New(&client.ClientOptions{}); err == nil {
+		t.Error("error should have triggered")
+	}
+}
+
+func TestTask1(t *testing.T) {
+	service := &MockService{Status: http.StatusOK, Response: "Done\n"}
+	c := newClient(t, service)
+
+	t.Run("Sent", func(t *testing.T) {
+		output, err := c.Task1(context.TODO(), &api.Task1Input{To: "example@example.com"})
+		if err != nil || output.ID != "" {
+			t.Errorf("output %+v (%v)", output, err)
+		}
+
+		if service.Method != http.MethodPost || service.Path != "/" || service.Auth != "Bearer s3cret" {
+			t.Errorf("unexpected request %v %v %v", service.Method, service.Path, service.Auth)
+		}
+
+		var in api.Task1Input
+		if err := json.Unmarshal([]byte(service.Body), &in); err != nil || in.To != "example@example.com" {
+			t.Errorf("unexpected body %v", service.Body)
+		}
+	})
+
+	t.Run("Scheduled", func(t *testing.T) {
+		service.Status, service.ContentType = http.StatusAccepted, "application/json"
+		service.Response = `{"id": "abc", "send_at": "2030-01-01T09:00:00Z"}`
+
+		output, err := c.Task1(context.TODO(), &api.Task1Input{To: "example@example.com"})
+		if err != nil || output.ID != "abc" || !output.SendAt.Equal(time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)) {
+			t.Errorf("output %+v (%v)", output, err)
+		}
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		service.Status, service.ContentType = http.StatusOK, "application/json"
+		service.Response = `{"deliveries": [{"channel": "sms", "status": "send", "rendered": {"segments": 2, "encoding": "GSM-7"}}]}`
+
+		output, err := c.DryRun(context.TODO(), &api.Task1Input{Number: "0123456789"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if service.Path != "/" || service.Query != "dry_run=true" {
+			t.Errorf("unexpected request %v?%v", service.Path, service.Query)
+		}
+
+		if len(output.Deliveries) != 1 || output.Deliveries[0].Rendered.Segments != 2 {
+			t.Errorf("unexpected output %+v", output)
+		}
+	})
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, api.ErrNotFound},
+		{http.StatusUnprocessableEntity, api.ErrSuppressed},
+		{http.StatusServiceUnavailable, api.ErrShuttingDown},
+		{http.StatusInternalServerError, nil},
+	}
+
+	for _, tt := range tests {
+		service := &MockService{Status: tt.status, Response: "mock error"}
+
+		server := httptest.NewServer(service)
+		t.Cleanup(server.Close)
+
+		// Without retries, 500 and 503 are both worth another go
+		c := client.Must(client.New(&client.ClientOptions{
+			BaseURL:    server.URL,
+			MaxRetries: -1,
+		}))
+
+		_, err := c.Scheduled(context.TODO(), "abc")
+
+		var clientErr *client.Error
+		if !errors.As(err, &clientErr) || clientErr.StatusCode != tt.status || clientErr.Message != "mock error" {
+			t.Errorf("%v: unexpected error %v", tt.status, err)
+		}
+
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%v: %v should be %v", tt.status, err, tt.want)
+		}
+
+		if errors.Is(err, errMock) {
+			t.Errorf("%v: %v matched an unrelated error", tt.status, err)
+		}
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	service := &MockService{
+		Status:      http.StatusOK,
+		ContentType: "application/json",
+		Response:    `{"id": "a/b", "send_at": "2030-01-01T09:00:00Z"}`,
+	}
+	c := newClient(t, service)
+
+	if output, err := c.Scheduled(context.TODO(), "a/b"); err != nil || output.ID != "a/b" {
+		t.Errorf("output %+v (%v)", output, err)
+	}
+
+	// IDs are escaped rather than read as more path
+	if service.Path != "/v1/notifications/a%2Fb" {
+		t.Errorf("unexpected path %v", service.Path)
+	}
+
+	service.Status, service.ContentType, service.Response = http.StatusNoContent, "", ""
+
+	if err := c.CancelScheduled(context.TODO(), "abc"); err != nil || service.Method != http.MethodDelete {
+		t.Errorf("cancel %v %v", service.Method, err)
+	}
+
+	if err := c.Reschedule(context.TODO(), "abc", time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)); err != nil || service.Method != http.MethodPatch {
+		t.Errorf("reschedule %v %v", service.Method, err)
+	}
+
+	if service.Body != `{"send_at":"2030-01-01T09:00:00Z"}` {
+		t.Errorf("unexpected body %v", service.Body)
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	service := &MockService{Status: http.StatusNoContent}
+	c := newClient(t, service)
+
+	if err := c.Suppress(context.TODO(), "jo@example.com", "bounced"); err != nil {
+		t.Error(err)
+	}
+
+	if service.Method != http.MethodPut || service.Path != "/v1/suppressions/jo@example.com" || service.Body != `{"reason":"bounced"}` {
+		t.Errorf("unexpected request %v %v %v", service.Method, service.Path, service.Body)
+	}
+
+	if err := c.Unsuppress(context.TODO(), "jo@example.com"); err != nil || service.Method != http.MethodDelete {
+		t.Errorf("unsuppress %v %v", service.Method, err)
+	}
+
+	service.Status, service.ContentType = http.StatusOK, "application/json"
+	service.Response = `[{"address": "jo@example.com", "reason": "bounced"}]`
+
+	suppressions, err := c.ListSuppressions(context.TODO())
+	if err != nil || len(suppressions) != 1 || suppressions[0].Reason != "bounced" {
+		t.Errorf("unexpected suppressions %+v (%v)", suppressions, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	t.Run("Recovers", func(t *testing.T) {
+		service := &MockService{
+			Failures:    []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+			Status:      http.StatusAccepted,
+			ContentType: "application/json",
+			Response:    `{"id": "abc"}`,
+		}
+
+		output, err := newClient(t, service).Task1(context.TODO(), &api.Task1Input{To: "example@example.com"})
+		if err != nil || output.ID != "abc" {
+			t.Errorf("output %+v (%v)", output, err)
+		}
+
+		// Every attempt carries the same key so the service only sends once
+		if len(service.Keys) != 3 || service.Keys[0] == "" || service.Keys[0] != service.Keys[1] || service.Keys[1] != service.Keys[2] {
+			t.Errorf("unexpected keys %v", service.Keys)
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		service := &MockService{Failures: []int{500, 500, 500, 500, 500}, Status: http.StatusOK}
+
+		if _, err := newClient(t, service).Task1(context.TODO(), &api.Task1Input{}); err == nil {
+			t.Error("error should have been returned")
+		}
+
+		if len(service.Keys) != 4 {
+			t.Errorf("%v attempts, want 4", len(service.Keys))
+		}
+	})
+
+	t.Run("NotClientErrors", func(t *testing.T) {
+		service := &MockService{Failures: []int{http.StatusBadRequest}, Status: http.StatusOK}
+
+		if _, err := newClient(t, service).Task1(context.TODO(), &api.Task1Input{}); err == nil {
+			t.Error("error should have been returned")
+		}
+
+		if len(service.Keys) != 1 {
+			t.Errorf("%v attempts, a 400 shouldn't be retried", len(service.Keys))
+		}
+	})
+
+	t.Run("NotReplayed", func(t *testing.T) {
+		var attempts int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.Header().Set(api.HeaderIdempotentReplayed, "true")
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(server.Close)
+
+		c := client.Must(client.New(&client.ClientOptions{
+			BaseURL:      server.URL,
+			RetryBackoff: time.Millisecond,
+		}))
+
+		_, err := c.Task1(context.TODO(), &api.Task1Input{})
+
+		var clientErr *client.Error
+		if !errors.As(err, &clientErr) || !clientErr.Replayed {
+			t.Errorf("unexpected error %v", err)
+		}
+
+		if attempts != 1 {
+			t.Errorf("%v attempts, a replayed answer won't change", attempts)
+		}
+	})
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		service := &MockService{Failures: []int{http.StatusTooManyRequests}, RetryAfter: "1", Status: http.StatusNoContent}
+
+		start := time.Now()
+		if err := newClient(t, service).CancelScheduled(context.TODO(), "abc"); err != nil {
+			t.Error(err)
+		}
+
+		if took := time.Since(start); took < time.Second {
+			t.Errorf("retried after %v, the service asked for a second", took)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		service := &MockService{Failures: []int{500}, RetryAfter: "60", Status: http.StatusOK}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := newClient(t, service).CancelScheduled(ctx, "abc"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want the deadline", err)
+		}
+	})
+}
+
+func TestDeliveryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(api.HeaderFailedChannels, "sms,push")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "sms: mock error; push: mock error")
+	}))
+	t.Cleanup(server.Close)
+
+	c := client.Must(client.New(&client.ClientOptions{
+		BaseURL:    server.URL,
+		MaxRetries: -1,
+	}))
+
+	// Matched the way core's own would be, so callers don't care which they have
+	_, err := c.Task1(context.TODO(), &api.Task1Input{})
+
+	var deliveryErr *api.DeliveryError
+	if !errors.As(err, &deliveryErr) || len(deliveryErr.Failures) != 2 || deliveryErr.Failures[1].Channel != "push" {
+		t.Errorf("unexpected error %#v", err)
+	}
+
+	// Without the header there's nothing to say which channels failed
+	_, err = newClient(t, &MockService{Status: http.StatusInternalServerError}).Task1(context.TODO(), &api.Task1Input{})
+	if errors.As(err, &deliveryErr) {
+		t.Errorf("%v shouldn't be a delivery error", err)
+	}
+}
+
+func TestInvalidError(t *testing.T) {
+	_, err := newClient(t, &MockService{Status: http.StatusBadRequest, Response: "no address for any of email"}).Task1(context.TODO(), &api.Task1Input{})
+
+	var invalidErr *api.InvalidError
+	if !errors.As(err, &invalidErr) || invalidErr.Error() != "no address for any of email" {
+		t.Errorf("unexpected error %#v", err)
+	}
+
+	_, err = newClient(t, &MockService{Status: http.StatusConflict}).Task1(context.TODO(), &api.Task1Input{})
+	if errors.As(err, &invalidErr) || errors.Is(err, api.ErrSuppressed) {
+		t.Errorf("%v should only be a client error", err)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	service := &MockService{Status: http.StatusOK}
+	c := newClient(t, service)
+
+	c.Task1(context.TODO(), &api.Task1Input{})
+	c.Task1(context.TODO(), &api.Task1Input{})
+	c.Task1(client.WithIdempotencyKey(context.TODO(), "mine"), &api.Task1Input{})
+	c.ListSuppressions(context.TODO())
+
+	if len(service.Keys) != 4 || service.Keys[0] == service.Keys[1] || service.Keys[2] != "mine" || service.Keys[3] != "" {
+		t.Errorf("unexpected keys %v, each send wants its own and only sends want one", service.Keys)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	service := &MockService{
+		Status:      http.StatusOK,
+		ContentType: "application/json",
+		Response:    `{"results": [{"status": 200}, {"status": 422, "error": "every address is suppressed"}]}`,
+	}
+
+	results, err := newClient(t, service).Bulk(context.TODO(), []*api.Task1Input{{To: "a@example.com"}, {To: "b@example.com"}})
+	if err != nil || len(results) != 2 || results[1].Status != http.StatusUnprocessableEntity {
+		t.Errorf("unexpected results %+v (%v)", results, err)
+	}
+
+	var in api.BulkInput
+	if err := json.Unmarshal([]byte(service.Body), &in); err != nil || len(in.Notifications) != 2 || service.Path != "/v1/bulk" {
+		t.Errorf("unexpected request %v %v", service.Path, service.Body)
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	service := &MockService{
+		Status:      http.StatusOK,
+		ContentType: "application/json",
+		Response:    `{"id": "u1", "email": "jo@example.com"}`,
+	}
+	c := newClient(t, service)
+
+	if recipient, err := c.GetRecipient(context.TODO(), "u1"); err != nil || recipient.Email != "jo@example.com" || service.Path != "/v1/recipients/u1" {
+		t.Errorf("recipient %+v (%v)", recipient, err)
+	}
+
+	if err := c.PutRecipient(context.TODO(), &api.Recipient{ID: "u2"}); err != nil || service.Method != http.MethodPut || service.Path != "/v1/recipients/u2" {
+		t.Errorf("put %v %v (%v)", service.Method, service.Path, err)
+	}
+
+	if err := c.DeleteRecipient(context.TODO(), "u2"); err != nil || service.Method != http.MethodDelete {
+		t.Errorf("delete %v (%v)", service.Method, err)
+	}
+
+	service.Response = `[{"id": "u1"}]`
+	if recipients, err := c.ListRecipients(context.TODO()); err != nil || len(recipients) != 1 {
+		t.Errorf("recipients %+v (%v)", recipients, err)
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	client.Must(&client.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	client.Must(&client.Client{}, errMock)
+}
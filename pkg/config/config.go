@@ -0,0 +1,308 @@
+// config
+//
+// One typed configuration for both commands. Values are layered, each overriding the
+// last: the defaults here, then a TOML file, then environment variables, then flags.
+// Every setting is described once, by the tags on its field, which is where its file
+// key, env var and flag name all come from
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/B1scuit/example-pattern-service/pkg/push"
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
+	"github.com/B1scuit/example-pattern-service/pkg/secrets"
+)
+
+// The tags each setting takes:
+//
+//	config  the key within its [section] in the file, and the flag name as section-key
+//	env     the environment variable, optional
+//	flag    overrides the flag name, a "-" means no flag
+//	short   a one letter flag shorthand, optional
+//	secret  masked by Print, and the only settings that can hold a secret://
+//	        reference, resolved through the [secrets] backend
+//	usage   the flag help text
+type Config struct {
+	Log         Log         `config:"log"`
+	HTTP        HTTP        `config:"http"`
+	Email       Email       `config:"email"`
+	SMS         SMS         `config:"sms"`
+	Slack       Slack       `config:"slack"`
+	Webhook     Webhook     `config:"webhook"`
+	Push        Push        `config:"push"`
+	Scheduler   Scheduler   `config:"scheduler"`
+	Directory   Directory   `config:"directory"`
+	Suppression Suppression `config:"suppression"`
+	Templates   Templates   `config:"templates"`
+	QuietHours  QuietHours  `config:"quiet_hours"`
+	Routes      Routes      `config:"routes"`
+	Tracing     Tracing     `config:"tracing"`
+	Secrets     Secrets     `config:"secrets"`
+	Remote      Remote      `config:"remote"`
+	Sandbox     Sandbox     `config:"sandbox"`
+}
+
+type Log struct {
+	Format     string `config:"format" env:"LOG_FORMAT" usage:"Log format, text or json"`
+	Level      string `config:"level" env:"LOG_LEVEL" usage:"Lowest level logged, debug, info, warn or error"`
+	Redact     bool   `config:"redact" env:"REDACTION" usage:"Mask addresses and content in logs and error responses"`
+	RedactBody string `config:"redact_body" env:"REDACT_BODY" usage:"How redacted bodies are shown, hash, truncate or keep"`
+}
+
+type HTTP struct {
+	Addr         string        `config:"addr" env:"HTTP_ADDR" usage:"Address the HTTP service listens on"`
+	DrainTimeout time.Duration `config:"drain_timeout" env:"DRAIN_TIMEOUT" usage:"How long shutdown waits for in-flight work"`
+	ReadyGrace   time.Duration `config:"readiness_grace" env:"READINESS_GRACE" usage:"How long /readyz fails before shutdown, set longer than the readiness probe period"`
+	APIKey       string        `config:"api_key" env:"HTTP_API_KEY" secret:"true" flag:"-" usage:"Key callers must send as a bearer token, the API is open without it"`
+}
+
+type Email struct {
+	From     string `config:"from" env:"FROM_EMAIL_ADDRESS" flag:"from" short:"f" usage:"From email address (example@example.com)"`
+	SMTPAddr string `config:"smtp_addr" env:"SMTP_ADDR" usage:"SMTP server (host:port) readiness checks connect to"`
+
+	SMTPUsername string `config:"smtp_username" env:"SMTP_USERNAME" usage:"SMTP login, readiness checks log in when there's a password too"`
+	SMTPPassword string `config:"smtp_password" env:"SMTP_PASSWORD" secret:"true" flag:"-" usage:"SMTP password, usually a secret:// reference"`
+}
+
+type SMS struct {
+	From        string `config:"from" env:"FROM_SMS_NUMBER" flag:"fromnumber" short:"a" usage:"Mobile number to send SMS from (0123456789)"`
+	ProviderURL string `config:"provider_url" env:"SMS_PROVIDER_URL" usage:"URL on the SMS provider readiness checks request"`
+	APIToken    string `config:"api_token" env:"SMS_API_TOKEN" secret:"true" flag:"-" usage:"SMS provider API token, usually a secret:// reference"`
+}
+
+type Slack struct {
+	Token string `config:"token" env:"SLACK_TOKEN" secret:"true" flag:"-" usage:"Bot token, needed to post to channel IDs"`
+}
+
+type Webhook struct {
+	Secret       string `config:"secret" env:"WEBHOOK_SECRET" secret:"true" flag:"-" usage:"Signing secret, webhooks are only offered when set"`
+	AllowedHosts string `config:"allowed_hosts" env:"WEBHOOK_ALLOWED_HOSTS" usage:"Comma separated hosts webhooks may be sent to, any public host without it"`
+	AllowPrivate bool   `config:"allow_private" env:"WEBHOOK_ALLOW_PRIVATE" usage:"Allow webhooks to loopback and private addresses, for local development only"`
+
+	Timeout       time.Duration `config:"timeout" env:"WEBHOOK_TIMEOUT" usage:"How long one attempt may take, for endpoints without their own"`
+	EndpointsFile string        `config:"endpoints_file" env:"WEBHOOK_ENDPOINTS_FILE" usage:"JSON file of per-endpoint secrets and timeouts keyed by URL"`
+}
+
+type Push struct {
+	Provider  string `config:"provider" env:"PUSH_PROVIDER" usage:"Push provider, apns or fcm, push is only offered when set"`
+	BaseURL   string `config:"base_url" env:"PUSH_BASE_URL" usage:"Overrides the provider's API URL"`
+	AuthToken string `config:"auth_token" env:"PUSH_AUTH_TOKEN" secret:"true" flag:"-" usage:"Provider auth token"`
+	Topic     string `config:"apns_topic" env:"PUSH_APNS_TOPIC" usage:"APNs topic, the app's bundle ID"`
+	ProjectID string `config:"fcm_project_id" env:"PUSH_FCM_PROJECT_ID" usage:"FCM project ID"`
+}
+
+type Scheduler struct {
+	Dir        string `config:"dir" env:"SCHEDULER_DIR" flag:"scheduler-dir" usage:"Directory scheduled notifications are held in, shared between commands"`
+	MaxPending int    `config:"max_pending" env:"SCHEDULER_MAX_PENDING" usage:"Scheduled jobs waiting before the service reports not ready, 0 for no limit"`
+}
+
+type Directory struct {
+	Path string `config:"path" env:"DIRECTORY_PATH" usage:"JSON file recipient profiles are kept in"`
+}
+
+type Suppression struct {
+	File string `config:"file" env:"SUPPRESSION_FILE" usage:"JSON file of addresses nothing is sent to, shared between commands"`
+}
+
+type Templates struct {
+	Dir           string `config:"dir" env:"TEMPLATES_DIR" usage:"Directory of JSON template files"`
+	DefaultLocale string `config:"default_locale" env:"TEMPLATES_DEFAULT_LOCALE" usage:"Locale used when a recipient's has no template"`
+}
+
+type QuietHours struct {
+	Window   string `config:"window" env:"QUIET_HOURS" usage:"Daily window SMS is held back, 21:00-08:00"`
+	TimeZone string `config:"time_zone" env:"QUIET_HOURS_TIME_ZONE" usage:"Time zone for recipients without their own"`
+}
+
+type Routes struct {
+	File string `config:"file" env:"ROUTES_FILE" flag:"routes" usage:"JSON file of routes keyed by notification type"`
+}
+
+type Tracing struct {
+	OTLPEndpoint string `config:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" usage:"OpenTelemetry collector base URL, tracing is off without it"`
+	ServiceName  string `config:"service_name" env:"OTEL_SERVICE_NAME" usage:"Service name reported on spans"`
+}
+
+// Only read by the CLI, with a server set its commands go through the
+// HTTP service rather than sending from this machine
+type Remote struct {
+	Server string `config:"server" env:"REMOTE_SERVER" flag:"server" usage:"URL of the HTTP service the CLI sends through (https://notify.example.com)"`
+	APIKey string `config:"api_key" env:"REMOTE_API_KEY" flag:"api-key" secret:"true" usage:"API key for --server, REMOTE_API_KEY or a secret:// reference keeps it out of the process list"`
+}
+
+// For local development and QA, nothing is sent while it's enabled
+type Sandbox struct {
+	Enabled bool `config:"enabled" env:"SANDBOX" usage:"Keep emails and SMS in memory, browsable on /sandbox/, instead of sending them. Slack, webhooks and push are turned off"`
+	Limit   int  `config:"limit" env:"SANDBOX_LIMIT" usage:"Most messages the sandbox keeps, the oldest are dropped"`
+}
+
+// Where secret:// references are looked up
+type Secrets struct {
+	Backend         string        `config:"backend" env:"SECRETS_BACKEND" usage:"Where secrets are kept, file, env or encrypted"`
+	Dir             string        `config:"dir" env:"SECRETS_DIR" usage:"Directory of the file backend, one file per secret"`
+	EnvPrefix       string        `config:"env_prefix" env:"SECRETS_ENV_PREFIX" usage:"Prefix of the env backend's variables"`
+	File            string        `config:"file" env:"SECRETS_FILE" usage:"File the encrypted backend reads"`
+	Key             string        `config:"key" env:"SECRETS_KEY" secret:"true" flag:"-" usage:"Base64 key the encrypted file is sealed with"`
+	RefreshInterval time.Duration `config:"refresh_interval" env:"SECRETS_REFRESH_INTERVAL" usage:"How often secrets are fetched again to pick up rotation"`
+}
+
+// Open returns the backend the section describes
+func (s *Secrets) Open() (secrets.Backend, error) {
+	switch s.Backend {
+	case secrets.BackendFile:
+		return &secrets.FileBackend{Dir: s.Dir}, nil
+
+	case secrets.BackendEnv:
+		return &secrets.EnvBackend{Prefix: s.EnvPrefix}, nil
+
+	case secrets.BackendEncrypted:
+		if s.File == "" {
+			return nil, errors.New("the encrypted backend needs a file")
+		}
+
+		key, err := secrets.ParseKey(s.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &secrets.EncryptedFileBackend{Path: s.File, Key: key}, nil
+	}
+
+	return nil, fmt.Errorf("unknown backend %q", s.Backend)
+}
+
+// Default returns the configuration before anything is loaded over it
+func Default() *Config {
+	return &Config{
+		Log: Log{
+			Format:     logging.FormatText,
+			Level:      "info",
+			Redact:     true,
+			RedactBody: redact.BodyHash,
+		},
+		HTTP: HTTP{
+			Addr:         "127.0.0.1:8000",
+			DrainTimeout: 3 * time.Second,
+			ReadyGrace:   5 * time.Second,
+		},
+		Email: Email{
+			From: "noreply@company.com",
+		},
+		Tracing: Tracing{
+			ServiceName: "example-pattern-service",
+		},
+		Secrets: Secrets{
+			Backend:         secrets.BackendFile,
+			Dir:             secrets.DefaultDir,
+			EnvPrefix:       "SECRET_",
+			RefreshInterval: time.Minute,
+		},
+		Sandbox: Sandbox{
+			Limit: 1000,
+		},
+	}
+}
+
+// Validate checks every value that can be checked without side effects,
+// reporting all the problems at once rather than one per attempt
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Log.Format != logging.FormatText && c.Log.Format != logging.FormatJSON {
+		errs = append(errs, fmt.Errorf("log.format: unknown format %q", c.Log.Format))
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+
+	if _, err := redact.New(&redact.ClientOptions{Body: c.Log.RedactBody}); err != nil {
+		errs = append(errs, fmt.Errorf("log.redact_body: %w", err))
+	}
+
+	if c.HTTP.Addr == "" {
+		errs = append(errs, errors.New("http.addr: missing"))
+	}
+
+	if c.HTTP.DrainTimeout < 0 {
+		errs = append(errs, errors.New("http.drain_timeout: can't be negative"))
+	}
+
+	if c.HTTP.ReadyGrace < 0 {
+		errs = append(errs, errors.New("http.readiness_grace: can't be negative"))
+	}
+
+	if c.Push.Provider != "" && c.Push.Provider != push.ProviderAPNs && c.Push.Provider != push.ProviderFCM {
+		errs = append(errs, fmt.Errorf("push.provider: unknown provider %q", c.Push.Provider))
+	}
+
+	if c.Webhook.Timeout < 0 {
+		errs = append(errs, errors.New("webhook.timeout: can't be negative"))
+	}
+
+	if c.Scheduler.MaxPending < 0 {
+		errs = append(errs, errors.New("scheduler.max_pending: can't be negative"))
+	}
+
+	if c.Sandbox.Limit <= 0 {
+		errs = append(errs, errors.New("sandbox.limit: must be positive"))
+	}
+
+	// Only email and SMS can be kept by the sandbox, the rest would really send
+	if c.Sandbox.Enabled {
+		for _, other := range []struct {
+			key string
+			set bool
+		}{
+			{"slack.token", c.Slack.Token != ""},
+			{"webhook.secret", c.Webhook.Secret != ""},
+			{"push.provider", c.Push.Provider != ""},
+		} {
+			if other.set {
+				errs = append(errs, fmt.Errorf("sandbox.enabled: can't be used with %v set, only email and SMS are sandboxed", other.key))
+			}
+		}
+	}
+
+	if c.QuietHours.Window != "" {
+		if _, err := core.ParseQuietHours(c.QuietHours.Window); err != nil {
+			errs = append(errs, fmt.Errorf("quiet_hours.window: %w", err))
+		}
+	}
+
+	if c.QuietHours.TimeZone != "" {
+		if _, err := time.LoadLocation(c.QuietHours.TimeZone); err != nil {
+			errs = append(errs, fmt.Errorf("quiet_hours.time_zone: %w", err))
+		}
+	}
+
+	if c.Remote.Server != "" {
+		if u, err := url.Parse(c.Remote.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("remote.server: %q isn't an http or https URL", c.Remote.Server))
+		}
+	}
+
+	if _, err := c.Secrets.Open(); err != nil {
+		errs = append(errs, fmt.Errorf("secrets: %w", err))
+	}
+
+	if c.Secrets.RefreshInterval <= 0 {
+		errs = append(errs, errors.New("secrets.refresh_interval: must be positive"))
+	}
+
+	// Only secret settings are resolved, anywhere else a reference would be
+	// used as the literal text
+	for _, s := range fields(c) {
+		if !s.secret && secrets.IsRef(s.String()) {
+			errs = append(errs, fmt.Errorf("%v: only secret settings can reference secrets", s.key))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,233 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/config"
+	"github.com/spf13/pflag"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, err := config.Load(&config.LoadOptions{LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.HTTP.Addr != "127.0.0.1:8000" || cfg.HTTP.DrainTimeout != 3*time.Second {
+		t.Errorf("http defaults %+v", cfg.HTTP)
+	}
+
+	if cfg.Email.From != "noreply@company.com" || !cfg.Log.Redact {
+		t.Errorf("defaults %+v", cfg)
+	}
+
+	cfg, err = config.Load(&config.LoadOptions{
+		LookupEnv: env(nil),
+		Defaults:  func(cfg *config.Config) { cfg.Log.Format = "json" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Log.Format != "json" {
+		t.Errorf("format %q, want json", cfg.Log.Format)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+# Comments and blank lines are skipped
+[log]
+level = "debug"
+redact = false
+
+[http]
+addr = "0.0.0.0:9000" # trailing comments too
+drain_timeout = "10s"
+
+[email]
+from = 'file@example.com'
+smtp_addr = "smtp:25"
+
+[scheduler]
+max_pending = 50
+dir = "/var/file"
+`)
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	config.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--scheduler-dir", "/var/flag", "-f", "flag@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(&config.LoadOptions{
+		File: path,
+		LookupEnv: env(map[string]string{
+			"FROM_EMAIL_ADDRESS": "env@example.com",
+			"SCHEDULER_DIR":      "/var/env",
+			"SMTP_ADDR":          "smtp-env:25",
+			"REDACTION":          "on",
+		}),
+		Flags: fs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// From the file alone
+	if cfg.Log.Level != "debug" || cfg.HTTP.Addr != "0.0.0.0:9000" || cfg.HTTP.DrainTimeout != 10*time.Second || cfg.Scheduler.MaxPending != 50 {
+		t.Errorf("file values not loaded %+v", cfg)
+	}
+
+	// Env over the file
+	if cfg.Email.SMTPAddr != "smtp-env:25" || !cfg.Log.Redact {
+		t.Errorf("env didn't override the file %+v", cfg)
+	}
+
+	// Flags over env
+	if cfg.Email.From != "flag@example.com" || cfg.Scheduler.Dir != "/var/flag" {
+		t.Errorf("flags didn't override env %+v", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown setting":  "[email]\nreply_to = \"a@example.com\"\n",
+		"bad duration":     "[http]\ndrain_timeout = \"soon\"\n",
+		"bad number":       "[scheduler]\nmax_pending = lots\n",
+		"malformed string": "[email]\nfrom = \"a@example.com\n",
+		"unquoted string":  "[email]\nfrom = a@example.com\n",
+		"go escape":        "[email]\nfrom = \"a\\x00@example.com\"\n",
+		"short escape":     "[email]\nfrom = \"a\\u00\"\n",
+		"no value":         "[email]\nfrom\n",
+		"set twice":        "[email]\nfrom = \"a\"\nfrom = \"b\"\n",
+	}
+
+	for name, content := range tests {
+		path := writeFile(t, "config.toml", content)
+		if _, err := config.Load(&config.LoadOptions{File: path, LookupEnv: env(nil)}); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+
+	if _, err := config.Load(&config.LoadOptions{File: writeFile(t, "config.yaml", ""), LookupEnv: env(nil)}); err == nil {
+		t.Error("expected YAML to be refused")
+	}
+
+	if _, err := config.Load(&config.LoadOptions{File: "missing.toml", LookupEnv: env(nil)}); err == nil {
+		t.Error("expected a missing file to error")
+	}
+
+	if _, err := config.Load(&config.LoadOptions{LookupEnv: env(map[string]string{"REDACTION": "maybe"})}); err == nil {
+		t.Error("expected a bad bool to error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, err := config.Load(&config.LoadOptions{LookupEnv: env(map[string]string{
+		"LOG_FORMAT":      "xml",
+		"PUSH_PROVIDER":   "pager",
+		"QUIET_HOURS":     "late",
+		"REMOTE_SERVER":   "notify.example.com",
+		"SANDBOX_LIMIT":   "0",
+		"SANDBOX":         "true",
+		"WEBHOOK_TIMEOUT": "-1s",
+		"SLACK_TOKEN":     "xoxb-token",
+	})})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Every problem is reported at once
+	for _, want := range []string{"log.format", "push.provider", "quiet_hours.window", "remote.server", "sandbox.limit", "sandbox.enabled: can't be used with slack.token", "webhook.timeout"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %v", err, want)
+		}
+	}
+}
+
+func TestSecretRefs(t *testing.T) {
+	cfg, err := config.Load(&config.LoadOptions{LookupEnv: env(map[string]string{
+		"SMTP_PASSWORD":   "secret://smtp-password",
+		"SECRETS_BACKEND": "env",
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	config.Print(&buf, cfg)
+
+	// A reference says where the secret is, not what it is
+	if !strings.Contains(buf.String(), `smtp_password = "secret://smtp-password"`) {
+		t.Errorf("reference masked:\n%v", buf.String())
+	}
+
+	for name, vars := range map[string]map[string]string{
+		"reference in a plain setting": {"FROM_EMAIL_ADDRESS": "secret://from"},
+		"unknown backend":              {"SECRETS_BACKEND": "vault"},
+		"encrypted without a key":      {"SECRETS_BACKEND": "encrypted", "SECRETS_FILE": "secrets.enc"},
+	} {
+		if _, err := config.Load(&config.LoadOptions{LookupEnv: env(vars)}); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := config.Default()
+	cfg.Slack.Token = "xoxb-secret"
+	cfg.Email.From = "quote\"d\x00\a\t@example.com\u00e9"
+
+	var buf bytes.Buffer
+	if err := config.Print(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "xoxb-secret") || !strings.Contains(out, `token = "****"`) {
+		t.Errorf("secret not masked:\n%v", out)
+	}
+
+	// Empty secrets stay empty so it's clear they aren't set
+	if !strings.Contains(out, `secret = ""`) {
+		t.Errorf("empty secret masked:\n%v", out)
+	}
+
+	// Only escapes TOML has, not Go's \x00 or \a
+	if !strings.Contains(out, `from = "quote\"d\u0000\u0007\t@example.comé"`) {
+		t.Errorf("from not escaped the TOML way:\n%v", out)
+	}
+
+	// What's printed loads back to the same config, less the masked secret
+	path := writeFile(t, "config.toml", out)
+	loaded, err := config.Load(&config.LoadOptions{File: path, LookupEnv: env(nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Email.From != cfg.Email.From || loaded.HTTP != cfg.HTTP || loaded.Log != cfg.Log {
+		t.Errorf("round trip %+v, want %+v", loaded, cfg)
+	}
+}
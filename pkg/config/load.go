@@ -0,0 +1,278 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/secrets"
+	"github.com/spf13/pflag"
+)
+
+type LoadOptions struct {
+	// Optional, a TOML file layered over the defaults
+	File string
+
+	// Looks up environment variables, defaults to os.LookupEnv
+	LookupEnv func(string) (string, bool)
+
+	// Optional, flags registered with RegisterFlags, only the ones set on
+	// the command line are applied so they don't undo the layers beneath
+	Flags *pflag.FlagSet
+
+	// Optional, adjusts the defaults before anything is layered over them,
+	// the HTTP service logs JSON by default where the CLI logs text
+	Defaults func(*Config)
+}
+
+// Load builds the effective configuration and validates it
+func Load(opts *LoadOptions) (*Config, error) {
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+
+	cfg := Default()
+	if opts.Defaults != nil {
+		opts.Defaults(cfg)
+	}
+
+	settings := fields(cfg)
+
+	if opts.File != "" {
+		if err := loadFile(opts.File, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+
+		if raw, ok := opts.LookupEnv(s.env); ok && raw != "" {
+			if err := s.set(raw); err != nil {
+				return nil, fmt.Errorf("%v: %w", s.env, err)
+			}
+		}
+	}
+
+	if opts.Flags != nil {
+		for _, s := range settings {
+			if s.flag == "" || !opts.Flags.Changed(s.flag) {
+				continue
+			}
+
+			if err := s.set(opts.Flags.Lookup(s.flag).Value.String()); err != nil {
+				return nil, fmt.Errorf("--%v: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// RegisterFlags adds a flag for every setting that has one, the defaults
+// shown in help are the built in ones
+func RegisterFlags(fs *pflag.FlagSet) {
+	for _, s := range fields(Default()) {
+		if s.flag == "" {
+			continue
+		}
+
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolP(s.flag, s.short, s.value.Bool(), s.usage)
+			continue
+		}
+
+		fs.StringP(s.flag, s.short, s.String(), s.usage)
+	}
+}
+
+func loadFile(path string, settings []*setting) error {
+	if ext := filepath.Ext(path); ext != ".toml" {
+		return fmt.Errorf("config file %v: only .toml files are supported", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	values, err := parseTOML(f)
+	if err != nil {
+		return fmt.Errorf("config file %v: %w", path, err)
+	}
+
+	byKey := map[string]*setting{}
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+
+	for key, raw := range values {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config file %v: unknown setting %v", path, key)
+		}
+
+		if err := s.set(raw); err != nil {
+			return fmt.Errorf("config file %v: %v: %w", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+// One field of the config, found by walking the struct tags
+type setting struct {
+	key    string
+	env    string
+	flag   string
+	short  string
+	usage  string
+	secret bool
+
+	value reflect.Value
+}
+
+func fields(cfg *Config) []*setting {
+	var settings []*setting
+
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i).Tag.Get("config")
+		group := root.Field(i)
+
+		for j := 0; j < group.NumField(); j++ {
+			field := group.Type().Field(j)
+			name := field.Tag.Get("config")
+
+			s := &setting{
+				key:    section + "." + name,
+				env:    field.Tag.Get("env"),
+				flag:   field.Tag.Get("flag"),
+				short:  field.Tag.Get("short"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  group.Field(j),
+			}
+
+			switch s.flag {
+			case "":
+				s.flag = strings.ReplaceAll(section+"-"+name, "_", "-")
+			case "-":
+				s.flag = ""
+			}
+
+			settings = append(settings, s)
+		}
+	}
+
+	return settings
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (s *setting) set(raw string) error {
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(d))
+
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(raw)
+
+	case s.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q isn't a whole number", raw)
+		}
+		s.value.SetInt(int64(n))
+
+	case s.value.Kind() == reflect.Bool:
+		b, err := parseBool(raw)
+		if err != nil {
+			return err
+		}
+		s.value.SetBool(b)
+
+	default:
+		return fmt.Errorf("unsupported setting type %v", s.value.Type())
+	}
+
+	return nil
+}
+
+// Accepts on/off and yes/no as well, REDACTION=off reads better than =false
+func parseBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%q isn't true or false", raw)
+	}
+
+	return b, nil
+}
+
+func (s *setting) String() string {
+	if s.value.Type() == durationType {
+		return time.Duration(s.value.Int()).String()
+	}
+
+	return fmt.Sprint(s.value.Interface())
+}
+
+// Print writes the configuration as a TOML file, the same shape Load reads,
+// with secrets masked so the output is safe to paste into a ticket
+func Print(w io.Writer, cfg *Config) error {
+	section := ""
+
+	for _, s := range fields(cfg) {
+		name, key, _ := strings.Cut(s.key, ".")
+		if name != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "[%v]\n", name)
+			section = name
+		}
+
+		// References say where a secret is, not what it is, so they're shown
+		value := s.String()
+		if s.secret && value != "" && !secrets.IsRef(value) {
+			value = "****"
+		}
+
+		if kind := s.value.Kind(); kind == reflect.Bool || (kind == reflect.Int && s.value.Type() != durationType) {
+			_, err := fmt.Fprintf(w, "%v = %v\n", key, value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%v = %v\n", key, quote(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reads the small part of TOML a config file needs, [section] headers and
+// key = value pairs where the value is a string, number or boolean. Values
+// come back as the raw text keyed by "section.key", setting.set types them
+func parseTOML(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 || strings.TrimSpace(stripComment(line[end+1:])) != "" {
+				return nil, fmt.Errorf("line %v: malformed section header", n)
+			}
+			section = strings.TrimSpace(line[1:end])
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %v: expected key = value", n)
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("line %v: key missing", n)
+		}
+
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", n, err)
+		}
+
+		if section != "" {
+			key = section + "." + key
+		}
+
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %v: %v set twice", n, key)
+		}
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+func parseValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		// Find the closing quote, skipping escaped ones
+		end := -1
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '\\' {
+				i++
+				continue
+			}
+			if raw[i] == '"' {
+				end = i
+				break
+			}
+		}
+
+		if end < 0 || strings.TrimSpace(stripComment(raw[end+1:])) != "" {
+			return "", fmt.Errorf("malformed string %v", raw)
+		}
+
+		return unquote(raw[1:end])
+
+	case strings.HasPrefix(raw, "'"):
+		// Literal strings have no escapes at all
+		end := strings.Index(raw[1:], "'")
+		if end < 0 || strings.TrimSpace(stripComment(raw[end+2:])) != "" {
+			return "", fmt.Errorf("malformed string %v", raw)
+		}
+
+		return raw[1 : end+1], nil
+	}
+
+	// Numbers and booleans, which can't contain a #. Anything else is a
+	// string missing its quotes, which TOML doesn't allow
+	value := strings.TrimSpace(stripComment(raw))
+	if value == "" {
+		return "", fmt.Errorf("value missing")
+	}
+
+	if value != "true" && value != "false" {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", fmt.Errorf("%v isn't a number or boolean, strings need quotes", value)
+		}
+	}
+
+	return value, nil
+}
+
+// The escapes a TOML basic string can use, besides \uXXXX and \UXXXXXXXX
+var escapes = map[rune]rune{'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', '"': '"', '\\': '\\'}
+
+// Undoes the escapes in a basic string, without its quotes. Go's escapes
+// are a superset, so strconv.Unquote would take \x00 or \a a TOML reader won't
+func unquote(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if c < 0x20 && c != '\t' || c == 0x7f {
+			return "", fmt.Errorf("control character %q must be escaped", c)
+		}
+
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		if i++; i == len(s) {
+			return "", fmt.Errorf("string ends in a backslash")
+		}
+
+		if r, ok := escapes[rune(s[i])]; ok {
+			b.WriteRune(r)
+			continue
+		}
+
+		digits := 0
+		switch s[i] {
+		case 'u':
+			digits = 4
+		case 'U':
+			digits = 8
+		default:
+			return "", fmt.Errorf("invalid escape \\%c", s[i])
+		}
+
+		if i+digits >= len(s) {
+			return "", fmt.Errorf("short \\%c escape", s[i])
+		}
+
+		code, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return "", fmt.Errorf("invalid \\%c escape %v", s[i], s[i+1:i+1+digits])
+		}
+
+		b.WriteRune(rune(code))
+		i += digits
+	}
+
+	return b.String(), nil
+}
+
+// Writes s as a basic string, escaping only the way TOML allows. Anything
+// that isn't valid UTF-8 comes out as U+FFFD, TOML files can't hold it
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+
+	for _, r := range s {
+		switch r {
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+
+	b.WriteByte('"')
+	return b.String()
+}
+
+func stripComment(s string) string {
+	if i := strings.Index(s, "#"); i >= 0 {
+		return s[:i]
+	}
+
+	return s
+}
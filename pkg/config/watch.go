@@ -0,0 +1,243 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type WatcherOptions struct {
+	Logger *slog.Logger
+
+	// How the config is loaded again, the same options it was first loaded with
+	Load *LoadOptions
+
+	// The config already running, Apply is only called for ones after it
+	Current *Config
+
+	// Required, puts a new config into effect and returns the config now
+	// running, which is next less anything it couldn't change without a
+	// restart, see Keep. Returning an error leaves the old one in place so
+	// Apply should check everything before changing anything
+	Apply func(ctx context.Context, current, next *Config) (*Config, error)
+
+	// How often the files are checked for changes, defaults to 2 seconds
+	PollInterval time.Duration
+}
+
+// Watcher loads the config again on SIGHUP, or when the config file or a
+// file it points to changes, handing each new one that's valid to Apply
+type Watcher struct {
+	logger *slog.Logger
+
+	load  *LoadOptions
+	apply func(ctx context.Context, current, next *Config) (*Config, error)
+
+	pollInterval time.Duration
+
+	mu          sync.Mutex
+	current     *Config
+	fingerprint string
+}
+
+func NewWatcher(opts *WatcherOptions) (*Watcher, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "config")
+	}
+
+	if opts.Load == nil {
+		return nil, errors.New("load options missing")
+	}
+
+	if opts.Current == nil {
+		return nil, errors.New("current config missing")
+	}
+
+	if opts.Apply == nil {
+		return nil, errors.New("apply missing")
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+
+	return &Watcher{
+		logger: opts.Logger,
+
+		load:  opts.Load,
+		apply: opts.Apply,
+
+		pollInterval: opts.PollInterval,
+
+		current:     opts.Current,
+		fingerprint: fingerprint(opts.Load.File, opts.Current),
+	}, nil
+}
+
+// Forces a clean completion of NewWatcher() for initalisation
+func MustWatcher(watcher *Watcher, err error) *Watcher {
+	if err != nil {
+		panic(err)
+	}
+
+	return watcher
+}
+
+// Current returns the config last put into effect
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.current
+}
+
+// Run reloads on SIGHUP and file changes until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hup:
+			w.logger.InfoContext(ctx, "Reloading config", "reason", "SIGHUP")
+			w.Reload(ctx)
+
+		case <-ticker.C:
+			if w.changed() {
+				w.logger.InfoContext(ctx, "Reloading config", "reason", "file changed")
+				w.Reload(ctx)
+			}
+		}
+	}
+}
+
+// Reload loads the config and applies it, a config that doesn't load or
+// that Apply turns away is logged and the current one kept
+func (w *Watcher) Reload(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cfg, err := Load(w.load)
+	if err == nil {
+		cfg, err = w.apply(ctx, w.current, cfg)
+	}
+
+	if err != nil {
+		// The files have still been looked at, so the same broken edit
+		// isn't retried every poll
+		w.fingerprint = fingerprint(w.load.File, w.current)
+
+		w.logger.ErrorContext(ctx, "Config reload rejected, keeping the current config", "error", err)
+		return err
+	}
+
+	w.logger.InfoContext(ctx, "Config reloaded", "changed", Diff(w.current, cfg))
+	w.current = cfg
+	w.fingerprint = fingerprint(w.load.File, cfg)
+
+	return nil
+}
+
+func (w *Watcher) changed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return fingerprint(w.load.File, w.current) != w.fingerprint
+}
+
+// Files returns the files the config points to that are read at startup,
+// so changing them needs a reload just as changing the config does
+func (c *Config) Files() []string {
+	var files []string
+	for _, path := range []string{c.Templates.Dir, c.Routes.File} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+
+	return files
+}
+
+// Sums up the size and modification time of the config file and the files
+// it points to, directories are walked so editing a template counts
+func fingerprint(file string, cfg *Config) string {
+	paths := []string{file}
+	if cfg != nil {
+		paths = append(paths, cfg.Files()...)
+	}
+
+	var sum string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				sum += p + ":missing;"
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			sum += fmt.Sprintf("%v:%v:%v;", p, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+
+	return sum
+}
+
+// Diff returns the keys of every setting that differs between a and b
+func Diff(a, b *Config) []string {
+	var changed []string
+
+	before, after := fields(a), fields(b)
+	for i := range before {
+		if before[i].String() != after[i].String() {
+			changed = append(changed, before[i].key)
+		}
+	}
+
+	return changed
+}
+
+// Keep returns a copy of next with the settings named by keys as they are
+// in current, for an Apply that can only put part of next into effect
+func Keep(current, next *Config, keys []string) *Config {
+	kept := *next
+
+	keep := map[string]bool{}
+	for _, key := range keys {
+		keep[key] = true
+	}
+
+	from, into := fields(current), fields(&kept)
+	for i := range into {
+		if keep[into[i].key] {
+			into[i].value.Set(from[i].value)
+		}
+	}
+
+	return &kept
+}
@@ -0,0 +1,193 @@
+package config_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/config"
+)
+
+var errMock = errors.New("mock error")
+
+func TestNewWatcher(t *testing.T) {
+	apply := func(_ context.Context, _, next *config.Config) (*config.Config, error) { return next, nil }
+
+	for name, opts := range map[string]*config.WatcherOptions{
+		"load":    {Current: config.Default(), Apply: apply},
+		"current": {Load: &config.LoadOptions{}, Apply: apply},
+		"apply":   {Load: &config.LoadOptions{}, Current: config.Default()},
+	} {
+		if _, err := config.NewWatcher(opts); err == nil {
+			t.Errorf("expected an error without %v", name)
+		}
+	}
+}
+
+func TestMustWatcherPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	config.MustWatcher(nil, errMock)
+}
+
+func TestWatcherReload(t *testing.T) {
+	path := writeFile(t, "config.toml", "[email]\nfrom = \"a@example.com\"\n")
+	load := &config.LoadOptions{File: path, LookupEnv: env(nil)}
+
+	current, err := config.Load(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var applied []string
+	var applyErr error
+
+	watcher := config.MustWatcher(config.NewWatcher(&config.WatcherOptions{
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Load:    load,
+		Current: current,
+		Apply: func(ctx context.Context, current, next *config.Config) (*config.Config, error) {
+			applied = append(applied, next.Email.From)
+			return next, applyErr
+		},
+	}))
+
+	os.WriteFile(path, []byte("[email]\nfrom = \"b@example.com\"\n"), 0600)
+	if err := watcher.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if watcher.Current().Email.From != "b@example.com" {
+		t.Errorf("current from %q, want b@example.com", watcher.Current().Email.From)
+	}
+
+	// A config that doesn't load never reaches Apply
+	os.WriteFile(path, []byte("[email]\nfrom = \n"), 0600)
+	if err := watcher.Reload(context.Background()); err == nil {
+		t.Error("expected a broken file to be rejected")
+	}
+
+	// And one Apply turns away isn't kept
+	os.WriteFile(path, []byte("[email]\nfrom = \"c@example.com\"\n"), 0600)
+	applyErr = errMock
+	if err := watcher.Reload(context.Background()); !errors.Is(err, errMock) {
+		t.Errorf("expected %v, got %v", errMock, err)
+	}
+
+	if watcher.Current().Email.From != "b@example.com" {
+		t.Errorf("current from %q, want b@example.com kept", watcher.Current().Email.From)
+	}
+
+	if !reflect.DeepEqual(applied, []string{"b@example.com", "c@example.com"}) {
+		t.Errorf("applied %v", applied)
+	}
+}
+
+func TestWatcherKeep(t *testing.T) {
+	path := writeFile(t, "config.toml", "[email]\nfrom = \"a@example.com\"\n")
+	load := &config.LoadOptions{File: path, LookupEnv: env(nil)}
+
+	current, err := config.Load(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the email section can change without a restart here
+	watcher := config.MustWatcher(config.NewWatcher(&config.WatcherOptions{
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Load:    load,
+		Current: current,
+		Apply: func(ctx context.Context, current, next *config.Config) (*config.Config, error) {
+			return config.Keep(current, next, []string{"http.addr"}), nil
+		},
+	}))
+
+	os.WriteFile(path, []byte("[email]\nfrom = \"b@example.com\"\n[http]\naddr = \":9999\"\n"), 0600)
+	if err := watcher.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Current is what's running, not what the file says
+	if watcher.Current().Email.From != "b@example.com" || watcher.Current().HTTP.Addr != current.HTTP.Addr {
+		t.Errorf("current %+v %+v", watcher.Current().Email, watcher.Current().HTTP)
+	}
+
+	if diff := config.Diff(watcher.Current(), current); !reflect.DeepEqual(diff, []string{"email.from"}) {
+		t.Errorf("diff %v, want only email.from", diff)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	dir := t.TempDir()
+	templates := filepath.Join(dir, "templates")
+	os.Mkdir(templates, 0700)
+
+	path := writeFile(t, "config.toml", "[templates]\ndir = \""+filepath.ToSlash(templates)+"\"\n")
+	load := &config.LoadOptions{File: path, LookupEnv: env(nil)}
+
+	current, err := config.Load(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan struct{}, 10)
+	watcher := config.MustWatcher(config.NewWatcher(&config.WatcherOptions{
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Load:         load,
+		Current:      current,
+		PollInterval: 10 * time.Millisecond,
+		Apply: func(_ context.Context, _, next *config.Config) (*config.Config, error) {
+			reloads <- struct{}{}
+			return next, nil
+		},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watcher.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// A file the config points to changing counts, not just the config itself
+	os.WriteFile(filepath.Join(templates, "welcome.json"), []byte(`{}`), 0600)
+
+	select {
+	case <-reloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("template change didn't reload")
+	}
+
+	// Nothing more changed, so nothing more is reloaded
+	select {
+	case <-reloads:
+		t.Error("reloaded without a change")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, b := config.Default(), config.Default()
+	b.Slack.Token = "xoxb-secret"
+	b.HTTP.DrainTimeout = time.Minute
+
+	if diff := config.Diff(a, b); !reflect.DeepEqual(diff, []string{"http.drain_timeout", "slack.token"}) {
+		t.Errorf("diff %v", diff)
+	}
+}
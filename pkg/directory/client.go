@@ -0,0 +1,276 @@
+// directory
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, holding recipient profiles by user ID. Everything is kept in
+// memory, with an optional JSON file written on every change so profiles survive a restart.
+// Recipient mirrors core's field for field, so the service hands them across with a plain
+// conversion rather than this package knowing anything of core
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Recipient is a profile as it's stored, the JSON is the file format
+type Recipient struct {
+	ID       string `json:"id"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Locale   string `json:"locale"`
+	TimeZone string `json:"time_zone"`
+
+	// Addresses on any other channel keyed by channel name
+	Addresses map[string]string `json:"addresses"`
+
+	// The channels they've opted into, empty means every channel
+	Channels []string `json:"channels"`
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Optional, where the directory is persisted
+	Path string
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	path string
+
+	mu         sync.RWMutex
+	recipients map[string]*Recipient
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "directory")
+	}
+
+	recipients := map[string]*Recipient{}
+
+	if opts.Path != "" {
+		b, err := os.ReadFile(opts.Path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// First run, the file is created on the first write
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(b, &recipients); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		path: opts.Path,
+
+		recipients: recipients,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Get returns a copy of the recipient, nil if there isn't one
+func (c *Client) Get(ctx context.Context, id string) (*Recipient, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	recipient, ok := c.recipients[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return clone(recipient), nil
+}
+
+// List returns a copy of every recipient, sorted by ID
+func (c *Client) List(ctx context.Context) ([]*Recipient, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	recipients := make([]*Recipient, 0, len(c.recipients))
+	for _, recipient := range c.recipients {
+		recipients = append(recipients, clone(recipient))
+	}
+
+	sort.Slice(recipients, func(i, j int) bool {
+		return recipients[i].ID < recipients[j].ID
+	})
+
+	return recipients, nil
+}
+
+func (c *Client) Put(ctx context.Context, recipient *Recipient) error {
+	if recipient == nil || recipient.ID == "" {
+		return errors.New("recipient id missing")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, existed := c.recipients[recipient.ID]
+	c.recipients[recipient.ID] = clone(recipient)
+
+	// Put the old value back if it couldn't be saved, so memory and disk agree
+	if err := c.save(); err != nil {
+		if existed {
+			c.recipients[recipient.ID] = previous
+		} else {
+			delete(c.recipients, recipient.ID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) Delete(ctx context.Context, id string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, ok := c.recipients[id]
+	if !ok {
+		return false, nil
+	}
+
+	delete(c.recipients, id)
+
+	if err := c.save(); err != nil {
+		c.recipients[id] = previous
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PruneAddress removes address from the comma separated addresses every
+// recipient holds for the channel, used to drop push tokens the provider
+// has said are no longer valid
+func (c *Client) PruneAddress(ctx context.Context, channel, address string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Changed recipients are replaced by a pruned copy, the originals are
+	// kept to put back if it couldn't be saved, so memory and disk agree
+	previous := map[string]*Recipient{}
+	for id, recipient := range c.recipients {
+		current, ok := recipient.Addresses[channel]
+		if !ok {
+			continue
+		}
+
+		var kept []string
+		for _, a := range strings.Split(current, ",") {
+			if a = strings.TrimSpace(a); a != "" && a != address {
+				kept = append(kept, a)
+			}
+		}
+
+		if pruned := strings.Join(kept, ","); pruned != current {
+			previous[id] = recipient
+
+			updated := clone(recipient)
+			updated.Addresses[channel] = pruned
+			c.recipients[id] = updated
+		}
+	}
+
+	if len(previous) == 0 {
+		return nil
+	}
+
+	if err := c.save(); err != nil {
+		for id, recipient := range previous {
+			c.recipients[id] = recipient
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Check makes sure the directory the file lives in is still there and
+// writable, an in memory directory is always available
+func (c *Client) Check(ctx context.Context) error {
+	if c.path == "" {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".directory-check-*")
+	if err != nil {
+		return fmt.Errorf("directory store unavailable: %w", err)
+	}
+	tmp.Close()
+
+	return os.Remove(tmp.Name())
+}
+
+// Writes through a temp file and a rename so a crash never leaves half a
+// directory on disk, callers must hold the lock
+func (c *Client) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(c.recipients)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".directory-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Recipients are handed out and taken in as copies so nobody can change
+// one behind the lock's back
+func clone(r *Recipient) *Recipient {
+	copied := *r
+
+	if r.Addresses != nil {
+		copied.Addresses = make(map[string]string, len(r.Addresses))
+		for k, v := range r.Addresses {
+			copied.Addresses[k] = v
+		}
+	}
+
+	copied.Channels = append([]string(nil), r.Channels...)
+
+	return &copied
+}
@@ -0,0 +1,161 @@
+package directory_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/pkg/directory"
+)
+
+var errMock = errors.New("mock error")
+
+func TestNewClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "directory.json")
+
+	client, err := directory.New(&directory.ClientOptions{Path: path})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("Put", func(t *testing.T) {
+		recipient := &directory.Recipient{
+			ID:        "u1",
+			Email:     "example@example.com",
+			Addresses: map[string]string{"push": "token-1,token-2"},
+		}
+		if err := client.Put(context.TODO(), recipient); err != nil {
+			t.Error(err)
+		}
+
+		// Changing the caller's copy mustn't reach into the directory
+		recipient.Email = "changed@example.com"
+
+		got, _ := client.Get(context.TODO(), "u1")
+		if got == nil || got.Email != "example@example.com" {
+			t.Errorf("unexpected recipient %+v", got)
+		}
+	})
+
+	t.Run("MissingID", func(t *testing.T) {
+		if err := client.Put(context.TODO(), &directory.Recipient{}); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+
+	t.Run("PruneAddress", func(t *testing.T) {
+		if err := client.PruneAddress(context.TODO(), "push", "token-1"); err != nil {
+			t.Error(err)
+		}
+
+		got, _ := client.Get(context.TODO(), "u1")
+		if got.Addresses["push"] != "token-2" {
+			t.Errorf("unexpected push tokens %q", got.Addresses["push"])
+		}
+	})
+
+	t.Run("Persisted", func(t *testing.T) {
+		reopened := directory.Must(directory.New(&directory.ClientOptions{Path: path}))
+
+		recipients, err := reopened.List(context.TODO())
+		if err != nil || len(recipients) != 1 || recipients[0].Addresses["push"] != "token-2" {
+			t.Errorf("unexpected recipients %+v (%v)", recipients, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if found, err := client.Delete(context.TODO(), "u1"); err != nil || !found {
+			t.Errorf("found = %v, err = %v", found, err)
+		}
+
+		if found, _ := client.Delete(context.TODO(), "u1"); found {
+			t.Error("recipient should already be gone")
+		}
+
+		if got, _ := client.Get(context.TODO(), "u1"); got != nil {
+			t.Error("recipient should be gone")
+		}
+	})
+}
+
+func TestNewInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "directory.json")
+	os.WriteFile(path, []byte(`{`), 0o600)
+
+	if _, err := directory.New(&directory.ClientOptions{Path: path}); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestPruneAddressSaveFails(t *testing.T) {
+	dir := t.TempDir()
+
+	client := directory.Must(directory.New(&directory.ClientOptions{
+		Path: filepath.Join(dir, "directory.json"),
+	}))
+
+	if err := client.Put(context.TODO(), &directory.Recipient{ID: "u1", Addresses: map[string]string{"push": "token-1,token-2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Losing the directory the file lives in makes the save fail
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.PruneAddress(context.TODO(), "push", "token-1"); err == nil {
+		t.Error("error should have been returned")
+	}
+
+	if got, _ := client.Get(context.TODO(), "u1"); got.Addresses["push"] != "token-1,token-2" {
+		t.Errorf("the tokens should be as they were, got %q", got.Addresses["push"])
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	client := directory.Must(directory.New(&directory.ClientOptions{
+		Path: filepath.Join(dir, "directory.json"),
+	}))
+
+	if err := client.Check(context.TODO()); err != nil {
+		t.Error(err)
+	}
+
+	// Losing the directory the file lives in makes it unavailable
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Check(context.TODO()); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	directory.Must(&directory.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	directory.Must(&directory.Client{}, errMock)
+}
@@ -6,33 +6,82 @@
 package email
 
 import (
+	"bytes"
 	"context"
-	"log"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
 )
 
+// A credential that may be rotated while the client is running, read each
+// time it's needed rather than once, secrets.Secret is one
+type Secret interface {
+	Value(context.Context) (string, error)
+}
+
+// Somewhere to keep messages rather than send them, sandbox.Client is one
+type Sandbox interface {
+	Email(ctx context.Context, from, to, subject, body string, raw []byte) error
+}
+
 type ClientOptions struct {
-	StdLog *log.Logger
+	Logger *slog.Logger
 
 	FromAddress string
+
+	// Optional, the SMTP server (host:port) health checks connect to
+	SMTPAddr string
+
+	// Optional, when both are set health checks also log in to the SMTP server
+	SMTPUsername string
+	SMTPPassword Secret
+
+	// Optional, when set emails are kept there instead of being sent
+	Sandbox Sandbox
 }
 
 type Client struct {
-	stdLog *log.Logger
+	logger *slog.Logger
 
 	fromAddress string
+	smtpAddr    string
+
+	smtpUsername string
+	smtpPassword Secret
+
+	sandbox Sandbox
 }
 
 func New(opts *ClientOptions) (*Client, error) {
 
-	// If the logger was missed, assume a default
-	if opts.StdLog == nil {
-		opts.StdLog = log.New(os.Stdout, "email", 0)
+	// If the logger was missed, assume a default, recipients and content
+	// are masked so they don't end up sat in plain text in the logs
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+			ReplaceAttr: redact.Must(redact.New(&redact.ClientOptions{})).ReplaceAttr,
+		})).With("component", "email")
 	}
 
 	return &Client{
-		stdLog:      opts.StdLog,
+		logger:      opts.Logger,
 		fromAddress: opts.FromAddress,
+		smtpAddr:    opts.SMTPAddr,
+
+		smtpUsername: opts.SMTPUsername,
+		smtpPassword: opts.SMTPPassword,
+
+		sandbox: opts.Sandbox,
 	}, nil
 }
 
@@ -45,10 +94,127 @@ func Must(client *Client, err error) *Client {
 	return client
 }
 
+// Send doesn't talk to the SMTP server yet, so only Check uses the password
 func (c *Client) Send(ctx context.Context, to, subject, body string) error {
 
+	if c.sandbox != nil {
+		raw, err := c.MIME(to, subject, body)
+		if err != nil {
+			return err
+		}
+
+		return c.sandbox.Email(ctx, c.fromAddress, to, subject, body, raw)
+	}
+
 	// Complete steps to send message, for now, we can just log
-	c.stdLog.Printf("Sending email: To %v, From: %v, Subject: %v, Body: %v", to, c.fromAddress, subject, body)
+	c.logger.InfoContext(ctx, "Sending email", "to", to, "from", c.fromAddress, "subject", subject, "body", body)
+
+	return nil
+}
+
+// MIME builds the email as it would be handed to the SMTP server, the
+// dry run shows it so what a template renders to can be seen in full
+func (c *Client) MIME(to, subject, body string) ([]byte, error) {
+	recipients, err := mail.ParseAddressList(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to address: %w", err)
+	}
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%v: %v\r\n", name, value)
+	}
+
+	if c.fromAddress != "" {
+		header("From", c.fromAddress)
+	}
+
+	addresses := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		addresses[i] = recipient.String()
+	}
+	header("To", strings.Join(addresses, ", "))
+
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&b)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// Check connects to the SMTP server and waits for its greeting, without an
+// SMTP server configured there's nothing that can fail so it's always healthy
+func (c *Client) Check(ctx context.Context) error {
+	if c.smtpAddr == "" {
+		return nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.smtpAddr)
+	if err != nil {
+		return fmt.Errorf("smtp unreachable: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if c.smtpPassword != nil && c.smtpUsername != "" {
+		return c.checkAuth(ctx, conn)
+	}
+
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("smtp not ready: %w", err)
+	}
+
+	// Be polite and hang up properly
+	text.PrintfLine("QUIT")
 
 	return nil
 }
+
+// Logs in as well, so a rotated password that hasn't reached us yet shows up
+// as not ready. smtp.PlainAuth refuses to send the password unencrypted to
+// anything but localhost, so STARTTLS is used whenever it's offered
+func (c *Client) checkAuth(ctx context.Context, conn net.Conn) error {
+	password, err := c.smtpPassword.Value(ctx)
+	if err != nil {
+		return fmt.Errorf("smtp password: %w", err)
+	}
+
+	host, _, err := net.SplitHostPort(c.smtpAddr)
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("smtp not ready: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+
+	if err := client.Auth(smtp.PlainAuth("", c.smtpUsername, password, host)); err != nil {
+		return fmt.Errorf("smtp login failed: %w", err)
+	}
+
+	return client.Quit()
+}
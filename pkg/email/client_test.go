@@ -1,9 +1,20 @@
 package email_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/B1scuit/example-pattern-service/pkg/email"
 )
@@ -24,6 +35,219 @@ func TestNewClient(t *testing.T) {
 	})
 }
 
+type MockSandbox struct {
+	EmailMock func(context.Context, string, string, string, string, []byte) error
+}
+
+func (ms *MockSandbox) Email(ctx context.Context, from, to, subject, body string, raw []byte) error {
+	return ms.EmailMock(ctx, from, to, subject, body, raw)
+}
+
+func TestSandbox(t *testing.T) {
+	var kept []byte
+
+	client := email.Must(email.New(&email.ClientOptions{
+		FromAddress: "noreply@example.com",
+		Sandbox: &MockSandbox{
+			EmailMock: func(ctx context.Context, from, to, subject, body string, raw []byte) error {
+				if from != "noreply@example.com" || to != "jo@example.com" || subject != "Hi" || body != "Hello" {
+					t.Errorf("unexpected email %v %v %v %v", from, to, subject, body)
+				}
+				kept = raw
+				return nil
+			},
+		},
+	}))
+
+	if err := client.Send(context.TODO(), "jo@example.com", "Hi", "Hello"); err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Contains(kept, []byte("To: <jo@example.com>")) {
+		t.Errorf("the sandbox should be given the MIME, got %q", kept)
+	}
+
+	if err := client.Send(context.TODO(), "not an address", "Hi", "Hello"); err == nil {
+		t.Error("an email that can't be built should fail as sending it would")
+	}
+}
+
+func TestMIME(t *testing.T) {
+	client := email.Must(email.New(&email.ClientOptions{FromAddress: "noreply@example.com"}))
+
+	t.Run("Message", func(t *testing.T) {
+		raw, err := client.MIME("Jo <jo@example.com>, al@example.com", "Café open", "Hello Jo, = is encoded")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := msg.Header.Get("From"); got != "noreply@example.com" {
+			t.Errorf("unexpected from %q", got)
+		}
+
+		if got := msg.Header.Get("To"); got != `"Jo" <jo@example.com>, <al@example.com>` {
+			t.Errorf("unexpected to %q", got)
+		}
+
+		if subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); err != nil || subject != "Café open" {
+			t.Errorf("unexpected subject %q, %v", subject, err)
+		}
+
+		body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		if err != nil || string(body) != "Hello Jo, = is encoded" {
+			t.Errorf("unexpected body %q, %v", body, err)
+		}
+	})
+
+	t.Run("InvalidTo", func(t *testing.T) {
+		if _, err := client.MIME("not an address", "", ""); err == nil {
+			t.Error("an invalid address should be an error")
+		}
+	})
+}
+
+func TestCheck(t *testing.T) {
+	// A listener that greets like an SMTP server would
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, "220 localhost ESMTP ready\r\n")
+			conn.Close()
+		}
+	}()
+
+	tests := map[string]struct {
+		addr    string
+		healthy bool
+	}{
+		"not configured": {"", true},
+		"reachable":      {listener.Addr().String(), true},
+		"unreachable":    {"127.0.0.1:1", false},
+	}
+
+	for name, tt := range tests {
+		client := email.Must(email.New(&email.ClientOptions{SMTPAddr: tt.addr}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := client.Check(ctx)
+		cancel()
+
+		if (err == nil) != tt.healthy {
+			t.Errorf("%v: unexpected result %v", name, err)
+		}
+	}
+}
+
+// A credential the tests can change, as a rotation would
+type MockSecret struct {
+	ValueMock func(context.Context) (string, error)
+}
+
+func (ms *MockSecret) Value(ctx context.Context) (string, error) {
+	return ms.ValueMock(ctx)
+}
+
+func TestCheckAuth(t *testing.T) {
+	// A listener that accepts a single username and password
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	want := base64.StdEncoding.EncodeToString([]byte("\x00user\x00hunter2"))
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				text.PrintfLine("220 localhost ESMTP ready")
+
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+
+					switch {
+					case strings.HasPrefix(line, "EHLO"):
+						text.PrintfLine("250-localhost")
+						text.PrintfLine("250 AUTH PLAIN")
+					case line == "AUTH PLAIN "+want:
+						text.PrintfLine("235 Authenticated")
+					case strings.HasPrefix(line, "AUTH"):
+						text.PrintfLine("535 Authentication failed")
+					case line == "QUIT":
+						text.PrintfLine("221 Bye")
+						return
+					default:
+						text.PrintfLine("502 Not implemented")
+					}
+				}
+			}()
+		}
+	}()
+
+	password := "hunter2"
+	var passwordErr error
+
+	client := email.Must(email.New(&email.ClientOptions{
+		SMTPAddr:     listener.Addr().String(),
+		SMTPUsername: "user",
+		SMTPPassword: &MockSecret{
+			ValueMock: func(context.Context) (string, error) {
+				return password, passwordErr
+			},
+		},
+	}))
+
+	check := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return client.Check(ctx)
+	}
+
+	if err := check(); err != nil {
+		t.Errorf("expected healthy, got %v", err)
+	}
+
+	// The password is read every time, so a rotation is noticed
+	password = "stale"
+	if err := check(); err == nil {
+		t.Error("expected the wrong password to be unhealthy")
+	}
+
+	passwordErr = errMock
+	if err := check(); !errors.Is(err, errMock) {
+		t.Errorf("expected %v, got %v", errMock, err)
+	}
+
+	// Sending doesn't use the password, so it isn't held up by it
+	if err := client.Send(context.Background(), "john@example.com", "", ""); err != nil {
+		t.Errorf("expected send to ignore the password, got %v", err)
+	}
+}
+
 func TestMustClean(t *testing.T) {
 	// This deferal function allows for the testing
 	//of panics as it blocks the os.Exit using recover()
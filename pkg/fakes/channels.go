@@ -0,0 +1,62 @@
+package fakes
+
+import (
+	"context"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// Email fakes core.EmailService, what email.Client does
+type Email struct {
+	Recorder[Message]
+}
+
+func (e *Email) Send(ctx context.Context, to, subject, body string) error {
+	return e.record(ctx, Message{To: to, Subject: subject, Body: body})
+}
+
+// SMS fakes core.SMSService, what sms.Client does, the subject is always empty
+type SMS struct {
+	Recorder[Message]
+}
+
+func (s *SMS) Send(ctx context.Context, to, body string) error {
+	return s.record(ctx, Message{To: to, Body: body})
+}
+
+// Webhook fakes core.WebhookService, To is the endpoint URL
+type Webhook struct {
+	Recorder[Message]
+}
+
+func (w *Webhook) Send(ctx context.Context, url, subject, body string) error {
+	return w.record(ctx, Message{To: url, Subject: subject, Body: body})
+}
+
+// Slack fakes core.SlackService, To is the webhook URL or channel ID
+type Slack struct {
+	Recorder[Message]
+}
+
+func (s *Slack) Send(ctx context.Context, to, subject, body string) error {
+	return s.record(ctx, Message{To: to, Subject: subject, Body: body})
+}
+
+// Push fakes core.PushService, To is the device tokens
+type Push struct {
+	Recorder[Message]
+}
+
+func (p *Push) Send(ctx context.Context, tokens, title, body string) error {
+	return p.record(ctx, Message{To: tokens, Subject: title, Body: body})
+}
+
+// Channel fakes a core.Channel, for registering channels core has no
+// service interface for
+type Channel struct {
+	Recorder[Message]
+}
+
+func (c *Channel) Send(ctx context.Context, msg *core.Message) error {
+	return c.record(ctx, *msg)
+}
@@ -0,0 +1,141 @@
+package fakes
+
+import (
+	"context"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+type CoreOptions struct {
+	// Optional, passed through to core
+	Routes     map[string]*Route
+	QuietHours *QuietHours
+
+	// Optional, already holding what the test needs
+	Directory    *Directory
+	Templates    *Templates
+	Suppressions *Suppressions
+
+	// Allows the passing of time to be controlled in tests, core and
+	// RunDue both use it
+	Now func() time.Time
+}
+
+// Core is a real core.Client with a fake behind every interface, so a test
+// goes through the same routing, quiet hours and suppression rules as the
+// service and then looks at what each fake was asked to do
+type Core struct {
+	*core.Client
+
+	Email   *Email
+	SMS     *SMS
+	Webhook *Webhook
+	Slack   *Slack
+	Push    *Push
+
+	Directory    *Directory
+	Templates    *Templates
+	Scheduler    *Scheduler
+	Suppressions *Suppressions
+
+	Metrics *Metrics
+	Tracer  *Tracer
+
+	now func() time.Time
+}
+
+func NewCore(opts *CoreOptions) (*Core, error) {
+
+	if opts.Directory == nil {
+		opts.Directory = &Directory{}
+	}
+
+	if opts.Templates == nil {
+		opts.Templates = &Templates{}
+	}
+
+	if opts.Suppressions == nil {
+		opts.Suppressions = &Suppressions{Now: opts.Now}
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	c := &Core{
+		Email:   &Email{},
+		SMS:     &SMS{},
+		Webhook: &Webhook{},
+		Slack:   &Slack{},
+		Push:    &Push{},
+
+		Directory:    opts.Directory,
+		Templates:    opts.Templates,
+		Scheduler:    &Scheduler{},
+		Suppressions: opts.Suppressions,
+
+		Metrics: &Metrics{},
+		Tracer:  &Tracer{},
+
+		now: opts.Now,
+	}
+
+	client, err := core.New(&core.ClientOptions{
+		Channels: map[string]core.Channel{
+			core.ChannelEmail:   core.EmailChannel(c.Email),
+			core.ChannelSMS:     core.SMSChannel(c.SMS),
+			core.ChannelWebhook: core.WebhookChannel(c.Webhook),
+			core.ChannelSlack:   core.SlackChannel(c.Slack),
+			core.ChannelPush:    core.PushChannel(c.Push),
+		},
+		Directory:    c.Directory,
+		Templates:    c.Templates,
+		Scheduler:    c.Scheduler,
+		QuietHours:   opts.QuietHours,
+		Routes:       opts.Routes,
+		Suppressions: c.Suppressions,
+		Metrics:      c.Metrics,
+		Tracer:       c.Tracer,
+		Now:          opts.Now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.Client = client
+
+	return c, nil
+}
+
+// Forces a clean completion of NewCore() for initalisation
+func Must(c *Core, err error) *Core {
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// RunDue delivers every scheduled or deferred notification due by now,
+// move Now on first to let quiet hours end
+func (c *Core) RunDue(ctx context.Context) error {
+	return c.Scheduler.RunDue(ctx, c.now(), c.Client.RunScheduled)
+}
+
+// Reset forgets every call made to the fakes, leaving what they hold
+func (c *Core) Reset() {
+	c.Email.Reset()
+	c.SMS.Reset()
+	c.Webhook.Reset()
+	c.Slack.Reset()
+	c.Push.Reset()
+
+	c.Directory.Reset()
+	c.Templates.Reset()
+	c.Scheduler.Reset()
+	c.Suppressions.Reset()
+
+	c.Metrics.Reset()
+	c.Tracer.Reset()
+}
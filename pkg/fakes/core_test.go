@@ -0,0 +1,150 @@
+package fakes_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/fakes"
+)
+
+func TestNewCore(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	directory := &fakes.Directory{}
+	directory.Add(&fakes.Recipient{ID: "jo", Email: "jo@example.com", Phone: "0123456789", Locale: "fr-FR", TimeZone: "Asia/Tokyo"})
+
+	c := fakes.Must(fakes.NewCore(&fakes.CoreOptions{
+		Directory: directory,
+		Templates: &fakes.Templates{Templates: map[string]fakes.Template{
+			"welcome.fr-FR": {Subject: "Bienvenue", Body: "Salut {{.name}}"},
+		}},
+		QuietHours: &fakes.QuietHours{Start: 21 * time.Hour, End: 8 * time.Hour},
+		Routes: map[string]*fakes.Route{
+			"fallback": {Mode: core.RouteFirstSuccess, Channels: []string{core.ChannelSMS, core.ChannelEmail}},
+		},
+		Now: func() time.Time { return now },
+	}))
+
+	t.Run("Sent", func(t *testing.T) {
+		defer c.Reset()
+
+		if _, err := c.Task1(context.TODO(), &core.Task1Input{UserID: "jo", Template: "welcome", Data: map[string]any{"name": "Jo"}, Urgent: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		c.Email.AssertLast(t, fakes.Message{To: "jo@example.com", Subject: "Bienvenue", Body: "Salut Jo"})
+		c.SMS.AssertLast(t, fakes.Message{To: "0123456789", Body: "Salut Jo"})
+		c.Metrics.AssertCount(t, 2)
+
+		if len(c.Tracer.Named("core.Task1")) != 1 {
+			t.Errorf("expected a core.Task1 span, got %+v", c.Tracer.Calls())
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		defer c.Reset()
+
+		c.SMS.FailOn(1, errMock)
+
+		if _, err := c.Task1(context.TODO(), &core.Task1Input{Type: "fallback", To: "al@example.com", Number: "0123456789"}); err != nil {
+			t.Fatal(err)
+		}
+
+		c.SMS.AssertCount(t, 1)
+		c.Email.AssertCount(t, 1)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		defer c.Reset()
+
+		c.Email.FailAlways(errMock)
+
+		var deliveryErr *core.DeliveryError
+		if _, err := c.Task1(context.TODO(), &core.Task1Input{To: "al@example.com"}); !errors.As(err, &deliveryErr) {
+			t.Errorf("expected a DeliveryError, got %v", err)
+		}
+
+		if last := c.Metrics.Last(); last.Channel != core.ChannelEmail || last.Outcome != core.OutcomeFailed {
+			t.Errorf("unexpected metric %+v", last)
+		}
+	})
+
+	t.Run("Suppressed", func(t *testing.T) {
+		defer c.Reset()
+
+		c.Suppressions.Add(context.TODO(), "al@example.com", "bounced")
+		defer c.Suppressions.Remove(context.TODO(), "al@example.com")
+
+		if _, err := c.Task1(context.TODO(), &core.Task1Input{To: "al@example.com"}); !errors.Is(err, core.ErrSuppressed) {
+			t.Errorf("expected ErrSuppressed, got %v", err)
+		}
+
+		c.Email.AssertCount(t, 0)
+	})
+
+	t.Run("Deferred", func(t *testing.T) {
+		defer c.Reset()
+
+		// Noon in London is 21:00 in Tokyo, quiet until 08:00 there
+		if _, err := c.Task1(context.TODO(), &core.Task1Input{UserID: "jo", Template: "welcome", Data: map[string]any{"name": "Jo"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		c.Email.AssertCount(t, 1)
+		c.SMS.AssertCount(t, 0)
+
+		if pending := c.Scheduler.Pending(); len(pending) != 1 || !pending[0].At.Equal(time.Date(2022, 6, 1, 23, 0, 0, 0, time.UTC)) {
+			t.Fatalf("unexpected pending %+v", pending)
+		}
+
+		c.RunDue(context.TODO())
+		c.SMS.AssertCount(t, 0)
+
+		now = now.Add(11 * time.Hour)
+		defer func() { now = now.Add(-11 * time.Hour) }()
+
+		if err := c.RunDue(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+
+		c.SMS.AssertLast(t, fakes.Message{To: "0123456789", Body: "Salut Jo"})
+	})
+}
+
+func TestNewCoreErr(t *testing.T) {
+	_, err := fakes.NewCore(&fakes.CoreOptions{
+		Routes: map[string]*fakes.Route{
+			"missing": {Channels: []string{"carrier-pigeon"}},
+		},
+	})
+	if err == nil {
+		t.Error("a route to an unknown channel should be an error")
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	fakes.Must(&fakes.Core{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	fakes.Must(&fakes.Core{}, errMock)
+}
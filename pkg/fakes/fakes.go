@@ -0,0 +1,162 @@
+// fakes
+//
+// In memory stand ins for everything core depends on, for tests here and in anything that
+// builds on this service. Each one records its calls and can be told to fail a given call,
+// or every call, and to take its time about answering. The stateful ones (the directory,
+// scheduler and suppression list) really hold their data, so a test reads like the service
+// running rather than a list of expectations. NewCore wires a real core to all of them, and
+// HTTPCore stands in front of one to record what the HTTP server asks of it
+package fakes
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// Named here as well so code outside this module, which can't import
+// internal/core, can still write them down
+type (
+	Message     = core.Message
+	Recipient   = core.Recipient
+	Suppression = core.Suppression
+	Route       = core.Route
+	QuietHours  = core.QuietHours
+)
+
+// Call is what the stateful fakes record, the method and its arguments
+// after the context
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Recorder is embedded in every fake, keeping each call in order and
+// deciding whether it fails. The zero value records and never fails
+type Recorder[T any] struct {
+	mu    sync.Mutex
+	calls []T
+
+	// Keyed by call number, counting from 1
+	failures map[int]error
+	err      error
+
+	latency time.Duration
+}
+
+// FailOn makes the nth call, counting from 1, return err. The call is
+// still recorded, as a provider that was reached and refused would be
+func (r *Recorder[T]) FailOn(n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures == nil {
+		r.failures = map[int]error{}
+	}
+	r.failures[n] = err
+}
+
+// FailAlways makes every call return err, nil puts it back to succeeding.
+// A FailOn for the call wins over it
+func (r *Recorder[T]) FailAlways(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+}
+
+// Delay makes every call take d, or until its context is done in which
+// case it returns the context's error
+func (r *Recorder[T]) Delay(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latency = d
+}
+
+// Reset forgets the calls and any failures or delay
+func (r *Recorder[T]) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls, r.failures, r.err, r.latency = nil, nil, nil, 0
+}
+
+// Calls returns every call so far, oldest first
+func (r *Recorder[T]) Calls() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]T(nil), r.calls...)
+}
+
+func (r *Recorder[T]) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.calls)
+}
+
+// Last returns the latest call, the zero value if there's been none
+func (r *Recorder[T]) Last() T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var last T
+	if len(r.calls) > 0 {
+		last = r.calls[len(r.calls)-1]
+	}
+
+	return last
+}
+
+// AssertCount fails the test unless there have been exactly want calls
+func (r *Recorder[T]) AssertCount(t testing.TB, want int) {
+	t.Helper()
+
+	if got := r.Count(); got != want {
+		t.Errorf("%v calls, want %v", got, want)
+	}
+}
+
+// AssertLast fails the test unless the latest call is want
+func (r *Recorder[T]) AssertLast(t testing.TB, want T) {
+	t.Helper()
+
+	if r.Count() == 0 {
+		t.Errorf("no calls, want %+v", want)
+		return
+	}
+
+	if got := r.Last(); !reflect.DeepEqual(got, want) {
+		t.Errorf("last call %+v, want %+v", got, want)
+	}
+}
+
+// Records the call then holds it for the delay, returning the error it
+// was told to fail with if any
+func (r *Recorder[T]) record(ctx context.Context, call T) error {
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+
+	err, ok := r.failures[len(r.calls)]
+	if !ok {
+		err = r.err
+	}
+	latency := r.latency
+	r.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,289 @@
+package fakes_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/fakes"
+)
+
+var errMock = errors.New("mock error")
+
+// Catches what an assertion reports instead of failing the real test
+type MockT struct {
+	testing.TB
+	Errors []string
+}
+
+func (mt *MockT) Helper() {}
+
+func (mt *MockT) Errorf(format string, args ...any) {
+	mt.Errors = append(mt.Errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	t.Run("Records", func(t *testing.T) {
+		var email fakes.Email
+
+		email.Send(context.TODO(), "jo@example.com", "Hello", "Hi Jo")
+		email.Send(context.TODO(), "al@example.com", "Hello", "Hi Al")
+
+		if email.Count() != 2 || email.Calls()[0].To != "jo@example.com" {
+			t.Errorf("unexpected calls %+v", email.Calls())
+		}
+
+		email.AssertCount(t, 2)
+		email.AssertLast(t, fakes.Message{To: "al@example.com", Subject: "Hello", Body: "Hi Al"})
+	})
+
+	t.Run("FailOn", func(t *testing.T) {
+		var sms fakes.SMS
+		sms.FailOn(2, errMock)
+
+		for i, want := range []error{nil, errMock, nil} {
+			if err := sms.Send(context.TODO(), "0123456789", "hi"); err != want {
+				t.Errorf("call %v returned %v, want %v", i+1, err, want)
+			}
+		}
+
+		sms.AssertCount(t, 3)
+	})
+
+	t.Run("FailAlways", func(t *testing.T) {
+		var push fakes.Push
+		push.FailAlways(errMock)
+		push.FailOn(2, nil)
+
+		for i, want := range []error{errMock, nil, errMock} {
+			if err := push.Send(context.TODO(), "token", "title", "body"); err != want {
+				t.Errorf("call %v returned %v, want %v", i+1, err, want)
+			}
+		}
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		var slack fakes.Slack
+		slack.Delay(20 * time.Millisecond)
+
+		start := time.Now()
+		if err := slack.Send(context.TODO(), "C123", "", "hi"); err != nil || time.Since(start) < 20*time.Millisecond {
+			t.Errorf("returned %v after %v", err, time.Since(start))
+		}
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+
+		slack.Delay(time.Hour)
+		if err := slack.Send(ctx, "C123", "", "hi"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the context's error, got %v", err)
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		var webhook fakes.Webhook
+		webhook.FailAlways(errMock)
+		webhook.Send(context.TODO(), "https://example.com", "", "")
+
+		webhook.Reset()
+		if webhook.Count() != 0 || webhook.Send(context.TODO(), "https://example.com", "", "") != nil {
+			t.Error("reset should forget the calls and the failure")
+		}
+	})
+
+	t.Run("Assertions", func(t *testing.T) {
+		var channel fakes.Channel
+		mt := &MockT{}
+
+		channel.AssertLast(mt, fakes.Message{})
+		channel.Send(context.TODO(), &fakes.Message{To: "jo"})
+		channel.AssertCount(mt, 2)
+		channel.AssertLast(mt, fakes.Message{To: "al"})
+
+		if len(mt.Errors) != 3 {
+			t.Errorf("expected 3 failures, got %q", mt.Errors)
+		}
+
+		if (channel.Last() != fakes.Message{To: "jo"}) {
+			t.Errorf("unexpected last %+v", channel.Last())
+		}
+	})
+}
+
+func TestDirectory(t *testing.T) {
+	var directory fakes.Directory
+	directory.Add(&fakes.Recipient{ID: "jo", Email: "jo@example.com"})
+
+	if r, err := directory.Get(context.TODO(), "jo"); err != nil || r.Email != "jo@example.com" {
+		t.Errorf("unexpected recipient %+v (%v)", r, err)
+	}
+
+	if r, err := directory.Get(context.TODO(), "nobody"); err != nil || r != nil {
+		t.Errorf("an unknown id should be nil, got %+v (%v)", r, err)
+	}
+
+	directory.Put(context.TODO(), &fakes.Recipient{ID: "al"})
+	if list, _ := directory.List(context.TODO()); len(list) != 2 || list[0].ID != "al" {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	if ok, _ := directory.Delete(context.TODO(), "al"); !ok {
+		t.Error("al should have been deleted")
+	}
+
+	directory.AssertLast(t, fakes.Call{Method: "Delete", Args: []any{"al"}})
+
+	directory.FailOn(6, errMock)
+	if _, err := directory.Get(context.TODO(), "jo"); err != errMock {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	templates := &fakes.Templates{
+		Templates: map[string]fakes.Template{
+			"welcome":       {Subject: "Welcome", Body: "Hi {{.name}}"},
+			"welcome.fr":    {Subject: "Bienvenue", Body: "Salut {{.name}}"},
+			"welcome.de-DE": {Subject: "Willkommen", Body: "Hallo {{.name}}"},
+			"total":         {Subject: "Total", Body: "{{formatNumber .total 2}}"},
+		},
+		DefaultLocale: "de-DE",
+	}
+
+	for locale, want := range map[string]string{"fr-CA": "Salut Jo", "fr": "Salut Jo", "en-GB": "Hallo Jo", "": "Hallo Jo"} {
+		if _, body, err := templates.Render(context.TODO(), "welcome", locale, map[string]any{"name": "Jo"}); err != nil || body != want {
+			t.Errorf("%q rendered %q (%v), want %q", locale, body, err, want)
+		}
+	}
+
+	if _, body, err := templates.Render(context.TODO(), "total", "fr-FR", map[string]any{"total": 1234.5}); err != nil || body != "1\u00a0234,50" {
+		t.Errorf("formatted %q (%v), want the fr-FR format", body, err)
+	}
+
+	if _, _, err := templates.Render(context.TODO(), "missing", "", nil); err == nil {
+		t.Error("an unknown template should be an error")
+	}
+
+	if _, _, err := templates.Render(context.TODO(), "welcome", "", nil); err == nil {
+		t.Error("missing data should be an error")
+	}
+
+	templates.AssertCount(t, 7)
+}
+
+func TestHTTPCore(t *testing.T) {
+	notifications := fakes.Must(fakes.NewCore(&fakes.CoreOptions{}))
+	api := &fakes.HTTPCore{Core: notifications}
+
+	if err := api.Suppress(context.TODO(), "jo@example.com", "bounced"); err != nil {
+		t.Fatal(err)
+	}
+
+	api.AssertLast(t, fakes.Call{Method: "Suppress", Args: []any{"jo@example.com", "bounced"}})
+	notifications.Suppressions.AssertCount(t, 1)
+
+	if suppressions, err := api.ListSuppressions(context.TODO()); err != nil || len(suppressions) != 1 {
+		t.Errorf("unexpected suppressions %v (%v)", suppressions, err)
+	}
+
+	api.FailOn(3, errMock)
+	if err := api.Unsuppress(context.TODO(), "jo@example.com"); err != errMock {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+
+	// A failed call never reaches core
+	notifications.Suppressions.AssertCount(t, 2)
+
+	var defaulted fakes.HTTPCore
+	if recipients, err := defaulted.ListRecipients(context.TODO()); err != nil || len(recipients) != 0 {
+		t.Errorf("unexpected recipients %v (%v)", recipients, err)
+	}
+	defaulted.AssertCount(t, 1)
+}
+
+func TestScheduler(t *testing.T) {
+	var scheduler fakes.Scheduler
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	later, _ := scheduler.Schedule(context.TODO(), now.Add(time.Hour), "sms", []byte("later"))
+	soon, _ := scheduler.Schedule(context.TODO(), now.Add(time.Minute), "email", []byte("soon"))
+	cancelled, _ := scheduler.Schedule(context.TODO(), now, "email", []byte("cancelled"))
+
+	if ok, _ := scheduler.Cancel(context.TODO(), cancelled); !ok {
+		t.Error("the job should have been cancelled")
+	}
+
+	if ok, _ := scheduler.Reschedule(context.TODO(), later, now.Add(2*time.Hour)); !ok {
+		t.Error("the job should have been rescheduled")
+	}
+
+	if at, ok, _ := scheduler.When(context.TODO(), later); !ok || !at.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("unexpected when %v %v", at, ok)
+	}
+
+	var ran []string
+	run := func(ctx context.Context, kind string, payload []byte) error {
+		ran = append(ran, string(payload))
+		return nil
+	}
+
+	scheduler.RunDue(context.TODO(), now.Add(time.Hour), run)
+	if len(ran) != 1 || ran[0] != "soon" {
+		t.Errorf("only the soon job was due, ran %v", ran)
+	}
+
+	if pending := scheduler.Pending(); len(pending) != 1 || pending[0].ID != later {
+		t.Errorf("unexpected pending %+v", pending)
+	}
+
+	if _, ok, _ := scheduler.When(context.TODO(), soon); ok {
+		t.Error("a job that has run shouldn't be found")
+	}
+
+	if err := scheduler.RunDue(context.TODO(), now.Add(3*time.Hour), func(context.Context, string, []byte) error { return errMock }); err != errMock || len(scheduler.Pending()) != 1 {
+		t.Errorf("a failed job should be kept, got %v", err)
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	suppressions := &fakes.Suppressions{Now: func() time.Time {
+		return time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	}}
+
+	suppressions.Add(context.TODO(), " Jo@Example.com", "bounced")
+
+	if ok, _ := suppressions.Suppressed(context.TODO(), "jo@example.com "); !ok {
+		t.Error("addresses should match ignoring case and space")
+	}
+
+	if list, _ := suppressions.List(context.TODO()); len(list) != 1 || list[0].Address != "jo@example.com" || list[0].Reason != "bounced" {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	if ok, _ := suppressions.Remove(context.TODO(), "jo@example.com"); !ok {
+		t.Error("the address should have been removed")
+	}
+
+	if ok, _ := suppressions.Remove(context.TODO(), "jo@example.com"); ok {
+		t.Error("the address was already removed")
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var tracer fakes.Tracer
+
+	_, span := tracer.Start(context.TODO(), "core.Task1")
+	span.SetAttribute("channel", "email")
+	span.End(errMock)
+
+	spans := tracer.Named("core.Task1")
+	if len(spans) != 1 || spans[0].Attribute("channel") != "email" {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+
+	if ended, err := spans[0].Ended(); !ended || err != errMock {
+		t.Errorf("unexpected end %v %v", ended, err)
+	}
+}
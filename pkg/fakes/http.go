@@ -0,0 +1,149 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/http"
+)
+
+// HTTPCore fakes http.CoreClientInterface, for testing a server in front
+// of core without going through it by hand. Each call is recorded, then
+// handed to Core unless it was told to fail, so by default the answers
+// are a real core's running on the other fakes
+type HTTPCore struct {
+	Recorder[Call]
+
+	// Optional, defaults to a NewCore with nothing set
+	Core http.CoreClientInterface
+
+	once sync.Once
+}
+
+var _ http.CoreClientInterface = (*HTTPCore)(nil)
+
+// Records the call, returning what Core should answer it with or the
+// error it was told to fail with
+func (h *HTTPCore) call(ctx context.Context, method string, args ...any) (http.CoreClientInterface, error) {
+	if err := h.record(ctx, Call{Method: method, Args: args}); err != nil {
+		return nil, err
+	}
+
+	h.once.Do(func() {
+		if h.Core == nil {
+			h.Core = Must(NewCore(&CoreOptions{}))
+		}
+	})
+
+	return h.Core, nil
+}
+
+func (h *HTTPCore) Task1(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+	next, err := h.call(ctx, "Task1", *in)
+	if err != nil {
+		return nil, err
+	}
+
+	return next.Task1(ctx, in)
+}
+
+func (h *HTTPCore) DryRun(ctx context.Context, in *core.Task1Input) (*core.DryRunOutput, error) {
+	next, err := h.call(ctx, "DryRun", *in)
+	if err != nil {
+		return nil, err
+	}
+
+	return next.DryRun(ctx, in)
+}
+
+func (h *HTTPCore) Scheduled(ctx context.Context, id string) (*core.Task1Output, error) {
+	next, err := h.call(ctx, "Scheduled", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return next.Scheduled(ctx, id)
+}
+
+func (h *HTTPCore) CancelScheduled(ctx context.Context, id string) error {
+	next, err := h.call(ctx, "CancelScheduled", id)
+	if err != nil {
+		return err
+	}
+
+	return next.CancelScheduled(ctx, id)
+}
+
+func (h *HTTPCore) Reschedule(ctx context.Context, id string, at time.Time) error {
+	next, err := h.call(ctx, "Reschedule", id, at)
+	if err != nil {
+		return err
+	}
+
+	return next.Reschedule(ctx, id, at)
+}
+
+func (h *HTTPCore) GetRecipient(ctx context.Context, id string) (*Recipient, error) {
+	next, err := h.call(ctx, "GetRecipient", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return next.GetRecipient(ctx, id)
+}
+
+func (h *HTTPCore) ListRecipients(ctx context.Context) ([]*Recipient, error) {
+	next, err := h.call(ctx, "ListRecipients")
+	if err != nil {
+		return nil, err
+	}
+
+	return next.ListRecipients(ctx)
+}
+
+func (h *HTTPCore) PutRecipient(ctx context.Context, r *Recipient) error {
+	next, err := h.call(ctx, "PutRecipient", *r)
+	if err != nil {
+		return err
+	}
+
+	return next.PutRecipient(ctx, r)
+}
+
+func (h *HTTPCore) DeleteRecipient(ctx context.Context, id string) error {
+	next, err := h.call(ctx, "DeleteRecipient", id)
+	if err != nil {
+		return err
+	}
+
+	return next.DeleteRecipient(ctx, id)
+}
+
+func (h *HTTPCore) Suppress(ctx context.Context, address, reason string) error {
+	next, err := h.call(ctx, "Suppress", address, reason)
+	if err != nil {
+		return err
+	}
+
+	return next.Suppress(ctx, address, reason)
+}
+
+func (h *HTTPCore) Unsuppress(ctx context.Context, address string) error {
+	next, err := h.call(ctx, "Unsuppress", address)
+	if err != nil {
+		return err
+	}
+
+	return next.Unsuppress(ctx, address)
+}
+
+func (h *HTTPCore) ListSuppressions(ctx context.Context) ([]*Suppression, error) {
+	next, err := h.call(ctx, "ListSuppressions")
+	if err != nil {
+		return nil, err
+	}
+
+	return next.ListSuppressions(ctx)
+}
@@ -0,0 +1,111 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+)
+
+// MetricEvent is what Metrics records, Outcome and Took are only set for
+// a delivery
+type MetricEvent struct {
+	Kind    string
+	Channel string
+	Outcome string
+	Took    time.Duration
+}
+
+// The kinds of MetricEvent
+const (
+	MetricDelivered  = "delivered"
+	MetricDeferred   = "deferred"
+	MetricSuppressed = "suppressed"
+)
+
+// Metrics fakes core.Metrics. Neither method can fail, so only the
+// recording and any delay apply
+type Metrics struct {
+	Recorder[MetricEvent]
+}
+
+func (m *Metrics) Delivered(channel, outcome string, took time.Duration) {
+	m.record(context.Background(), MetricEvent{Kind: MetricDelivered, Channel: channel, Outcome: outcome, Took: took})
+}
+
+func (m *Metrics) Deferred(channel string) {
+	m.record(context.Background(), MetricEvent{Kind: MetricDeferred, Channel: channel})
+}
+
+func (m *Metrics) Suppressed(channel string) {
+	m.record(context.Background(), MetricEvent{Kind: MetricSuppressed, Channel: channel})
+}
+
+// Span is one started by Tracer, read it once it has ended
+type Span struct {
+	Name string
+
+	mu         sync.Mutex
+	attributes map[string]string
+	ended      bool
+	err        error
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attributes == nil {
+		s.attributes = map[string]string{}
+	}
+	s.attributes[key] = value
+}
+
+func (s *Span) End(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ended, s.err = true, err
+}
+
+// Attribute returns the value set for key, empty if there wasn't one
+func (s *Span) Attribute(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.attributes[key]
+}
+
+// Ended reports whether End was called and the error it was given
+func (s *Span) Ended() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ended, s.err
+}
+
+// Tracer fakes core.Tracer, recording every span it starts. They don't
+// nest, a test wanting the tree should use pkg/tracing's memory exporter
+type Tracer struct {
+	Recorder[*Span]
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, core.Span) {
+	span := &Span{Name: name}
+	t.record(ctx, span)
+
+	return ctx, span
+}
+
+// Named returns the spans started with name, oldest first
+func (t *Tracer) Named(name string) []*Span {
+	var spans []*Span
+	for _, span := range t.Calls() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+
+	return spans
+}
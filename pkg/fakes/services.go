@@ -0,0 +1,361 @@
+package fakes
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/templates"
+)
+
+// Directory fakes core.DirectoryService, holding recipients in memory. Put
+// some in with Add before the test, the calls to it are only the service's
+type Directory struct {
+	Recorder[Call]
+
+	state      sync.Mutex
+	recipients map[string]*Recipient
+}
+
+// Add puts recipients in without recording a call
+func (d *Directory) Add(recipients ...*Recipient) {
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	if d.recipients == nil {
+		d.recipients = map[string]*Recipient{}
+	}
+
+	for _, r := range recipients {
+		copied := *r
+		d.recipients[r.ID] = &copied
+	}
+}
+
+// Get returns nil for an unknown ID, as the real directory does
+func (d *Directory) Get(ctx context.Context, id string) (*Recipient, error) {
+	if err := d.record(ctx, Call{Method: "Get", Args: []any{id}}); err != nil {
+		return nil, err
+	}
+
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	r, ok := d.recipients[id]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *r
+	return &copied, nil
+}
+
+// List returns every recipient ordered by ID
+func (d *Directory) List(ctx context.Context) ([]*Recipient, error) {
+	if err := d.record(ctx, Call{Method: "List"}); err != nil {
+		return nil, err
+	}
+
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	recipients := make([]*Recipient, 0, len(d.recipients))
+	for _, r := range d.recipients {
+		copied := *r
+		recipients = append(recipients, &copied)
+	}
+
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i].ID < recipients[j].ID })
+
+	return recipients, nil
+}
+
+func (d *Directory) Put(ctx context.Context, r *Recipient) error {
+	if err := d.record(ctx, Call{Method: "Put", Args: []any{*r}}); err != nil {
+		return err
+	}
+
+	d.Add(r)
+
+	return nil
+}
+
+func (d *Directory) Delete(ctx context.Context, id string) (bool, error) {
+	if err := d.record(ctx, Call{Method: "Delete", Args: []any{id}}); err != nil {
+		return false, err
+	}
+
+	d.state.Lock()
+	defer d.state.Unlock()
+
+	_, ok := d.recipients[id]
+	delete(d.recipients, id)
+
+	return ok, nil
+}
+
+// Template is a subject and body in Go's text/template syntax
+type Template struct {
+	Subject string
+	Body    string
+}
+
+// TemplateCall is what Templates records for each Render
+type TemplateCall struct {
+	Name   string
+	Locale string
+	Data   map[string]any
+}
+
+// Templates fakes core.TemplateService, recording each Render and handing it
+// to a templates.Client built from what's in Templates. They're keyed as the
+// client has them, "name.locale" and the plain "name", so the fallbacks and
+// formatting helpers are the real ones. A name in none of them is an error
+type Templates struct {
+	Recorder[TemplateCall]
+
+	Templates map[string]Template
+
+	// Optional, tried after the requested locale
+	DefaultLocale string
+}
+
+func (t *Templates) Render(ctx context.Context, name, locale string, data map[string]any) (string, string, error) {
+	if err := t.record(ctx, TemplateCall{Name: name, Locale: locale, Data: data}); err != nil {
+		return "", "", err
+	}
+
+	// Built each time, a test can change Templates between calls
+	sources := map[string]*templates.Template{}
+	for key, tmpl := range t.Templates {
+		sources[key] = &templates.Template{Subject: tmpl.Subject, Body: tmpl.Body}
+	}
+
+	client, err := templates.New(&templates.ClientOptions{
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Templates:     sources,
+		DefaultLocale: t.DefaultLocale,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return client.Render(ctx, name, locale, data)
+}
+
+// Job is a notification held by Scheduler
+type Job struct {
+	ID      string
+	At      time.Time
+	Kind    string
+	Payload []byte
+}
+
+// Scheduler fakes core.SchedulerService, holding jobs until RunDue is
+// called, nothing runs on its own
+type Scheduler struct {
+	Recorder[Call]
+
+	state sync.Mutex
+	jobs  map[string]*Job
+	next  int
+}
+
+func (s *Scheduler) Schedule(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+	if err := s.record(ctx, Call{Method: "Schedule", Args: []any{at, kind, payload}}); err != nil {
+		return "", err
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	if s.jobs == nil {
+		s.jobs = map[string]*Job{}
+	}
+
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.jobs[id] = &Job{ID: id, At: at, Kind: kind, Payload: payload}
+
+	return id, nil
+}
+
+func (s *Scheduler) When(ctx context.Context, id string) (time.Time, bool, error) {
+	if err := s.record(ctx, Call{Method: "When", Args: []any{id}}); err != nil {
+		return time.Time{}, false, err
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	return job.At, true, nil
+}
+
+func (s *Scheduler) Cancel(ctx context.Context, id string) (bool, error) {
+	if err := s.record(ctx, Call{Method: "Cancel", Args: []any{id}}); err != nil {
+		return false, err
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, ok := s.jobs[id]
+	delete(s.jobs, id)
+
+	return ok, nil
+}
+
+func (s *Scheduler) Reschedule(ctx context.Context, id string, at time.Time) (bool, error) {
+	if err := s.record(ctx, Call{Method: "Reschedule", Args: []any{id, at}}); err != nil {
+		return false, err
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return false, nil
+	}
+
+	job.At = at
+
+	return true, nil
+}
+
+// Pending returns the jobs still held, soonest first
+func (s *Scheduler) Pending() []Job {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].At.Equal(jobs[j].At) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].At.Before(jobs[j].At)
+	})
+
+	return jobs
+}
+
+// RunDue hands every job due by now to run, soonest first, then forgets it.
+// Pass core's RunScheduled to deliver them, the first error stops the rest
+// and leaves the job that failed held
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time, run func(context.Context, string, []byte) error) error {
+	for _, job := range s.Pending() {
+		if job.At.After(now) {
+			break
+		}
+
+		if err := run(ctx, job.Kind, job.Payload); err != nil {
+			return err
+		}
+
+		s.state.Lock()
+		delete(s.jobs, job.ID)
+		s.state.Unlock()
+	}
+
+	return nil
+}
+
+// Suppressions fakes core.SuppressionService, addresses are matched
+// ignoring case and surrounding space as the real list does
+type Suppressions struct {
+	Recorder[Call]
+
+	state        sync.Mutex
+	suppressions map[string]*Suppression
+
+	// Stamped on each one added, defaults to time.Now
+	Now func() time.Time
+}
+
+func (s *Suppressions) Suppressed(ctx context.Context, address string) (bool, error) {
+	if err := s.record(ctx, Call{Method: "Suppressed", Args: []any{address}}); err != nil {
+		return false, err
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, ok := s.suppressions[normalise(address)]
+
+	return ok, nil
+}
+
+func (s *Suppressions) Add(ctx context.Context, address, reason string) error {
+	if err := s.record(ctx, Call{Method: "Add", Args: []any{address, reason}}); err != nil {
+		return err
+	}
+
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	if s.suppressions == nil {
+		s.suppressions = map[string]*Suppression{}
+	}
+
+	address = normalise(address)
+	s.suppressions[address] = &Suppression{Address: address, Reason: reason, Added: now()}
+
+	return nil
+}
+
+func (s *Suppressions) Remove(ctx context.Context, address string) (bool, error) {
+	if err := s.record(ctx, Call{Method: "Remove", Args: []any{address}}); err != nil {
+		return false, err
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, ok := s.suppressions[normalise(address)]
+	delete(s.suppressions, normalise(address))
+
+	return ok, nil
+}
+
+// List returns every suppression ordered by address
+func (s *Suppressions) List(ctx context.Context) ([]*Suppression, error) {
+	if err := s.record(ctx, Call{Method: "List"}); err != nil {
+		return nil, err
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	suppressions := make([]*Suppression, 0, len(s.suppressions))
+	for _, sup := range s.suppressions {
+		copied := *sup
+		suppressions = append(suppressions, &copied)
+	}
+
+	sort.Slice(suppressions, func(i, j int) bool { return suppressions[i].Address < suppressions[j].Address })
+
+	return suppressions, nil
+}
+
+func normalise(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Anything that can hand back the current value of a secret, pkg/secrets
+// implements this so a rotated key is picked up without a restart
+type Secret interface {
+	Value(context.Context) (string, error)
+}
+
+// Left open so probes and scrapers don't need the key
+var unauthenticated = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// Turns away requests without the API key, when one is configured
+func (c *Client) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.apiKey == nil || unauthenticated[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := c.apiKey.Value(r.Context())
+		if err != nil {
+			c.logger.ErrorContext(r.Context(), "Fetching the API key failed", "error", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		// A browser can't send a bearer token, so the sandbox's inbox also
+		// takes the key as the password of basic auth, which it prompts for
+		browser := r.URL.Path == "/sandbox" || strings.HasPrefix(r.URL.Path, "/sandbox/")
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && browser {
+			_, given, ok = r.BasicAuth()
+		}
+
+		// Compared in constant time so the key can't be guessed a byte at a time
+		if !ok || key == "" || subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+			if browser {
+				w.Header().Set("WWW-Authenticate", `Basic realm="sandbox"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authenticatedKeyContext{}, given)))
+	})
+}
+
+type authenticatedKeyContext struct{}
+
+// The API key the request was let in with, empty when none is needed
+func authenticatedKey(ctx context.Context) string {
+	key, _ := ctx.Value(authenticatedKeyContext{}).(string)
+	return key
+}
@@ -5,49 +5,151 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/api"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
 	"github.com/gorilla/mux"
 )
 
-type LoggerInterface interface {
-	Println(...any)
+// Anything with work in progress that should be given the chance to finish
+// on shutdown, core and the scheduler both are. Drain should stop accepting
+// new work, wait for what's running and describe anything it had to abandon
+type Drainer interface {
+	Drain(context.Context) error
 }
 type CoreClientInterface interface {
-	Task1(context.Context, *core.Task1Input) error
+	Task1(context.Context, *core.Task1Input) (*core.Task1Output, error)
+	DryRun(context.Context, *core.Task1Input) (*core.DryRunOutput, error)
+	Scheduled(context.Context, string) (*core.Task1Output, error)
+	CancelScheduled(context.Context, string) error
+	Reschedule(context.Context, string, time.Time) error
+
+	GetRecipient(context.Context, string) (*core.Recipient, error)
+	ListRecipients(context.Context) ([]*core.Recipient, error)
+	PutRecipient(context.Context, *core.Recipient) error
+	DeleteRecipient(context.Context, string) error
+
+	Suppress(context.Context, string, string) error
+	Unsuppress(context.Context, string) error
+	ListSuppressions(context.Context) ([]*core.Suppression, error)
 }
 
 type ClientOptions struct {
-	StdLog LoggerInterface
+	Logger *slog.Logger
+
+	// Where the default server listens, ignored when HttpServer is set,
+	// defaults to 127.0.0.1:8000
+	Addr string
 
 	HttpServer *http.Server
 
 	Core CoreClientInterface
+
+	// How long shutdown waits for requests and drainers to finish, defaults to 3 seconds
+	DrainTimeout time.Duration
+
+	// How long /readyz reports not ready before shutdown starts, while
+	// requests are still served, so a load balancer polling it has the time
+	// to stop sending any. Defaults to none
+	ReadinessGrace time.Duration
+
+	// Drained in order once the server has stopped taking requests
+	Drainers []Drainer
+
+	// Optional, keyed by the name reported on /readyz
+	HealthChecks map[string]HealthChecker
+
+	// How long /readyz waits for the checks, defaults to 2 seconds
+	HealthTimeout time.Duration
+
+	// Optional, told about every request
+	Metrics RequestMetrics
+
+	// Optional, served on /metrics when set
+	MetricsHandler http.Handler
+
+	// Optional, served on everything under /sandbox/ when set, the
+	// sandbox's inbox of what would have been sent. With an API key set a
+	// browser logs in with basic auth, any username and the key as password
+	SandboxHandler http.Handler
+
+	// Optional, starts a span for every request
+	Tracer Tracer
+
+	// Masks addresses quoted back in error responses, defaults to the
+	// redact package defaults
+	Redact *redact.Client
+
+	// Optional, when set every route but the health checks and metrics
+	// needs it sent as a bearer token
+	APIKey Secret
+
+	// How long the answer to a request with an Idempotency-Key is kept
+	// for its retries, defaults to 24 hours
+	IdempotencyTTL time.Duration
+
+	// The most answers kept at once, the oldest are dropped to make room,
+	// defaults to 10000
+	IdempotencyMaxEntries int
 }
 
 type Client struct {
-	stdLog LoggerInterface
+	logger *slog.Logger
 
 	httpServer *http.Server
 
 	core CoreClientInterface
+
+	drainTimeout   time.Duration
+	readinessGrace time.Duration
+	drainers       []Drainer
+
+	healthChecks  map[string]HealthChecker
+	healthTimeout time.Duration
+
+	// Set to 1 once shutdown starts so /readyz stops reporting ready
+	shuttingDown int32
+
+	metrics        RequestMetrics
+	metricsHandler http.Handler
+	sandboxHandler http.Handler
+
+	tracer Tracer
+
+	redact *redact.Client
+
+	apiKey Secret
+
+	idempotency *idempotency
 }
 
 func New(opts *ClientOptions) (*Client, error) {
 
 	// If the logger was missed, assume a default
-	if opts.StdLog == nil {
-		opts.StdLog = log.New(os.Stdout, "http", 0)
+	if opts.Logger == nil {
+		opts.Logger = logging.Must(logging.New(&logging.ClientOptions{})).With("component", "http")
+	}
+
+	if opts.Addr == "" {
+		opts.Addr = "127.0.0.1:8000"
 	}
 
 	if opts.HttpServer == nil {
 		opts.HttpServer = &http.Server{
-			Addr:         "127.0.0.1:8000",
+			Addr:         opts.Addr,
 			WriteTimeout: 15 * time.Second,
 			ReadTimeout:  15 * time.Second,
 		}
@@ -57,11 +159,58 @@ func New(opts *ClientOptions) (*Client, error) {
 		return nil, errors.New("core missing")
 	}
 
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = 3 * time.Second
+	}
+
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = 2 * time.Second
+	}
+
+	if opts.Metrics == nil {
+		opts.Metrics = noopRequestMetrics{}
+	}
+
+	if opts.Tracer == nil {
+		opts.Tracer = noopTracer{}
+	}
+
+	if opts.IdempotencyTTL <= 0 {
+		opts.IdempotencyTTL = 24 * time.Hour
+	}
+
+	if opts.IdempotencyMaxEntries <= 0 {
+		opts.IdempotencyMaxEntries = 10000
+	}
+
+	if opts.Redact == nil {
+		opts.Redact = redact.Must(redact.New(&redact.ClientOptions{}))
+	}
+
 	return &Client{
-		stdLog:     opts.StdLog,
+		logger:     opts.Logger,
 		httpServer: opts.HttpServer,
 
 		core: opts.Core,
+
+		drainTimeout:   opts.DrainTimeout,
+		readinessGrace: opts.ReadinessGrace,
+		drainers:       opts.Drainers,
+
+		healthChecks:  opts.HealthChecks,
+		healthTimeout: opts.HealthTimeout,
+
+		metrics:        opts.Metrics,
+		metricsHandler: opts.MetricsHandler,
+		sandboxHandler: opts.SandboxHandler,
+
+		tracer: opts.Tracer,
+
+		redact: opts.Redact,
+
+		apiKey: opts.APIKey,
+
+		idempotency: newIdempotency(opts.IdempotencyTTL, opts.IdempotencyMaxEntries),
 	}, nil
 }
 
@@ -73,33 +222,112 @@ func Must(client *Client, err error) *Client {
 	return client
 }
 
-func (c *Client) RunServer() error {
+// Router builds the routes the server handles, exposed so tests
+// can drive requests through it without a listener
+func (c *Client) Router() *mux.Router {
 	router := mux.NewRouter()
 
-	router.HandleFunc("/", c.Task1Handler)
+	// A retry carrying the same Idempotency-Key gets the first answer
+	// rather than sending again
+	router.Handle("/", c.idempotent(http.HandlerFunc(c.Task1Handler)))
+	router.Handle("/v1/bulk", c.idempotent(http.HandlerFunc(c.BulkHandler))).Methods(http.MethodPost)
+	router.HandleFunc("/healthz", c.LivenessHandler).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", c.ReadinessHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/notifications/{id}", c.StatusHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/notifications/{id}", c.CancelHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/notifications/{id}", c.RescheduleHandler).Methods(http.MethodPatch)
+	router.HandleFunc("/v1/recipients", c.ListRecipientsHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/recipients/{id}", c.GetRecipientHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/recipients/{id}", c.PutRecipientHandler).Methods(http.MethodPut)
+	router.HandleFunc("/v1/recipients/{id}", c.DeleteRecipientHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/suppressions", c.ListSuppressionsHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/suppressions/{address}", c.PutSuppressionHandler).Methods(http.MethodPut)
+	router.HandleFunc("/v1/suppressions/{address}", c.DeleteSuppressionHandler).Methods(http.MethodDelete)
+
+	if c.metricsHandler != nil {
+		router.Handle("/metrics", c.metricsHandler).Methods(http.MethodGet)
+	}
+
+	if c.sandboxHandler != nil {
+		router.Handle("/sandbox", http.RedirectHandler("/sandbox/", http.StatusMovedPermanently))
+		router.PathPrefix("/sandbox/").Handler(c.sandboxHandler)
+	}
+
+	// Middleware only runs for matched routes, these go through it
+	// themselves so a 404 or 405 is still counted and logged
+	router.NotFoundHandler = c.instrument(http.NotFoundHandler())
+	router.MethodNotAllowedHandler = c.instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	router.Use(c.instrument, c.authenticate)
+
+	return router
+}
 
-	c.httpServer.Handler = router
+// RunServer serves until ctx is cancelled or the process is asked to stop
+// with SIGINT (Ctrl+C) or SIGTERM (as Kubernetes does), then shuts down
+// gracefully, returning an error describing any work that was abandoned
+func (c *Client) RunServer(ctx context.Context) error {
+	c.httpServer.Handler = c.Router()
 
 	go func() {
-		if err := c.httpServer.ListenAndServe(); err != nil {
-			c.stdLog.Println(err)
+		if err := c.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Error("Server stopped", "error", err)
 		}
 	}()
 
-	signalChan := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(signalChan, os.Interrupt)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Expired answers are never replayed, sweeping them out once a minute
+	// is only to hand back the memory
+	go c.idempotency.run(ctx, min(c.idempotency.ttl, time.Minute))
 
 	// Block until we receive our signal.
-	<-signalChan
+	<-ctx.Done()
+
+	// A second signal during the grace period stops the process outright
+	stop()
+
+	return c.shutdown()
+}
+
+// Reports not ready and keeps serving for the grace period, then stops
+// taking requests, waits for those in progress and drains everything else
+// in order, all within the one deadline
+func (c *Client) shutdown() error {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+
+	if c.readinessGrace > 0 {
+		c.logger.Info("Shutting down, waiting for the load balancer to stop sending requests", "grace", c.readinessGrace)
+		time.Sleep(c.readinessGrace)
+	}
 
-	// Create a deadline to wait for.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	ctx, cancel := context.WithTimeout(context.Background(), c.drainTimeout)
 	defer cancel()
+
+	var abandoned []string
+
 	// Doesn't block if no connections, but will otherwise wait
 	// until the timeout deadline.
-	return c.httpServer.Shutdown(ctx)
+	if err := c.httpServer.Shutdown(ctx); err != nil {
+		abandoned = append(abandoned, "http requests: "+err.Error())
+	}
+
+	for _, drainer := range c.drainers {
+		if err := drainer.Drain(ctx); err != nil {
+			abandoned = append(abandoned, err.Error())
+		}
+	}
+
+	if len(abandoned) > 0 {
+		err := fmt.Errorf("shutdown abandoned work: %v", strings.Join(abandoned, "; "))
+		c.logger.Error("Shutdown abandoned work", "error", err)
+		return err
+	}
+
+	return nil
 }
 
 func (c *Client) ExposeHttpServer() *http.Server {
@@ -116,10 +344,30 @@ func (c *Client) Task1Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dryRun := r.URL.Query().Get(api.QueryDryRun); dryRun != "" {
+		ok, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "%v should be true or false", api.QueryDryRun)
+			return
+		}
+
+		if ok {
+			c.dryRun(w, r, &input)
+			return
+		}
+	}
+
 	// Run the core function
-	if err := c.core.Task1(r.Context(), &input); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
+	output, err := c.core.Task1(r.Context(), &input)
+	if err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	// Scheduled notifications hand back the ID needed to cancel or move them
+	if output != nil && output.ID != "" {
+		writeJSON(w, http.StatusAccepted, output)
 		return
 	}
 
@@ -127,3 +375,270 @@ func (c *Client) Task1Handler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "Done")
 }
+
+// Answers with what Task1 would send, failing the way it would
+func (c *Client) dryRun(w http.ResponseWriter, r *http.Request, input *core.Task1Input) {
+	output, err := c.core.DryRun(r.Context(), input)
+	if err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	// Provider errors can quote addresses other than the caller's own
+	for _, delivery := range output.Deliveries {
+		delivery.Error = c.redact.Text(delivery.Error)
+	}
+
+	writeJSON(w, http.StatusOK, output)
+}
+
+// Only scheduled notifications have a status, anything sent, cancelled
+// or never scheduled is a 404
+func (c *Client) StatusHandler(w http.ResponseWriter, r *http.Request) {
+
+	output, err := c.core.Scheduled(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, output)
+}
+
+// Sends every notification in the body, a few at a time, answering with
+// how each went. The request itself succeeds whatever happens to them
+func (c *Client) BulkHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Decode user input
+	var input api.BulkInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	if len(input.Notifications) == 0 || len(input.Notifications) > api.MaxBulk {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "between 1 and %v notifications can be sent at once", api.MaxBulk)
+		return
+	}
+
+	results := make([]*api.BulkResult, len(input.Notifications))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, bulkConcurrency)
+
+	for i, notification := range input.Notifications {
+		if notification == nil {
+			results[i] = &api.BulkResult{Status: http.StatusBadRequest, Error: "notification missing"}
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, notification *api.Task1Input) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = c.bulkResult(r.Context(), notification)
+		}(i, notification)
+	}
+
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, &api.BulkOutput{Results: results})
+}
+
+// How many of a bulk request's notifications are sent at once
+const bulkConcurrency = 4
+
+func (c *Client) bulkResult(ctx context.Context, notification *api.Task1Input) *api.BulkResult {
+	output, err := c.core.Task1(ctx, notification)
+	if err != nil {
+		return &api.BulkResult{Status: statusOf(err), Error: c.redact.Text(err.Error())}
+	}
+
+	if output != nil && output.ID != "" {
+		return &api.BulkResult{Status: http.StatusAccepted, ID: output.ID, SendAt: output.SendAt}
+	}
+
+	return &api.BulkResult{Status: http.StatusOK}
+}
+
+func (c *Client) CancelHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := c.core.CancelScheduled(r.Context(), mux.Vars(r)["id"]); err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Client) RescheduleHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Decode user input
+	var input api.RescheduleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	if input.SendAt.IsZero() {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "send_at missing")
+		return
+	}
+
+	if err := c.core.Reschedule(r.Context(), mux.Vars(r)["id"], input.SendAt); err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Client) ListRecipientsHandler(w http.ResponseWriter, r *http.Request) {
+
+	recipients, err := c.core.ListRecipients(r.Context())
+	if err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recipients)
+}
+
+func (c *Client) GetRecipientHandler(w http.ResponseWriter, r *http.Request) {
+
+	recipient, err := c.core.GetRecipient(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recipient)
+}
+
+func (c *Client) PutRecipientHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Decode user input
+	var recipient core.Recipient
+	if err := json.NewDecoder(r.Body).Decode(&recipient); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	// The path is the source of truth for which recipient this is
+	recipient.ID = mux.Vars(r)["id"]
+
+	if err := c.core.PutRecipient(r.Context(), &recipient); err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &recipient)
+}
+
+func (c *Client) DeleteRecipientHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := c.core.DeleteRecipient(r.Context(), mux.Vars(r)["id"]); err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Client) ListSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	suppressions, err := c.core.ListSuppressions(r.Context())
+	if err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, suppressions)
+}
+
+func (c *Client) PutSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Decode user input, the reason is optional so an empty body is fine
+	var input api.SuppressInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	if err := c.core.Suppress(r.Context(), mux.Vars(r)["address"], input.Reason); err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Client) DeleteSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := c.core.Unsuppress(r.Context(), mux.Vars(r)["address"]); err != nil {
+		c.writeCoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// The message is redacted as provider errors can quote the address they rejected
+func (c *Client) writeCoreError(w http.ResponseWriter, err error) {
+	// Lets the caller send again to only the channels that failed
+	var deliveryErr *core.DeliveryError
+	if errors.As(err, &deliveryErr) {
+		failed := make([]string, len(deliveryErr.Failures))
+		for i, failure := range deliveryErr.Failures {
+			failed[i] = failure.Channel
+		}
+		w.Header().Set(api.HeaderFailedChannels, strings.Join(failed, ","))
+	}
+
+	w.WriteHeader(statusOf(err))
+	fmt.Fprint(w, c.redact.Text(err.Error()))
+}
+
+// Maps the errors core is known to return onto status codes
+func statusOf(err error) int {
+	// Only the caller's fault if every channel turned it away for that,
+	// otherwise a provider failed and it's ours
+	var deliveryErr *core.DeliveryError
+	if errors.As(err, &deliveryErr) {
+		for _, failure := range deliveryErr.Failures {
+			var invalidErr *core.InvalidError
+			if !errors.As(failure.Err, &invalidErr) {
+				return http.StatusInternalServerError
+			}
+		}
+		return http.StatusBadRequest
+	}
+
+	var invalidErr *core.InvalidError
+	switch {
+	case errors.As(err, &invalidErr):
+		return http.StatusBadRequest
+	case errors.Is(err, core.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, core.ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, core.ErrSuppressed):
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
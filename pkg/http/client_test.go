@@ -2,52 +2,156 @@ package http_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	h "net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/api"
+	"github.com/B1scuit/example-pattern-service/pkg/fakes"
 	"github.com/B1scuit/example-pattern-service/pkg/http"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/B1scuit/example-pattern-service/pkg/tracing"
+	"github.com/gorilla/mux"
 )
 
 var errMock = errors.New("mock error")
 
-// Holding the error on the mock logger
-// lets me pull it back out again as the HTTP server
+// Holding the lines written on the mock logger
+// lets me pull them back out again as the HTTP server
 // is run in a go routine and the only feedback is through
 // the logger where it sends what's happened, this allows me to
 // check something was sent to the logger, check TestListenAndServeFail
 type MockLogger struct {
-	Err string
+	mu    sync.Mutex
+	Lines []string
 }
 
-func (ml *MockLogger) Println(in ...any) {
-	ml.Err = fmt.Sprint(in[0])
+func (ml *MockLogger) Write(p []byte) (int, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	ml.Lines = append(ml.Lines, string(p))
+	return len(p), nil
+}
+
+// A JSON logger writing into the mock
+func (ml *MockLogger) Logger() *slog.Logger {
+	return logging.Must(logging.New(&logging.ClientOptions{
+		Writer: ml,
+		Format: logging.FormatJSON,
+	}))
 }
 
+// Returns the last line logged at error level
 func (ml *MockLogger) GetError() error {
-	if ml.Err == "" {
-		return nil
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	for i := len(ml.Lines) - 1; i >= 0; i-- {
+		if strings.Contains(ml.Lines[i], `"level":"ERROR"`) {
+			return errors.New(ml.Lines[i])
+		}
 	}
 
-	return errors.New(ml.Err)
+	return nil
 }
 
-// See internal/core/core_test.go for details around this method
+// See internal/core/core_test.go for details around this method, for a
+// real core behind the server use fakes.HTTPCore instead
 type MockCore struct {
-	Task1Mock func(context.Context, *core.Task1Input) error
+	Task1Mock           func(context.Context, *core.Task1Input) (*core.Task1Output, error)
+	DryRunMock          func(context.Context, *core.Task1Input) (*core.DryRunOutput, error)
+	ScheduledMock       func(context.Context, string) (*core.Task1Output, error)
+	CancelScheduledMock func(context.Context, string) error
+	RescheduleMock      func(context.Context, string, time.Time) error
+
+	GetRecipientMock    func(context.Context, string) (*core.Recipient, error)
+	ListRecipientsMock  func(context.Context) ([]*core.Recipient, error)
+	PutRecipientMock    func(context.Context, *core.Recipient) error
+	DeleteRecipientMock func(context.Context, string) error
+
+	SuppressMock         func(context.Context, string, string) error
+	UnsuppressMock       func(context.Context, string) error
+	ListSuppressionsMock func(context.Context) ([]*core.Suppression, error)
 }
 
-func (mc *MockCore) Task1(ctx context.Context, in *core.Task1Input) error {
+func (mc *MockCore) Task1(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
 	return mc.Task1Mock(ctx, in)
 }
 
+func (mc *MockCore) DryRun(ctx context.Context, in *core.Task1Input) (*core.DryRunOutput, error) {
+	return mc.DryRunMock(ctx, in)
+}
+
+func (mc *MockCore) Scheduled(ctx context.Context, id string) (*core.Task1Output, error) {
+	return mc.ScheduledMock(ctx, id)
+}
+
+func (mc *MockCore) CancelScheduled(ctx context.Context, id string) error {
+	return mc.CancelScheduledMock(ctx, id)
+}
+
+func (mc *MockCore) Reschedule(ctx context.Context, id string, at time.Time) error {
+	return mc.RescheduleMock(ctx, id, at)
+}
+
+func (mc *MockCore) GetRecipient(ctx context.Context, id string) (*core.Recipient, error) {
+	return mc.GetRecipientMock(ctx, id)
+}
+
+func (mc *MockCore) ListRecipients(ctx context.Context) ([]*core.Recipient, error) {
+	return mc.ListRecipientsMock(ctx)
+}
+
+func (mc *MockCore) PutRecipient(ctx context.Context, r *core.Recipient) error {
+	return mc.PutRecipientMock(ctx, r)
+}
+
+func (mc *MockCore) DeleteRecipient(ctx context.Context, id string) error {
+	return mc.DeleteRecipientMock(ctx, id)
+}
+
+func (mc *MockCore) Suppress(ctx context.Context, address, reason string) error {
+	return mc.SuppressMock(ctx, address, reason)
+}
+
+func (mc *MockCore) Unsuppress(ctx context.Context, address string) error {
+	return mc.UnsuppressMock(ctx, address)
+}
+
+func (mc *MockCore) ListSuppressions(ctx context.Context) ([]*core.Suppression, error) {
+	return mc.ListSuppressionsMock(ctx)
+}
+
 var mockCore = &MockCore{
-	Task1Mock: func(ctx context.Context, ti *core.Task1Input) error {
+	Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+		return &core.Task1Output{}, nil
+	},
+	CancelScheduledMock: func(ctx context.Context, s string) error {
+		return nil
+	},
+	RescheduleMock: func(ctx context.Context, s string, t time.Time) error {
+		return nil
+	},
+	GetRecipientMock: func(ctx context.Context, id string) (*core.Recipient, error) {
+		return &core.Recipient{ID: id}, nil
+	},
+	ListRecipientsMock: func(ctx context.Context) ([]*core.Recipient, error) {
+		return []*core.Recipient{}, nil
+	},
+	PutRecipientMock: func(ctx context.Context, r *core.Recipient) error {
+		return nil
+	},
+	DeleteRecipientMock: func(ctx context.Context, id string) error {
 		return nil
 	},
 }
@@ -73,24 +177,24 @@ func TestListenAndServeFail(t *testing.T) {
 
 	client, _ := http.New(&http.ClientOptions{
 		Core:   mockCore,
-		StdLog: &log,
+		Logger: log.Logger(),
 		HttpServer: &h.Server{
 			Addr: "999.999.999.999:1234567688",
 		},
 	})
 
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
 	go func() {
-		if err := client.RunServer(); err != nil {
+		defer close(done)
+		if err := client.RunServer(ctx); err != nil {
 			t.Error(err)
 		}
 	}()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	client.ExposeHttpServer().Shutdown(ctx)
-
-	<-ctx.Done()
+	<-done
 
 	if err := log.GetError(); err == nil {
 		t.Error("error should have been triggered")
@@ -125,11 +229,86 @@ func TestServerRun(t *testing.T) {
 		return
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
 	go func() {
-		if err := client.RunServer(); err != nil {
+		defer close(done)
+		if err := client.RunServer(ctx); err != nil {
 			t.Error(err)
 		}
 	}()
+
+	cancel()
+	<-done
+}
+
+// Records when it was drained, optionally taking longer than it's allowed
+type MockDrainer struct {
+	DrainMock func(context.Context) error
+}
+
+func (md *MockDrainer) Drain(ctx context.Context) error {
+	return md.DrainMock(ctx)
+}
+
+func TestServerDrains(t *testing.T) {
+	var drained []string
+
+	drainer := func(name string) http.Drainer {
+		return &MockDrainer{
+			DrainMock: func(ctx context.Context) error {
+				drained = append(drained, name)
+				return nil
+			},
+		}
+	}
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core:       mockCore,
+		HttpServer: &h.Server{Addr: "127.0.0.1:0"},
+		Drainers:   []http.Drainer{drainer("scheduler"), drainer("core")},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := client.RunServer(ctx); err != nil {
+		t.Error(err)
+	}
+
+	if len(drained) != 2 || drained[0] != "scheduler" || drained[1] != "core" {
+		t.Errorf("unexpected drain order %v", drained)
+	}
+}
+
+func TestServerDrainTimeout(t *testing.T) {
+	var log MockLogger
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core:         mockCore,
+		Logger:       log.Logger(),
+		HttpServer:   &h.Server{Addr: "127.0.0.1:0"},
+		DrainTimeout: 10 * time.Millisecond,
+		Drainers: []http.Drainer{&MockDrainer{
+			DrainMock: func(ctx context.Context) error {
+				<-ctx.Done()
+				return errors.New("2 in-flight notifications abandoned")
+			},
+		}},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := client.RunServer(ctx)
+	if err == nil || !strings.Contains(err.Error(), "2 in-flight notifications abandoned") {
+		t.Errorf("expected abandoned work to be reported, got %v", err)
+	}
+
+	if log.GetError() == nil {
+		t.Error("abandoned work should have been logged")
+	}
 }
 
 func TestTaskHandler(t *testing.T) {
@@ -159,8 +338,8 @@ func TestTaskHandler(t *testing.T) {
 func TestTaskHandlerDecodeFail(t *testing.T) {
 
 	mockCoreClient := &MockCore{
-		Task1Mock: func(ctx context.Context, ti *core.Task1Input) error {
-			return errors.New("Example error")
+		Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+			return nil, errors.New("Example error")
 		},
 	}
 
@@ -189,8 +368,8 @@ func TestTaskHandlerDecodeFail(t *testing.T) {
 
 func TestTaskHandlerFail(t *testing.T) {
 	mockCoreClient := &MockCore{
-		Task1Mock: func(ctx context.Context, ti *core.Task1Input) error {
-			return errors.New("Example error")
+		Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+			return nil, errors.New("Example error")
 		},
 	}
 
@@ -217,6 +396,931 @@ func TestTaskHandlerFail(t *testing.T) {
 	}
 }
 
+func TestTaskHandlerScheduled(t *testing.T) {
+	mockCoreClient := &MockCore{
+		Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+			return &core.Task1Output{ID: "abc", SendAt: ti.SendAt}, nil
+		},
+	}
+
+	httpClient := http.Must(http.New(&http.ClientOptions{
+		Core: mockCoreClient,
+	}))
+
+	req, _ := h.NewRequest("", "", strings.NewReader(`{"send_at": "2030-01-01T09:00:00Z"}`))
+	recorder := httptest.NewRecorder()
+	h.HandlerFunc(httpClient.Task1Handler).ServeHTTP(recorder, req)
+
+	if recorder.Code != h.StatusAccepted {
+		t.Errorf("unexpected status %v", recorder.Code)
+	}
+
+	if !strings.Contains(recorder.Body.String(), `"id":"abc"`) {
+		t.Errorf("id missing from %v", recorder.Body.String())
+	}
+}
+
+func TestTaskHandlerDryRun(t *testing.T) {
+	mockCoreClient := &MockCore{
+		Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+			t.Error("a dry run shouldn't send")
+			return nil, nil
+		},
+		DryRunMock: func(ctx context.Context, ti *core.Task1Input) (*core.DryRunOutput, error) {
+			if ti.To == "" {
+				return nil, core.ErrSuppressed
+			}
+			return &core.DryRunOutput{
+				Deliveries: []*core.Delivery{
+					{Channel: core.ChannelEmail, Status: core.DeliverySend, To: ti.To},
+					{Channel: core.ChannelSMS, Status: core.DeliveryFailed, Error: "bad number 0123456789"},
+				},
+			}, nil
+		},
+	}
+
+	req, _ := h.NewRequest(h.MethodPost, "/?dry_run=true", strings.NewReader(`{"to": "example@example.com"}`))
+	recorder := serve(t, mockCoreClient, req)
+
+	if recorder.Code != h.StatusOK || !strings.Contains(recorder.Body.String(), `"status":"send"`) {
+		t.Errorf("status %v, body %v", recorder.Code, recorder.Body.String())
+	}
+
+	if strings.Contains(recorder.Body.String(), "0123456789") {
+		t.Errorf("number in a delivery error wasn't masked, %v", recorder.Body.String())
+	}
+
+	// Neither time is sent when there isn't one
+	if body := recorder.Body.String(); strings.Contains(body, "send_at") || strings.Contains(body, "deferred_until") {
+		t.Errorf("unset times in %v", body)
+	}
+
+	req, _ = h.NewRequest(h.MethodPost, "/?dry_run=true", strings.NewReader(`{}`))
+	if recorder := serve(t, mockCoreClient, req); recorder.Code != h.StatusUnprocessableEntity {
+		t.Errorf("status %v, want 422 as a send would get", recorder.Code)
+	}
+
+	req, _ = h.NewRequest(h.MethodPost, "/?dry_run=maybe", strings.NewReader(`{}`))
+	if recorder := serve(t, mockCoreClient, req); recorder.Code != h.StatusBadRequest {
+		t.Errorf("status %v, want 400", recorder.Code)
+	}
+}
+
+func TestTaskHandlerInvalid(t *testing.T) {
+	invalid := &core.InvalidError{Err: errors.New("no address for any of email")}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Invalid", invalid, h.StatusBadRequest},
+		{"EveryChannelInvalid", &core.DeliveryError{Failures: []core.ChannelError{{Channel: core.ChannelSMS, Err: invalid}}}, h.StatusBadRequest},
+		{"ProviderFailed", &core.DeliveryError{Failures: []core.ChannelError{
+			{Channel: core.ChannelSMS, Err: invalid},
+			{Channel: core.ChannelEmail, Err: errMock},
+		}}, h.StatusInternalServerError},
+		{"Unknown", errMock, h.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCoreClient := &MockCore{
+				Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+					return nil, tt.err
+				},
+			}
+
+			req, _ := h.NewRequest(h.MethodPost, "/", strings.NewReader(`{}`))
+			if recorder := serve(t, mockCoreClient, req); recorder.Code != tt.want {
+				t.Errorf("status %v, want %v", recorder.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskHandlerShuttingDown(t *testing.T) {
+	mockCoreClient := &MockCore{
+		Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+			return nil, core.ErrShuttingDown
+		},
+	}
+
+	httpClient := http.Must(http.New(&http.ClientOptions{
+		Core: mockCoreClient,
+	}))
+
+	req, _ := h.NewRequest("", "", strings.NewReader(`{}`))
+	recorder := httptest.NewRecorder()
+	h.HandlerFunc(httpClient.Task1Handler).ServeHTTP(recorder, req)
+
+	if recorder.Code != h.StatusServiceUnavailable {
+		t.Errorf("unexpected status %v", recorder.Code)
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	failing := false
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core: mockCore,
+		HealthChecks: map[string]http.HealthChecker{
+			"email": http.HealthCheckFunc(func(ctx context.Context) error {
+				return nil
+			}),
+			"sms": http.HealthCheckFunc(func(ctx context.Context) error {
+				if failing {
+					return errMock
+				}
+				return nil
+			}),
+		},
+		HttpServer: &h.Server{Addr: "127.0.0.1:0"},
+	}))
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req, _ := h.NewRequest(h.MethodGet, path, nil)
+		recorder := httptest.NewRecorder()
+		client.Router().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if got := request("/readyz"); got.Code != h.StatusOK {
+		t.Errorf("ready: status %v, body %v", got.Code, got.Body.String())
+	}
+
+	// A failing dependency takes readiness down but not liveness
+	failing = true
+
+	got := request("/readyz")
+	if got.Code != h.StatusServiceUnavailable || !strings.Contains(got.Body.String(), `"sms":"mock error"`) {
+		t.Errorf("not ready: status %v, body %v", got.Code, got.Body.String())
+	}
+
+	if got := request("/healthz"); got.Code != h.StatusOK {
+		t.Errorf("live: status %v", got.Code)
+	}
+
+	// Shutting down flips readiness regardless of the checks
+	failing = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.RunServer(ctx); err != nil {
+		t.Error(err)
+	}
+
+	got = request("/readyz")
+	if got.Code != h.StatusServiceUnavailable || !strings.Contains(got.Body.String(), "shutting down") {
+		t.Errorf("shutting down: status %v, body %v", got.Code, got.Body.String())
+	}
+}
+
+func TestReadinessGrace(t *testing.T) {
+	// Find a free port for the real server to listen on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core:           mockCore,
+		HttpServer:     &h.Server{Addr: addr},
+		ReadinessGrace: 200 * time.Millisecond,
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- client.RunServer(ctx)
+	}()
+
+	ready := func() int {
+		resp, err := h.Get("http://" + addr + "/readyz")
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Wait for it to start listening
+	for i := 0; ready() != h.StatusOK; i++ {
+		if i == 50 {
+			t.Fatal("server never became ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	if got := ready(); got != h.StatusServiceUnavailable {
+		t.Errorf("during the grace period /readyz should be served as 503, got %v", got)
+	}
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	if got := ready(); got != 0 {
+		t.Errorf("the server should have stopped after the grace period, got %v", got)
+	}
+}
+
+// Records each request reported by the middleware
+type MockRequestMetrics struct {
+	Requests []string
+}
+
+func (mrm *MockRequestMetrics) Request(route, method string, status int, took time.Duration) {
+	mrm.Requests = append(mrm.Requests, fmt.Sprintf("%v %v %v", method, route, status))
+}
+
+func TestMetrics(t *testing.T) {
+	var metrics MockRequestMetrics
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core:    mockCore,
+		Metrics: &metrics,
+		MetricsHandler: h.HandlerFunc(func(w h.ResponseWriter, r *h.Request) {
+			fmt.Fprint(w, "metrics")
+		}),
+	}))
+
+	for _, req := range []struct{ method, path string }{
+		{h.MethodGet, "/v1/recipients/u1"},
+		{h.MethodGet, "/metrics"},
+		{h.MethodGet, "/wp-admin"},
+		{h.MethodPost, "/metrics"},
+	} {
+		req, _ := h.NewRequest(req.method, req.path, nil)
+		recorder := httptest.NewRecorder()
+		client.Router().ServeHTTP(recorder, req)
+	}
+
+	// Unmatched paths share a series, so a scanner can't make one per path
+	want := []string{"GET /v1/recipients/{id} 200", "GET /metrics 200", "GET unmatched 404", "POST unmatched 405"}
+	if fmt.Sprint(metrics.Requests) != fmt.Sprint(want) {
+		t.Errorf("requests %v, want %v", metrics.Requests, want)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	client := http.Must(http.New(&http.ClientOptions{
+		Core: mockCore,
+		SandboxHandler: h.HandlerFunc(func(w h.ResponseWriter, r *h.Request) {
+			fmt.Fprint(w, r.Method+" "+r.URL.Path)
+		}),
+	}))
+
+	for path, want := range map[string]string{
+		"/sandbox/":               "GET /sandbox/",
+		"/sandbox/messages/1/raw": "GET /sandbox/messages/1/raw",
+	} {
+		req, _ := h.NewRequest(h.MethodGet, path, nil)
+		recorder := httptest.NewRecorder()
+		client.Router().ServeHTTP(recorder, req)
+
+		if recorder.Body.String() != want {
+			t.Errorf("%v reached the sandbox as %q", path, recorder.Body.String())
+		}
+	}
+
+	req, _ := h.NewRequest(h.MethodGet, "/sandbox", nil)
+	recorder := httptest.NewRecorder()
+	client.Router().ServeHTTP(recorder, req)
+
+	if recorder.Code != h.StatusMovedPermanently || recorder.Header().Get("Location") != "/sandbox/" {
+		t.Errorf("status %v, location %v", recorder.Code, recorder.Header().Get("Location"))
+	}
+
+	// Without a sandbox there's nothing there
+	req, _ = h.NewRequest(h.MethodGet, "/sandbox/", nil)
+	if recorder := serve(t, mockCore, req); recorder.Code != h.StatusNotFound {
+		t.Errorf("status %v, want 404", recorder.Code)
+	}
+}
+
+// tracing keeps its own span type, this hands it over the way the service does
+type Tracer struct {
+	*tracing.Client
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, core.Span) {
+	return t.Client.Start(ctx, name)
+}
+
+func TestTracing(t *testing.T) {
+	var exporter tracing.MemoryExporter
+	tracer := tracing.Must(tracing.New(&tracing.ClientOptions{Exporter: &exporter}))
+
+	var coreTraceparent string
+	mockCoreClient := &MockCore{
+		Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+			coreTraceparent = tracing.Traceparent(ctx)
+			return nil, errMock
+		},
+	}
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core:   mockCoreClient,
+		Tracer: &Tracer{tracer},
+	}))
+
+	req, _ := h.NewRequest(h.MethodPost, "/", strings.NewReader(`{}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	client.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	tracer.Flush(context.TODO())
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %v spans, want 1", len(spans))
+	}
+
+	span := spans[0]
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("span %+v doesn't continue the caller's trace", span)
+	}
+
+	if span.Name != "POST /" || span.Attributes["http.status_code"] != "500" || span.Error == "" {
+		t.Errorf("unexpected span %+v", span)
+	}
+
+	// Core is handed the request's span so its own spans hang off it
+	if !strings.Contains(coreTraceparent, span.SpanID) {
+		t.Errorf("core saw %q, want span %v", coreTraceparent, span.SpanID)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var log MockLogger
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core:   mockCore,
+		Logger: log.Logger(),
+	}))
+
+	request := func(id string) string {
+		req, _ := h.NewRequest(h.MethodGet, "/healthz", nil)
+		if id != "" {
+			req.Header.Set(http.HeaderRequestID, id)
+		}
+		recorder := httptest.NewRecorder()
+		client.Router().ServeHTTP(recorder, req)
+
+		return recorder.Header().Get(http.HeaderRequestID)
+	}
+
+	if got := request("abc-123"); got != "abc-123" {
+		t.Errorf("request ID %q, want the caller's", got)
+	}
+
+	generated := request("")
+	if generated == "" || generated == request("") {
+		t.Errorf("request IDs should be generated, got %q", generated)
+	}
+
+	if got := request("bad id\n"); got == "bad id\n" {
+		t.Error("unprintable request IDs shouldn't be trusted")
+	}
+
+	if !strings.Contains(log.Lines[0], `"request_id":"abc-123"`) {
+		t.Errorf("request ID missing from %v", log.Lines[0])
+	}
+}
+
+func TestErrorsRedacted(t *testing.T) {
+	mockCoreClient := &MockCore{
+		Task1Mock: func(ctx context.Context, ti *core.Task1Input) (*core.Task1Output, error) {
+			return nil, fmt.Errorf("email: mailbox john@example.com unavailable")
+		},
+	}
+
+	req, _ := h.NewRequest(h.MethodPost, "/", strings.NewReader(`{}`))
+	recorder := serve(t, mockCoreClient, req)
+
+	if got := recorder.Body.String(); got != "email: mailbox j***@example.com unavailable" {
+		t.Errorf("unexpected body %q", got)
+	}
+}
+
+func TestCancelHandler(t *testing.T) {
+	mockCoreClient := &MockCore{
+		CancelScheduledMock: func(ctx context.Context, id string) error {
+			if id != "abc" {
+				return core.ErrNotFound
+			}
+			return nil
+		},
+	}
+
+	httpClient := http.Must(http.New(&http.ClientOptions{
+		Core: mockCoreClient,
+	}))
+
+	tests := map[string]int{
+		"abc":     h.StatusNoContent,
+		"missing": h.StatusNotFound,
+	}
+
+	for id, want := range tests {
+		req, _ := h.NewRequest(h.MethodDelete, "/v1/notifications/"+id, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		recorder := httptest.NewRecorder()
+		h.HandlerFunc(httpClient.CancelHandler).ServeHTTP(recorder, req)
+
+		if recorder.Code != want {
+			t.Errorf("%v: status %v, want %v", id, recorder.Code, want)
+		}
+	}
+}
+
+func TestRescheduleHandler(t *testing.T) {
+	mockCoreClient := &MockCore{
+		RescheduleMock: func(ctx context.Context, id string, at time.Time) error {
+			if id != "abc" {
+				return core.ErrNotFound
+			}
+			if at.IsZero() {
+				return errMock
+			}
+			return nil
+		},
+	}
+
+	httpClient := http.Must(http.New(&http.ClientOptions{
+		Core: mockCoreClient,
+	}))
+
+	tests := []struct {
+		id   string
+		body string
+		want int
+	}{
+		{"abc", `{"send_at": "2030-01-01T09:00:00Z"}`, h.StatusNoContent},
+		{"missing", `{"send_at": "2030-01-01T09:00:00Z"}`, h.StatusNotFound},
+		{"abc", `{}`, h.StatusBadRequest},
+		{"abc", `}`, h.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, _ := h.NewRequest(h.MethodPatch, "/v1/notifications/"+tt.id, strings.NewReader(tt.body))
+		req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+		recorder := httptest.NewRecorder()
+		h.HandlerFunc(httpClient.RescheduleHandler).ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.want {
+			t.Errorf("%v %v: status %v, want %v", tt.id, tt.body, recorder.Code, tt.want)
+		}
+	}
+}
+
+// Runs the request through the full router so path variables and methods
+// are matched as they would be for real
+func serve(t *testing.T, coreClient http.CoreClientInterface, req *h.Request) *httptest.ResponseRecorder {
+	client := http.Must(http.New(&http.ClientOptions{
+		Core: coreClient,
+	}))
+
+	recorder := httptest.NewRecorder()
+	client.Router().ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestRecipientHandlers(t *testing.T) {
+	directory := &fakes.Directory{}
+	directory.Add(&fakes.Recipient{ID: "u1", Email: "example@example.com"})
+
+	coreClient := &fakes.HTTPCore{
+		Core: fakes.Must(fakes.NewCore(&fakes.CoreOptions{Directory: directory})),
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		want     int
+		contains string
+	}{
+		{h.MethodGet, "/v1/recipients", "", h.StatusOK, `"id":"u1"`},
+		{h.MethodGet, "/v1/recipients/u1", "", h.StatusOK, `"email":"example@example.com"`},
+		{h.MethodGet, "/v1/recipients/u2", "", h.StatusNotFound, ""},
+		{h.MethodPut, "/v1/recipients/u3", `{"id": "ignored", "phone": "0123456789"}`, h.StatusOK, `"id":"u3"`},
+		{h.MethodPut, "/v1/recipients/u3", `}`, h.StatusBadRequest, ""},
+		{h.MethodDelete, "/v1/recipients/u1", "", h.StatusNoContent, ""},
+		{h.MethodDelete, "/v1/recipients/u2", "", h.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		req, _ := h.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		recorder := serve(t, coreClient, req)
+
+		if recorder.Code != tt.want {
+			t.Errorf("%v %v: status %v, want %v", tt.method, tt.path, recorder.Code, tt.want)
+		}
+
+		if !strings.Contains(recorder.Body.String(), tt.contains) {
+			t.Errorf("%v %v: %q missing from %v", tt.method, tt.path, tt.contains, recorder.Body.String())
+		}
+	}
+
+	// The bad body never reaches core
+	coreClient.AssertCount(t, len(tests)-1)
+
+	put, _ := directory.Get(context.Background(), "u3")
+	if put == nil || put.ID != "u3" || put.Phone != "0123456789" {
+		t.Errorf("unexpected recipient put %+v", put)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	mockCoreClient := &MockCore{
+		ScheduledMock: func(ctx context.Context, id string) (*core.Task1Output, error) {
+			if id != "abc" {
+				return nil, core.ErrNotFound
+			}
+			return &core.Task1Output{ID: id, SendAt: time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)}, nil
+		},
+	}
+
+	req, _ := h.NewRequest(h.MethodGet, "/v1/notifications/abc", nil)
+	recorder := serve(t, mockCoreClient, req)
+
+	if recorder.Code != h.StatusOK || !strings.Contains(recorder.Body.String(), `"send_at":"2030-01-01T09:00:00Z"`) {
+		t.Errorf("status %v, body %v", recorder.Code, recorder.Body.String())
+	}
+
+	req, _ = h.NewRequest(h.MethodGet, "/v1/notifications/missing", nil)
+	if recorder := serve(t, mockCoreClient, req); recorder.Code != h.StatusNotFound {
+		t.Errorf("status %v, want 404", recorder.Code)
+	}
+}
+
+func TestSuppressionHandlers(t *testing.T) {
+	suppressions := &fakes.Suppressions{}
+	suppressions.Add(context.Background(), "jo@example.com", "bounced")
+	suppressions.Reset()
+
+	coreClient := &fakes.HTTPCore{
+		Core: fakes.Must(fakes.NewCore(&fakes.CoreOptions{Suppressions: suppressions})),
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		want     int
+		contains string
+	}{
+		{h.MethodGet, "/v1/suppressions", "", h.StatusOK, `"reason":"bounced"`},
+		{h.MethodPut, "/v1/suppressions/al@example.com", `{"reason": "complained"}`, h.StatusNoContent, ""},
+		{h.MethodPut, "/v1/suppressions/al@example.com", `}`, h.StatusBadRequest, ""},
+		{h.MethodDelete, "/v1/suppressions/jo@example.com", "", h.StatusNoContent, ""},
+		{h.MethodDelete, "/v1/suppressions/jo@example.com", "", h.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		req, _ := h.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		recorder := serve(t, coreClient, req)
+
+		if recorder.Code != tt.want {
+			t.Errorf("%v %v: status %v, want %v", tt.method, tt.path, recorder.Code, tt.want)
+		}
+
+		if !strings.Contains(recorder.Body.String(), tt.contains) {
+			t.Errorf("%v %v: %q missing from %v", tt.method, tt.path, tt.contains, recorder.Body.String())
+		}
+	}
+
+	// The bad body never reaches core
+	coreClient.AssertCount(t, len(tests)-1)
+
+	suppressions.AssertLast(t, fakes.Call{Method: "Remove", Args: []any{"jo@example.com"}})
+
+	list, _ := suppressions.List(context.Background())
+	if len(list) != 1 || list[0].Address != "al@example.com" || list[0].Reason != "complained" {
+		t.Errorf("unexpected suppressions %+v", list)
+	}
+}
+
+type MockSecret struct {
+	ValueMock func(context.Context) (string, error)
+}
+
+func (ms *MockSecret) Value(ctx context.Context) (string, error) {
+	return ms.ValueMock(ctx)
+}
+
+func TestAPIKey(t *testing.T) {
+	var key = &MockSecret{
+		ValueMock: func(context.Context) (string, error) {
+			return "s3cret", nil
+		},
+	}
+
+	tests := []struct {
+		name   string
+		key    *MockSecret
+		path   string
+		header string
+		want   int
+	}{
+		{"Missing", key, "/v1/recipients", "", h.StatusUnauthorized},
+		{"Wrong", key, "/v1/recipients", "Bearer nope", h.StatusUnauthorized},
+		{"NotBearer", key, "/v1/recipients", "s3cret", h.StatusUnauthorized},
+		{"Right", key, "/v1/recipients", "Bearer s3cret", h.StatusOK},
+		{"HealthOpen", key, "/healthz", "", h.StatusOK},
+		{"SandboxBasic", key, "/sandbox/", "Basic cWE6czNjcmV0", h.StatusOK},
+		{"SandboxBasicWrong", key, "/sandbox/", "Basic cWE6bm9wZQ==", h.StatusUnauthorized},
+		{"SandboxBearer", key, "/sandbox/", "Bearer s3cret", h.StatusOK},
+		{"BasicOnlyForSandbox", key, "/v1/recipients", "Basic cWE6czNjcmV0", h.StatusUnauthorized},
+		{"Unavailable", &MockSecret{
+			ValueMock: func(context.Context) (string, error) {
+				return "", errMock
+			},
+		}, "/v1/recipients", "Bearer s3cret", h.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := http.Must(http.New(&http.ClientOptions{
+				Core:   mockCore,
+				APIKey: tt.key,
+				SandboxHandler: h.HandlerFunc(func(w h.ResponseWriter, r *h.Request) {
+					w.WriteHeader(h.StatusOK)
+				}),
+			}))
+
+			req, _ := h.NewRequest(h.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			recorder := httptest.NewRecorder()
+			client.Router().ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.want {
+				t.Errorf("status %v, want %v", recorder.Code, tt.want)
+			}
+
+			// Browsers are asked for a password only where they can use one
+			challenge := recorder.Header().Get("WWW-Authenticate")
+			if recorder.Code == h.StatusUnauthorized && (tt.path == "/sandbox/") != strings.HasPrefix(challenge, "Basic") {
+				t.Errorf("challenged with %q on %v", challenge, tt.path)
+			}
+		})
+	}
+}
+
+func TestBulkHandler(t *testing.T) {
+	mockCoreClient := &MockCore{
+		Task1Mock: func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+			switch in.To {
+			case "later@example.com":
+				return &core.Task1Output{ID: "abc", SendAt: time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)}, nil
+			case "bounced@example.com":
+				return nil, core.ErrSuppressed
+			case "broken@example.com":
+				return nil, errMock
+			}
+			return &core.Task1Output{}, nil
+		},
+	}
+
+	body := `{"notifications": [
+		{"to": "now@example.com"},
+		{"to": "later@example.com"},
+		{"to": "bounced@example.com"},
+		{"to": "broken@example.com"},
+		null
+	]}`
+
+	req, _ := h.NewRequest(h.MethodPost, "/v1/bulk", strings.NewReader(body))
+	recorder := serve(t, mockCoreClient, req)
+
+	if recorder.Code != h.StatusOK {
+		t.Fatalf("status %v, body %v", recorder.Code, recorder.Body.String())
+	}
+
+	var output api.BulkOutput
+	if err := json.NewDecoder(recorder.Body).Decode(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{h.StatusOK, h.StatusAccepted, h.StatusUnprocessableEntity, h.StatusInternalServerError, h.StatusBadRequest}
+	if len(output.Results) != len(want) {
+		t.Fatalf("%v results, want %v", len(output.Results), len(want))
+	}
+
+	// Results come back in the order they were sent, whatever order they ran in
+	for i, result := range output.Results {
+		if result.Status != want[i] {
+			t.Errorf("result %v: status %v, want %v", i, result.Status, want[i])
+		}
+	}
+
+	if output.Results[1].ID != "abc" || output.Results[3].Error == "" {
+		t.Errorf("unexpected results %+v %+v", output.Results[1], output.Results[3])
+	}
+
+	for _, body := range []string{`}`, `{"notifications": []}`} {
+		req, _ := h.NewRequest(h.MethodPost, "/v1/bulk", strings.NewReader(body))
+		if recorder := serve(t, mockCoreClient, req); recorder.Code != h.StatusBadRequest {
+			t.Errorf("%v: status %v, want 400", body, recorder.Code)
+		}
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	var sent int
+	var fail bool
+
+	mockCoreClient := &MockCore{
+		Task1Mock: func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+			sent++
+			if fail {
+				return nil, errMock
+			}
+			return &core.Task1Output{ID: fmt.Sprint("id-", sent), SendAt: time.Now().Add(time.Hour)}, nil
+		},
+	}
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core: mockCoreClient,
+	}))
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req, _ := h.NewRequest(h.MethodPost, "/", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(api.HeaderIdempotencyKey, key)
+		}
+
+		recorder := httptest.NewRecorder()
+		client.Router().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	t.Run("Replayed", func(t *testing.T) {
+		first := post("k1", `{"to": "example@example.com"}`)
+		second := post("k1", `{"to": "example@example.com"}`)
+
+		if sent != 1 {
+			t.Errorf("sent %v times, want once", sent)
+		}
+
+		if second.Code != first.Code || second.Body.String() != first.Body.String() || second.Header().Get(http.HeaderIdempotentReplayed) != "true" {
+			t.Errorf("replay %v %v, first %v %v", second.Code, second.Body.String(), first.Code, first.Body.String())
+		}
+	})
+
+	t.Run("DifferentRequest", func(t *testing.T) {
+		if recorder := post("k1", `{"to": "other@example.com"}`); recorder.Code != h.StatusConflict {
+			t.Errorf("status %v, want 409", recorder.Code)
+		}
+	})
+
+	t.Run("DryRunIsDifferent", func(t *testing.T) {
+		mockCoreClient.DryRunMock = func(ctx context.Context, in *core.Task1Input) (*core.DryRunOutput, error) {
+			return &core.DryRunOutput{}, nil
+		}
+
+		req, _ := h.NewRequest(h.MethodPost, "/?dry_run=true", strings.NewReader(`{"to": "example@example.com"}`))
+		req.Header.Set(api.HeaderIdempotencyKey, "k1")
+
+		recorder := httptest.NewRecorder()
+		client.Router().ServeHTTP(recorder, req)
+
+		if recorder.Code != h.StatusConflict {
+			t.Errorf("status %v, a dry run shouldn't be answered with the send's response", recorder.Code)
+		}
+	})
+
+	t.Run("WithoutKey", func(t *testing.T) {
+		sent = 0
+		post("", `{"to": "example@example.com"}`)
+		post("", `{"to": "example@example.com"}`)
+
+		if sent != 2 {
+			t.Errorf("sent %v times, want twice", sent)
+		}
+	})
+
+	t.Run("ShuttingDownRetried", func(t *testing.T) {
+		sent, fail = 0, true
+		mockCoreClient.Task1Mock = func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+			sent++
+			if fail {
+				return nil, core.ErrShuttingDown
+			}
+			return &core.Task1Output{ID: fmt.Sprint("id-", sent), SendAt: time.Now().Add(time.Hour)}, nil
+		}
+		post("k2", `{"to": "example@example.com"}`)
+
+		fail = false
+		if recorder := post("k2", `{"to": "example@example.com"}`); recorder.Code != h.StatusAccepted || sent != 2 {
+			t.Errorf("status %v after %v sends, nothing was done so it should run again", recorder.Code, sent)
+		}
+	})
+}
+
+// A delivery that failed part way through has already sent some of it,
+// the retry is answered with the failure rather than sending it again
+func TestIdempotencyPartialFailure(t *testing.T) {
+	notifications := fakes.Must(fakes.NewCore(&fakes.CoreOptions{}))
+	notifications.SMS.FailAlways(errMock)
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core: notifications,
+	}))
+
+	post := func() *httptest.ResponseRecorder {
+		req, _ := h.NewRequest(h.MethodPost, "/", strings.NewReader(`{"to": "example@example.com", "number": "0123456789"}`))
+		req.Header.Set(api.HeaderIdempotencyKey, "partial")
+
+		recorder := httptest.NewRecorder()
+		client.Router().ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	first := post()
+	if first.Code != h.StatusInternalServerError || first.Header().Get(api.HeaderFailedChannels) != core.ChannelSMS {
+		t.Fatalf("status %v failed on %q, want 500 for the failed SMS", first.Code, first.Header().Get(api.HeaderFailedChannels))
+	}
+
+	second := post()
+	if second.Code != first.Code || second.Header().Get(http.HeaderIdempotentReplayed) != "true" {
+		t.Errorf("retry got %v, want the first answer replayed", second.Code)
+	}
+
+	notifications.Email.AssertCount(t, 1)
+}
+
+// Only so many answers are kept, the oldest go first
+func TestIdempotencyLimit(t *testing.T) {
+	var sent int
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core: &MockCore{
+			Task1Mock: func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+				sent++
+				return &core.Task1Output{}, nil
+			},
+		},
+		IdempotencyMaxEntries: 2,
+	}))
+
+	for _, key := range []string{"k1", "k2", "k3", "k3", "k2", "k1"} {
+		req, _ := h.NewRequest(h.MethodPost, "/", strings.NewReader(`{}`))
+		req.Header.Set(api.HeaderIdempotencyKey, key)
+		client.Router().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// k3 and k2 were replayed, k1 had been dropped to make room
+	if sent != 4 {
+		t.Errorf("sent %v times, want 4", sent)
+	}
+}
+
+// A key used by one API key means nothing under another
+func TestIdempotencyScoped(t *testing.T) {
+	var sent int
+	apiKey := "first"
+
+	client := http.Must(http.New(&http.ClientOptions{
+		Core: &MockCore{
+			Task1Mock: func(ctx context.Context, in *core.Task1Input) (*core.Task1Output, error) {
+				sent++
+				return &core.Task1Output{}, nil
+			},
+		},
+		APIKey: &MockSecret{
+			ValueMock: func(context.Context) (string, error) {
+				return apiKey, nil
+			},
+		},
+	}))
+
+	for _, key := range []string{"first", "first", "second"} {
+		apiKey = key
+
+		req, _ := h.NewRequest(h.MethodPost, "/", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set(api.HeaderIdempotencyKey, "shared")
+		client.Router().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if sent != 2 {
+		t.Errorf("sent %v times, want once for each API key", sent)
+	}
+}
+
 func TestMustPanic(t *testing.T) {
 	// This deferal function allows for the testing
 	//of panics as it blocks the os.Exit using recover()
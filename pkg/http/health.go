@@ -0,0 +1,104 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Anything the service depends on that can tell us whether it's usable right
+// now, a nil error is healthy. The email, sms, scheduler and directory
+// clients all implement this
+type HealthChecker interface {
+	Check(context.Context) error
+}
+
+// Lets a plain function be used as a HealthChecker
+type HealthCheckFunc func(context.Context) error
+
+func (f HealthCheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// The body /readyz responds with, checks are keyed by the name they were
+// registered under and hold "ok" or the error that failed them
+type HealthOutput struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+	healthShutdown    = "shutting down"
+)
+
+// Liveness only says the process is up and serving, it deliberately
+// doesn't look at dependencies so a flaky provider never gets us restarted
+func (c *Client) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &HealthOutput{Status: healthOK})
+}
+
+// Readiness runs every check and only reports ready when all of them pass,
+// once shutdown has started it reports not ready without asking anyone so
+// the load balancer stops sending us traffic
+func (c *Client) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&c.shuttingDown) == 1 {
+		writeJSON(w, http.StatusServiceUnavailable, &HealthOutput{Status: healthShutdown})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.healthTimeout)
+	defer cancel()
+
+	output := &HealthOutput{
+		Status: healthOK,
+		Checks: c.runChecks(ctx),
+	}
+
+	status := http.StatusOK
+	for _, result := range output.Checks {
+		if result != healthOK {
+			output.Status = healthUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, status, output)
+}
+
+// Checks run side by side so one slow dependency doesn't eat the others' time
+func (c *Client) runChecks(ctx context.Context) map[string]string {
+	names := make([]string, 0, len(c.healthChecks))
+	for name := range c.healthChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]string, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		i, checker := i, c.healthChecks[name]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results[i] = healthOK
+			if err := checker.Check(ctx); err != nil {
+				results[i] = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	checks := make(map[string]string, len(names))
+	for i, name := range names {
+		checks[name] = results[i]
+	}
+
+	return checks
+}
@@ -0,0 +1,230 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/api"
+)
+
+// Set on a response that's a replay of the first one sent under its key
+const HeaderIdempotentReplayed = api.HeaderIdempotentReplayed
+
+// Answers to requests sent with an Idempotency-Key, held in memory so a
+// retry that lands on another instance, or after a restart, is sent again.
+// Entries go once they've expired, swept on a ticker while the server runs,
+// and the oldest are dropped first once there are too many
+type idempotency struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*idempotentEntry
+
+	// Oldest first, may still hold entries that have since gone
+	order []*idempotentEntry
+}
+
+type idempotentEntry struct {
+	key string
+
+	// The request the key was first used with, another under the same
+	// key is refused rather than answered with the wrong response
+	fingerprint [sha256.Size]byte
+
+	// Closed once the first request has been answered
+	done chan struct{}
+
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+func newIdempotency(ttl time.Duration, maxEntries int) *idempotency {
+	return &idempotency{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*idempotentEntry{},
+	}
+}
+
+// Returns the entry for the key, and whether this request is the first
+// with it and so the one that should run
+func (i *idempotency) claim(key string, fingerprint [sha256.Size]byte) (*idempotentEntry, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if entry, ok := i.entries[key]; ok && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
+		return entry, false
+	}
+
+	// A request still running when its entry is dropped finishes as normal,
+	// only its retries lose the answer
+	for len(i.entries) >= i.maxEntries && len(i.order) > 0 {
+		oldest := i.order[0]
+		i.order = i.order[1:]
+		i.forget(oldest)
+	}
+
+	entry := &idempotentEntry{key: key, fingerprint: fingerprint, done: make(chan struct{})}
+	i.entries[key] = entry
+	i.order = append(i.order, entry)
+
+	return entry, true
+}
+
+// Keeps the answer for the key's retries, unless nothing was done and the
+// retry can safely run again, which is only so when we were shutting down or
+// turned the request away as too many. A 500 may follow a partial delivery,
+// an email gone out before the SMS failed, running it again sends it twice
+func (i *idempotency) finish(entry *idempotentEntry, recorder *bodyRecorder) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entry.status = recorder.status
+	entry.contentType = recorder.Header().Get("Content-Type")
+	entry.body = recorder.body.Bytes()
+	entry.expires = time.Now().Add(i.ttl)
+
+	if recorder.status == http.StatusTooManyRequests || recorder.status == http.StatusServiceUnavailable {
+		i.forget(entry)
+	}
+
+	close(entry.done)
+}
+
+// Drops the entry unless its key has already moved on to another
+func (i *idempotency) forget(entry *idempotentEntry) {
+	if i.entries[entry.key] == entry {
+		delete(i.entries, entry.key)
+	}
+}
+
+// Drops every entry expired by now
+func (i *idempotency) expire(now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	kept := i.order[:0]
+	for _, entry := range i.order {
+		if i.entries[entry.key] != entry {
+			continue
+		}
+
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(i.entries, entry.key)
+			continue
+		}
+
+		kept = append(kept, entry)
+	}
+
+	// Cleared so the dropped entries' bodies can be collected
+	for j := len(kept); j < len(i.order); j++ {
+		i.order[j] = nil
+	}
+	i.order = kept
+}
+
+// Sweeps out expired entries every interval until ctx is done
+func (i *idempotency) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			i.expire(now)
+		}
+	}
+}
+
+// Holds onto what's written so it can be given to the key's retries
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (br *bodyRecorder) WriteHeader(status int) {
+	br.status = status
+	br.ResponseWriter.WriteHeader(status)
+}
+
+func (br *bodyRecorder) Write(b []byte) (int, error) {
+	br.body.Write(b)
+	return br.ResponseWriter.Write(b)
+}
+
+// Answers a POST carrying an Idempotency-Key that's been seen before with
+// the response to the first, waiting for it if it's still running
+func (c *Client) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(api.HeaderIdempotencyKey)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Idempotency-Key is too long")
+			return
+		}
+
+		// The body is read up front so it can be compared with the first
+		// request's, then handed on as if it hadn't been. The query is part of
+		// the request, a dry run under a send's key isn't the send
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := sha256.Sum256(append([]byte(r.URL.RequestURI()+"\n"), body...))
+
+		// Keys are the caller's own, scoped by the API key they authenticated
+		// with so no one else can be answered with their response
+		scope := sha256.Sum256([]byte(authenticatedKey(r.Context())))
+		key = hex.EncodeToString(scope[:]) + "\x00" + key
+
+		entry, first := c.idempotency.claim(key, fingerprint)
+		if first {
+			recorder := &bodyRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			c.idempotency.finish(entry, recorder)
+			return
+		}
+
+		if entry.fingerprint != fingerprint {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, "Idempotency-Key was already used for a different request")
+			return
+		}
+
+		select {
+		case <-entry.done:
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if entry.contentType != "" {
+			w.Header().Set("Content-Type", entry.contentType)
+		}
+		w.Header().Set(HeaderIdempotentReplayed, "true")
+		w.WriteHeader(entry.status)
+		w.Write(entry.body)
+	})
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/gorilla/mux"
+)
+
+// Told about every request the router handles, pkg/metrics implements this
+type RequestMetrics interface {
+	Request(route, method string, status int, took time.Duration)
+}
+
+// Starts a span per request, continuing the caller's trace when they sent
+// a traceparent header. pkg/tracing implements this
+type Tracer interface {
+	Extract(ctx context.Context, traceparent string) context.Context
+	Start(ctx context.Context, name string) (context.Context, core.Span)
+}
+
+// Used when no metrics are passed
+type noopRequestMetrics struct{}
+
+func (noopRequestMetrics) Request(string, string, int, time.Duration) {}
+
+// Used when no tracer is passed
+type noopTracer struct{}
+
+func (noopTracer) Extract(ctx context.Context, traceparent string) context.Context {
+	return ctx
+}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, core.Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, string) {}
+func (noopSpan) End(error)                   {}
+
+// Remembers the status written so it can be reported once the handler returns
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// The header request IDs are read from and written to
+const HeaderRequestID = "X-Request-ID"
+
+// Keeps the caller's ID when they sent a sensible one so their logs and
+// ours line up, otherwise makes one up
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(HeaderRequestID); id != "" && len(id) <= 128 && isPrintable(id) {
+		return id
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The route 404s and 405s are reported against
+const routeUnmatched = "unmatched"
+
+// Times and traces each request, reporting it against the route template
+// rather than the path, so /v1/recipients/{id} is one series not one per
+// recipient
+func (c *Client) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Anything that matched no route shares one series, rather than
+		// one per path a scanner tries
+		route := routeUnmatched
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		// Every line logged while handling the request carries its ID, and
+		// so does the response so callers can quote it back to us
+		requestID := requestID(r)
+		w.Header().Set(HeaderRequestID, requestID)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		ctx = c.tracer.Extract(ctx, r.Header.Get("traceparent"))
+		ctx, span := c.tracer.Start(ctx, r.Method+" "+route)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		took := time.Since(start)
+		c.metrics.Request(route, r.Method, recorder.status, took)
+
+		c.logger.InfoContext(ctx, "Request handled",
+			"method", r.Method, "route", route, "status", recorder.status, "duration", took)
+
+		span.SetAttribute("http.status_code", strconv.Itoa(recorder.status))
+
+		// Only our failures mark the span, a 4xx is the caller's problem
+		var err error
+		if recorder.status >= http.StatusInternalServerError {
+			err = fmt.Errorf("responded %v", http.StatusText(recorder.status))
+		}
+		span.End(err)
+	})
+}
@@ -0,0 +1,142 @@
+// logging
+//
+// Builds the *slog.Logger every package logs through. The handler it wraps adds the
+// request ID and message ID carried in the context to each line, so anything logged
+// while handling a request or sending a notification can be tied back to it
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
+)
+
+// The formats New can write
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type ClientOptions struct {
+	// Defaults to stdout
+	Writer io.Writer
+
+	// FormatText or FormatJSON, defaults to text
+	Format string
+
+	// debug, info, warn or error, defaults to info
+	Level string
+
+	// Masks addresses and content in every line, defaults to the redact
+	// package defaults, pass one with Disabled set to log everything
+	Redact *redact.Client
+
+	// Optional, reads the ID of the notification being sent from the
+	// context, core.MessageID, so lines logged while sending carry it
+	MessageID func(context.Context) string
+}
+
+func New(opts *ClientOptions) (*slog.Logger, error) {
+
+	if opts.Writer == nil {
+		opts.Writer = os.Stdout
+	}
+
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Redact == nil {
+		opts.Redact = redact.Must(redact.New(&redact.ClientOptions{}))
+	}
+
+	handlerOpts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: opts.Redact.ReplaceAttr,
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(opts.Writer, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(opts.Writer, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	if opts.MessageID == nil {
+		opts.MessageID = func(context.Context) string { return "" }
+	}
+
+	return slog.New(&contextHandler{handler, opts.MessageID}), nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(logger *slog.Logger, err error) *slog.Logger {
+	if err != nil {
+		panic(err)
+	}
+
+	return logger
+}
+
+// ParseLevel reads a level name, an empty name is info
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name == "" {
+		return level, nil
+	}
+
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level %q", name)
+	}
+
+	return level, nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the request being handled
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, empty outside of one
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Adds the IDs found in the context to every record before passing it on
+type contextHandler struct {
+	slog.Handler
+
+	messageID func(context.Context) string
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	if id := h.messageID(ctx); id != "" {
+		record.AddAttrs(slog.String("message_id", id))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs), h.messageID}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name), h.messageID}
+}
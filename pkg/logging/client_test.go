@@ -0,0 +1,133 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/internal/core"
+	"github.com/B1scuit/example-pattern-service/pkg/logging"
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
+)
+
+var errMock = errors.New("mock error")
+
+func TestNewClient(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := logging.New(&logging.ClientOptions{
+		Writer:    &buf,
+		Format:    logging.FormatJSON,
+		Level:     "debug",
+		MessageID: core.MessageID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := logging.WithRequestID(context.TODO(), "req-1")
+	ctx = core.WithMessageID(ctx, "msg-1")
+
+	logger.With("component", "test").DebugContext(ctx, "Sending", "to", "example@example.com")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"level":      "DEBUG",
+		"msg":        "Sending",
+		"component":  "test",
+		"to":         "e***@example.com",
+		"request_id": "req-1",
+		"message_id": "msg-1",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%v = %v, want %v", key, line[key], value)
+		}
+	}
+}
+
+func TestRedactionDisabled(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := logging.Must(logging.New(&logging.ClientOptions{
+		Writer: &buf,
+		Redact: redact.Must(redact.New(&redact.ClientOptions{Disabled: true})),
+	}))
+
+	logger.Info("Sending", "to", "example@example.com", "body", "Hello")
+
+	if got := buf.String(); !strings.Contains(got, "to=example@example.com body=Hello") {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := logging.Must(logging.New(&logging.ClientOptions{
+		Writer: &buf,
+		Level:  "warn",
+	}))
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=shown") {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := map[string]*logging.ClientOptions{
+		"format": {Format: "xml"},
+		"level":  {Level: "loud"},
+	}
+
+	for name, opts := range tests {
+		if _, err := logging.New(opts); err == nil {
+			t.Errorf("%v: error should have been returned", name)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := logging.ParseLevel(""); err != nil || level != slog.LevelInfo {
+		t.Errorf("empty level = %v, %v", level, err)
+	}
+
+	if level, err := logging.ParseLevel("ERROR"); err != nil || level != slog.LevelError {
+		t.Errorf("ERROR = %v, %v", level, err)
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	logging.Must(slog.Default(), nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	logging.Must(slog.Default(), errMock)
+}
@@ -0,0 +1,317 @@
+// metrics
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, holding counters, gauges and histograms and serving them in
+// the Prometheus text format on /metrics. It's deliberately small, just enough of the
+// exposition format for a Prometheus server to scrape us without pulling in the client library
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Latency buckets in seconds, the same defaults the Prometheus client uses
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Optional, prefixed to every metric name with an underscore
+	Namespace string
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	namespace string
+
+	mu       sync.Mutex
+	families []family
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "metrics")
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		namespace: opts.Namespace,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Everything the handler writes out, one per metric name
+type family interface {
+	write(w *strings.Builder)
+}
+
+func (c *Client) register(f family) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.families = append(c.families, f)
+}
+
+func (c *Client) name(name string) string {
+	if c.namespace == "" {
+		return name
+	}
+
+	return c.namespace + "_" + name
+}
+
+// Counter registers a counter partitioned by the given label names
+func (c *Client) Counter(name, help string, labels ...string) *Counter {
+	counter := &Counter{
+		series: series{name: c.name(name), help: help, kind: "counter", labels: labels},
+	}
+	c.register(counter)
+
+	return counter
+}
+
+// Gauge registers a gauge whose value is read from fn on every scrape,
+// handy for things that are already counted elsewhere like queue depth
+func (c *Client) Gauge(name, help string, fn func() float64) {
+	c.register(&gauge{
+		name: c.name(name),
+		help: help,
+		fn:   fn,
+	})
+}
+
+// Histogram registers a histogram partitioned by the given label names,
+// DefaultBuckets are used when buckets is empty
+func (c *Client) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	histogram := &Histogram{
+		series:  series{name: c.name(name), help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  map[string]*histogramValue{},
+	}
+	c.register(histogram)
+
+	return histogram
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format
+func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	families := append([]family(nil), c.families...)
+	c.mu.Unlock()
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := fmt.Fprint(w, b.String()); err != nil {
+		c.logger.ErrorContext(r.Context(), "Writing metrics failed", "error", err)
+	}
+}
+
+// What counters and histograms share, the name and the label names values
+// are recorded against, each combination of label values is its own series
+type series struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu sync.Mutex
+}
+
+var errLabelCount = errors.New("label values don't match label names")
+
+// Builds the {a="b",c="d"} part of a line, the key series are stored under
+func (s *series) key(values []string) string {
+	if len(values) != len(s.labels) {
+		panic(fmt.Sprintf("%v: %v", s.name, errLabelCount))
+	}
+
+	return labelString(s.labels, values)
+}
+
+func labelString(names, values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = names[i] + `="` + escape(value) + `"`
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (s *series) header(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %v %v\n", s.name, s.help)
+	fmt.Fprintf(b, "# TYPE %v %v\n", s.name, s.kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Sorted so scrapes are stable and easy to diff
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+type Counter struct {
+	series
+
+	values map[string]float64
+}
+
+// Inc adds one to the series for the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the series for the label values, counters only go up so
+// negative values are ignored
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+
+	key := c.key(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		c.values = map[string]float64{}
+	}
+	c.values[key] += v
+}
+
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(b)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%v%v %v\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+type gauge struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *gauge) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %v %v\n", g.name, g.help)
+	fmt.Fprintf(b, "# TYPE %v gauge\n", g.name)
+	fmt.Fprintf(b, "%v %v\n", g.name, formatFloat(g.fn()))
+}
+
+type Histogram struct {
+	series
+
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe records v against the series for the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{
+			labels: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = value
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			value.counts[i]++
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+func (h *Histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(b)
+	for _, key := range sortedKeys(h.values) {
+		value := h.values[key]
+
+		// Buckets carry an extra le label alongside the series' own
+		names := append(append([]string(nil), h.labels...), "le")
+		bucketKey := func(bound float64) string {
+			return labelString(names, append(append([]string(nil), value.labels...), formatFloat(bound)))
+		}
+
+		for i, bound := range h.buckets {
+			fmt.Fprintf(b, "%v_bucket%v %v\n", h.name, bucketKey(bound), value.counts[i])
+		}
+		fmt.Fprintf(b, "%v_bucket%v %v\n", h.name, bucketKey(math.Inf(1)), value.count)
+		fmt.Fprintf(b, "%v_sum%v %v\n", h.name, key, formatFloat(value.sum))
+		fmt.Fprintf(b, "%v_count%v %v\n", h.name, key, value.count)
+	}
+}
@@ -0,0 +1,133 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/metrics"
+)
+
+var errMock = errors.New("mock error")
+
+func scrape(t *testing.T, client *metrics.Client) string {
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("unexpected status %v", recorder.Code)
+	}
+
+	return recorder.Body.String()
+}
+
+func TestNewClient(t *testing.T) {
+	client := metrics.Must(metrics.New(&metrics.ClientOptions{Namespace: "test"}))
+
+	counter := client.Counter("sent_total", "Messages sent.", "channel")
+	counter.Inc("sms")
+	counter.Add(2, "email")
+	counter.Add(-1, "email")
+
+	client.Gauge("depth", "Queue depth.", func() float64 { return 3 })
+
+	histogram := client.Histogram("took_seconds", "Time taken.", []float64{1, 0.1}, "channel")
+	histogram.Observe(0.05, "sms")
+	histogram.Observe(0.5, "sms")
+	histogram.Observe(5, "sms")
+
+	got := scrape(t, client)
+
+	for _, want := range []string{
+		"# TYPE test_sent_total counter\n",
+		`test_sent_total{channel="email"} 2` + "\n",
+		`test_sent_total{channel="sms"} 1` + "\n",
+		"# TYPE test_depth gauge\ntest_depth 3\n",
+		"# TYPE test_took_seconds histogram\n",
+		`test_took_seconds_bucket{channel="sms",le="0.1"} 1` + "\n",
+		`test_took_seconds_bucket{channel="sms",le="1"} 2` + "\n",
+		`test_took_seconds_bucket{channel="sms",le="+Inf"} 3` + "\n",
+		`test_took_seconds_sum{channel="sms"} 5.55` + "\n",
+		`test_took_seconds_count{channel="sms"} 3` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q from:\n%v", want, got)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	client := metrics.Must(metrics.New(&metrics.ClientOptions{}))
+
+	client.Counter("errors_total", "Errors.", "reason").Inc("bad \"quote\"\nline")
+
+	if got := scrape(t, client); !strings.Contains(got, `errors_total{reason="bad \"quote\"\nline"} 1`) {
+		t.Errorf("label not escaped:\n%v", got)
+	}
+}
+
+func TestLabelMismatchPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	client := metrics.Must(metrics.New(&metrics.ClientOptions{}))
+	client.Counter("sent_total", "Messages sent.", "channel").Inc()
+}
+
+func TestNotifications(t *testing.T) {
+	client := metrics.Must(metrics.New(&metrics.ClientOptions{}))
+	notifications := metrics.NewNotifications(client)
+
+	notifications.Request("/v1/recipients/{id}", http.MethodGet, http.StatusNotFound, time.Millisecond)
+	notifications.Delivered("sms", "failed", time.Second)
+	notifications.Deferred("sms")
+	notifications.Suppressed("email")
+	notifications.Retried("webhook")
+
+	got := scrape(t, client)
+
+	for _, want := range []string{
+		`http_requests_total{route="/v1/recipients/{id}",method="GET",status="404"} 1`,
+		`http_request_duration_seconds_count{route="/v1/recipients/{id}",method="GET"} 1`,
+		`notification_deliveries_total{channel="sms",outcome="failed"} 1`,
+		`notification_delivery_duration_seconds_sum{channel="sms",outcome="failed"} 1`,
+		`notification_deferred_total{channel="sms"} 1`,
+		`notification_suppressed_total{channel="email"} 1`,
+		`notification_retries_total{channel="webhook"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q from:\n%v", want, got)
+		}
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	metrics.Must(&metrics.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	metrics.Must(&metrics.Client{}, errMock)
+}
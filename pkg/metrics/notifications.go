@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Notifications holds the metrics the service exports, its methods line up
+// with the interfaces core and pkg/http report through so it can be handed
+// straight to both without either knowing about Prometheus
+type Notifications struct {
+	requests        *Counter
+	requestDuration *Histogram
+
+	deliveries       *Counter
+	deliveryDuration *Histogram
+	deferred         *Counter
+	suppressed       *Counter
+	retries          *Counter
+}
+
+func NewNotifications(c *Client) *Notifications {
+	return &Notifications{
+		requests: c.Counter("http_requests_total",
+			"HTTP requests handled, by route, method and status.", "route", "method", "status"),
+		requestDuration: c.Histogram("http_request_duration_seconds",
+			"How long HTTP requests took to handle, by route and method.", nil, "route", "method"),
+
+		deliveries: c.Counter("notification_deliveries_total",
+			"Messages handed to a channel, by channel and outcome.", "channel", "outcome"),
+		deliveryDuration: c.Histogram("notification_delivery_duration_seconds",
+			"How long channels took to send a message, by channel and outcome.", nil, "channel", "outcome"),
+		deferred: c.Counter("notification_deferred_total",
+			"Messages held back by quiet hours, by channel.", "channel"),
+		suppressed: c.Counter("notification_suppressed_total",
+			"Addresses skipped because they are on the suppression list, by channel.", "channel"),
+		retries: c.Counter("notification_retries_total",
+			"Delivery attempts retried by a channel client, by channel.", "channel"),
+	}
+}
+
+// Request is called by pkg/http once a request has been handled
+func (n *Notifications) Request(route, method string, status int, took time.Duration) {
+	n.requests.Inc(route, method, strconv.Itoa(status))
+	n.requestDuration.Observe(took.Seconds(), route, method)
+}
+
+// Delivered is called by core after every channel send
+func (n *Notifications) Delivered(channel, outcome string, took time.Duration) {
+	n.deliveries.Inc(channel, outcome)
+	n.deliveryDuration.Observe(took.Seconds(), channel, outcome)
+}
+
+// Deferred is called by core when quiet hours hold a message back
+func (n *Notifications) Deferred(channel string) {
+	n.deferred.Inc(channel)
+}
+
+// Suppressed is called by core for each address the suppression list skips
+func (n *Notifications) Suppressed(channel string) {
+	n.suppressed.Inc(channel)
+}
+
+// Retried is for channel clients that retry on their own, like webhooks
+func (n *Notifications) Retried(channel string) {
+	n.retries.Inc(channel)
+}
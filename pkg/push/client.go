@@ -0,0 +1,287 @@
+// push
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, sending mobile push notifications to device tokens through
+// either an APNs or an FCM style HTTP/2 JSON API. Tokens the provider says are no longer
+// valid are handed to OnInvalidToken so whoever owns them can prune them
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	ProviderAPNs = "apns"
+	ProviderFCM  = "fcm"
+)
+
+// Returned, wrapped, when a provider rejects a token as unknown or expired
+var ErrInvalidToken = errors.New("invalid device token")
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Needs to speak HTTP/2 for APNs, the default does
+	HttpClient *http.Client
+
+	// Either ProviderAPNs or ProviderFCM
+	Provider string
+
+	// Defaults to the provider's production endpoint
+	BaseURL string
+
+	// Sent as a bearer token, a provider JWT for APNs or an OAuth token for FCM
+	AuthToken string
+
+	// APNs only, the app's bundle ID
+	Topic string
+
+	// FCM only, the project the app belongs to
+	ProjectID string
+
+	// Optional, called for every token the provider rejects
+	OnInvalidToken func(ctx context.Context, token string)
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	httpClient *http.Client
+
+	provider  string
+	baseURL   string
+	authToken string
+	topic     string
+	projectID string
+
+	onInvalidToken func(ctx context.Context, token string)
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "push")
+	}
+
+	if opts.HttpClient == nil {
+		opts.HttpClient = &http.Client{
+			Transport: &http.Transport{ForceAttemptHTTP2: true},
+		}
+	}
+
+	switch opts.Provider {
+	case ProviderAPNs:
+		if opts.BaseURL == "" {
+			opts.BaseURL = "https://api.push.apple.com"
+		}
+		if opts.Topic == "" {
+			return nil, errors.New("apns topic missing")
+		}
+	case ProviderFCM:
+		if opts.BaseURL == "" {
+			opts.BaseURL = "https://fcm.googleapis.com"
+		}
+		if opts.ProjectID == "" {
+			return nil, errors.New("fcm project id missing")
+		}
+	default:
+		return nil, fmt.Errorf("unknown push provider %q", opts.Provider)
+	}
+
+	if opts.OnInvalidToken == nil {
+		opts.OnInvalidToken = func(ctx context.Context, token string) {}
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		httpClient: opts.HttpClient,
+
+		provider:  opts.Provider,
+		baseURL:   strings.TrimSuffix(opts.BaseURL, "/"),
+		authToken: opts.AuthToken,
+		topic:     opts.Topic,
+		projectID: opts.ProjectID,
+
+		onInvalidToken: opts.OnInvalidToken,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Send pushes to every device token in to, a recipient with several devices
+// lists them separated by commas. It succeeds if any device was reached
+func (c *Client) Send(ctx context.Context, to, subject, body string) error {
+	var tokens []string
+	for _, token := range strings.Split(to, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+
+	if len(tokens) == 0 {
+		return errors.New("device token missing")
+	}
+
+	var errs []string
+	delivered := 0
+
+	for _, token := range tokens {
+		err := c.sendOne(ctx, token, subject, body)
+		if errors.Is(err, ErrInvalidToken) {
+			c.logger.WarnContext(ctx, "Pruning device token", "provider", c.provider, "error", err)
+			c.onInvalidToken(ctx, token)
+		}
+
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		delivered++
+	}
+
+	if delivered == 0 {
+		return fmt.Errorf("push failed: %v", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (c *Client) sendOne(ctx context.Context, token, subject, body string) error {
+	if c.provider == ProviderAPNs {
+		return c.sendAPNs(ctx, token, subject, body)
+	}
+
+	return c.sendFCM(ctx, token, subject, body)
+}
+
+type apnsPayload struct {
+	APS struct {
+		Alert struct {
+			Title string `json:"title,omitempty"`
+			Body  string `json:"body"`
+		} `json:"alert"`
+	} `json:"aps"`
+}
+
+func (c *Client) sendAPNs(ctx context.Context, token, subject, body string) error {
+	var payload apnsPayload
+	payload.APS.Alert.Title = subject
+	payload.APS.Alert.Body = body
+
+	resp, err := c.post(ctx, c.baseURL+"/3/device/"+url.PathEscape(token), &payload, map[string]string{
+		"apns-topic":     c.topic,
+		"apns-push-type": "alert",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var result struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&result)
+
+	// 410 means the app was removed from the device, the bad token reasons
+	// mean the token was never valid for this app
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		result.Reason == "BadDeviceToken",
+		result.Reason == "DeviceTokenNotForTopic",
+		result.Reason == "Unregistered":
+		return fmt.Errorf("%w: %v", ErrInvalidToken, result.Reason)
+	}
+
+	return fmt.Errorf("apns responded %v: %v", resp.Status, result.Reason)
+}
+
+type fcmPayload struct {
+	Message struct {
+		Token        string `json:"token"`
+		Notification struct {
+			Title string `json:"title,omitempty"`
+			Body  string `json:"body"`
+		} `json:"notification"`
+	} `json:"message"`
+}
+
+func (c *Client) sendFCM(ctx context.Context, token, subject, body string) error {
+	var payload fcmPayload
+	payload.Message.Token = token
+	payload.Message.Notification.Title = subject
+	payload.Message.Notification.Body = body
+
+	resp, err := c.post(ctx, c.baseURL+"/v1/projects/"+url.PathEscape(c.projectID)+"/messages:send", &payload, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var result struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&result)
+
+	for _, detail := range result.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return fmt.Errorf("%w: %v", ErrInvalidToken, detail.ErrorCode)
+		}
+	}
+
+	return fmt.Errorf("fcm responded %v: %v", resp.Status, result.Error.Message)
+}
+
+func (c *Client) post(ctx context.Context, url string, payload any, headers map[string]string) (*http.Response, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return c.httpClient.Do(req)
+}
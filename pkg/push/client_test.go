@@ -0,0 +1,222 @@
+package push_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/pkg/push"
+)
+
+var errMock = errors.New("mock error")
+
+// Local TLS stand in for a provider, speaking HTTP/2 as the real ones insist on
+func newProvider(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("expected HTTP/2, got %v", r.Proto)
+		}
+		handler(w, r)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func fakeAPNs(t *testing.T) *httptest.Server {
+	return newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apns-topic") != "com.example.app" || r.Header.Get("Authorization") != "Bearer jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var payload struct {
+			APS struct {
+				Alert struct {
+					Title string `json:"title"`
+					Body  string `json:"body"`
+				} `json:"alert"`
+			} `json:"aps"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.APS.Alert.Body != "Body" {
+			t.Errorf("unexpected payload %+v (%v)", payload, err)
+		}
+
+		switch strings.TrimPrefix(r.URL.Path, "/3/device/") {
+		case "good":
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason": "Unregistered"}`))
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason": "BadDeviceToken"}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"reason": "ServiceUnavailable"}`))
+		}
+	})
+}
+
+func fakeFCM(t *testing.T) *httptest.Server {
+	return newProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/example/messages:send" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var payload struct {
+			Message struct {
+				Token string `json:"token"`
+			} `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		switch payload.Message.Token {
+		case "good":
+			w.Write([]byte(`{"name": "projects/example/messages/1"}`))
+		case "gone":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"status": "NOT_FOUND", "details": [{"errorCode": "UNREGISTERED"}]}}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": {"status": "INTERNAL", "message": "try again"}}`))
+		}
+	})
+}
+
+func TestNewClient(t *testing.T) {
+	for _, provider := range []string{push.ProviderAPNs, push.ProviderFCM} {
+		provider := provider
+
+		t.Run(provider, func(t *testing.T) {
+			server := fakeAPNs(t)
+			if provider == push.ProviderFCM {
+				server = fakeFCM(t)
+			}
+
+			var pruned []string
+			client, err := push.New(&push.ClientOptions{
+				HttpClient: server.Client(),
+				Provider:   provider,
+				BaseURL:    server.URL,
+				AuthToken:  "jwt",
+				Topic:      "com.example.app",
+				ProjectID:  "example",
+				OnInvalidToken: func(ctx context.Context, token string) {
+					pruned = append(pruned, token)
+				},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			t.Run("Send", func(t *testing.T) {
+				if err := client.Send(context.TODO(), "good", "Subject", "Body"); err != nil {
+					t.Error(err)
+				}
+			})
+
+			t.Run("InvalidTokenPruned", func(t *testing.T) {
+				pruned = nil
+				err := client.Send(context.TODO(), "gone", "Subject", "Body")
+				if err == nil {
+					t.Error("error should have been returned")
+				}
+
+				if len(pruned) != 1 || pruned[0] != "gone" {
+					t.Errorf("unexpected pruned tokens %v", pruned)
+				}
+			})
+
+			t.Run("SeveralDevices", func(t *testing.T) {
+				pruned = nil
+				if err := client.Send(context.TODO(), "gone, good", "Subject", "Body"); err != nil {
+					t.Error(err)
+				}
+
+				if len(pruned) != 1 || pruned[0] != "gone" {
+					t.Errorf("unexpected pruned tokens %v", pruned)
+				}
+			})
+
+			t.Run("ProviderError", func(t *testing.T) {
+				pruned = nil
+				if err := client.Send(context.TODO(), "unavailable", "Subject", "Body"); err == nil {
+					t.Error("error should have been returned")
+				}
+
+				if len(pruned) != 0 {
+					t.Error("provider errors should not prune tokens")
+				}
+			})
+
+			t.Run("MissingToken", func(t *testing.T) {
+				if err := client.Send(context.TODO(), " , ", "Subject", "Body"); err == nil {
+					t.Error("error should have been returned")
+				}
+			})
+		})
+	}
+}
+
+func TestAPNsBadDeviceToken(t *testing.T) {
+	server := fakeAPNs(t)
+
+	client := push.Must(push.New(&push.ClientOptions{
+		HttpClient: server.Client(),
+		Provider:   push.ProviderAPNs,
+		BaseURL:    server.URL,
+		AuthToken:  "jwt",
+		Topic:      "com.example.app",
+	}))
+
+	// Without OnInvalidToken set the error still says why
+	err := client.Send(context.TODO(), "bad", "Subject", "Body")
+	if err == nil || !strings.Contains(err.Error(), "BadDeviceToken") {
+		t.Errorf("expected BadDeviceToken, got %v", err)
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	for _, opts := range []*push.ClientOptions{
+		{},
+		{Provider: "pigeon"},
+		{Provider: push.ProviderAPNs},
+		{Provider: push.ProviderFCM},
+	} {
+		if _, err := push.New(opts); err == nil {
+			t.Errorf("%+v should have been rejected", opts)
+		}
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	push.Must(&push.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	push.Must(&push.Client{}, errMock)
+}
@@ -0,0 +1,235 @@
+// redact
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, masking the personal data notifications carry (addresses,
+// numbers and message content) before it's written anywhere it could be read by someone
+// who shouldn't, logs and error messages mostly
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// How message bodies are treated
+const (
+	// Replaced with a short hash, so the same body can still be matched up
+	BodyHash = "hash"
+
+	// Cut down to the first TruncateAt characters
+	BodyTruncate = "truncate"
+
+	// Left alone, for local development
+	BodyKeep = "keep"
+)
+
+type ClientOptions struct {
+	// Turns redaction off entirely, only sensible in development
+	Disabled bool
+
+	// BodyHash, BodyTruncate or BodyKeep, defaults to BodyHash
+	Body string
+
+	// How much of a body BodyTruncate keeps, defaults to 16 characters
+	TruncateAt int
+}
+
+type Client struct {
+	disabled bool
+
+	body       string
+	truncateAt int
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	if opts.Body == "" {
+		opts.Body = BodyHash
+	}
+
+	switch opts.Body {
+	case BodyHash, BodyTruncate, BodyKeep:
+	default:
+		return nil, fmt.Errorf("unknown body redaction %q", opts.Body)
+	}
+
+	if opts.TruncateAt <= 0 {
+		opts.TruncateAt = 16
+	}
+
+	return &Client{
+		disabled: opts.Disabled,
+
+		body:       opts.Body,
+		truncateAt: opts.TruncateAt,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Email keeps the first character and the domain, j***@example.com
+func (c *Client) Email(address string) string {
+	if c.disabled {
+		return address
+	}
+
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+
+	first, _ := utf8.DecodeRuneInString(local)
+	return string(first) + "***@" + domain
+}
+
+// Phone keeps the last 4 digits, ***0123
+func (c *Client) Phone(number string) string {
+	if c.disabled {
+		return number
+	}
+
+	var digits []rune
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+
+	if len(digits) <= 4 {
+		return "***"
+	}
+
+	return "***" + string(digits[len(digits)-4:])
+}
+
+// Address works out what kind of address it's been given, URLs keep their
+// host, anything else (device tokens, channel IDs) keeps its first 4 characters
+func (c *Client) Address(address string) string {
+	if c.disabled || address == "" {
+		return address
+	}
+
+	// Recipients with several addresses hold them comma separated
+	if strings.Contains(address, ",") {
+		parts := strings.Split(address, ",")
+		for i, part := range parts {
+			parts[i] = c.Address(strings.TrimSpace(part))
+		}
+		return strings.Join(parts, ",")
+	}
+
+	switch {
+	case strings.Contains(address, "@"):
+		return c.Email(address)
+	case phonePattern.MatchString(address):
+		return c.Phone(address)
+	}
+
+	if u, err := url.Parse(address); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Scheme + "://" + u.Host + "/***"
+	}
+
+	if utf8.RuneCountInString(address) <= 4 {
+		return "***"
+	}
+
+	return string([]rune(address)[:4]) + "***"
+}
+
+// Body hashes or truncates message content as configured
+func (c *Client) Body(body string) string {
+	if c.disabled || body == "" {
+		return body
+	}
+
+	length := utf8.RuneCountInString(body)
+
+	switch c.body {
+	case BodyKeep:
+		return body
+	case BodyTruncate:
+		if length <= c.truncateAt {
+			return body
+		}
+		return fmt.Sprintf("%v... (%v chars)", string([]rune(body)[:c.truncateAt]), length)
+	}
+
+	sum := sha256.Sum256([]byte(body))
+	return fmt.Sprintf("sha256:%v (%v chars)", hex.EncodeToString(sum[:6]), length)
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+	// Loose on purpose, Text only masks matches with enough digits to be a number
+	phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ().\-]{6,}[0-9]$`)
+	phoneInText  = regexp.MustCompile(`\+?[0-9][0-9 ().\-]{6,}[0-9]`)
+)
+
+// Text masks any email addresses and phone numbers found in free text, for
+// error messages that quote what they were given back
+func (c *Client) Text(text string) string {
+	if c.disabled {
+		return text
+	}
+
+	text = emailPattern.ReplaceAllStringFunc(text, c.Email)
+
+	return phoneInText.ReplaceAllStringFunc(text, func(match string) string {
+		// Dates and times look like numbers but never have this many digits
+		digits := 0
+		for _, r := range match {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+
+		if digits < 9 {
+			return match
+		}
+
+		return c.Phone(match)
+	})
+}
+
+// The log attribute keys that hold addresses and content, everything else
+// is only scanned for addresses as free text when it's a message or error
+var (
+	addressKeys = map[string]bool{"to": true, "number": true, "email": true, "phone": true, "address": true, "url": true, "token": true}
+	contentKeys = map[string]bool{"body": true, "subject": true}
+)
+
+// ReplaceAttr is for slog.HandlerOptions, redacting attributes by key
+func (c *Client) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if c.disabled {
+		return a
+	}
+
+	switch {
+	case addressKeys[a.Key]:
+		return slog.String(a.Key, c.Address(a.Value.String()))
+	case contentKeys[a.Key]:
+		return slog.String(a.Key, c.Body(a.Value.String()))
+	case a.Key == slog.MessageKey:
+		return slog.String(a.Key, c.Text(a.Value.String()))
+	}
+
+	if err, ok := a.Value.Any().(error); ok {
+		return slog.String(a.Key, c.Text(err.Error()))
+	}
+
+	return a
+}
@@ -0,0 +1,119 @@
+package redact_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
+)
+
+var errMock = errors.New("mock error")
+
+func TestAddress(t *testing.T) {
+	client := redact.Must(redact.New(&redact.ClientOptions{}))
+
+	tests := map[string]string{
+		"john@example.com":                   "j***@example.com",
+		"+44 7700 900123":                    "***0123",
+		"0123456789":                         "***6789",
+		"https://hooks.example.com/T0/B0/XX": "https://hooks.example.com/***",
+		"C0123ABCD":                          "C012***",
+		"abc":                                "***",
+		"a@example.com, 0123456789":          "a***@example.com,***6789",
+		"":                                   "",
+	}
+
+	for in, want := range tests {
+		if got := client.Address(in); got != want {
+			t.Errorf("Address(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBody(t *testing.T) {
+	body := "Your verification code is 123456"
+
+	hashed := redact.Must(redact.New(&redact.ClientOptions{})).Body(body)
+	if strings.Contains(hashed, "123456") || !strings.HasPrefix(hashed, "sha256:") || !strings.HasSuffix(hashed, "(32 chars)") {
+		t.Errorf("hashed body %q", hashed)
+	}
+
+	truncated := redact.Must(redact.New(&redact.ClientOptions{Body: redact.BodyTruncate, TruncateAt: 4})).Body(body)
+	if truncated != "Your... (32 chars)" {
+		t.Errorf("truncated body %q", truncated)
+	}
+
+	kept := redact.Must(redact.New(&redact.ClientOptions{Body: redact.BodyKeep})).Body(body)
+	if kept != body {
+		t.Errorf("kept body %q", kept)
+	}
+}
+
+func TestText(t *testing.T) {
+	client := redact.Must(redact.New(&redact.ClientOptions{}))
+
+	got := client.Text(`sms: provider rejected +447700900123, email: bounced john@example.com at 2030-01-01T09:00:00Z`)
+	want := `sms: provider rejected ***0123, email: bounced j***@example.com at 2030-01-01T09:00:00Z`
+
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	client := redact.Must(redact.New(&redact.ClientOptions{Disabled: true}))
+
+	for _, in := range []string{"john@example.com", "0123456789", "Hello"} {
+		if client.Address(in) != in || client.Body(in) != in || client.Text(in) != in {
+			t.Errorf("%q should be left alone", in)
+		}
+	}
+}
+
+func TestReplaceAttr(t *testing.T) {
+	var buf bytes.Buffer
+
+	client := redact.Must(redact.New(&redact.ClientOptions{Body: redact.BodyTruncate, TruncateAt: 2}))
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: client.ReplaceAttr}))
+
+	logger.Info("Sending to john@example.com",
+		"to", "0123456789", "body", "Hello", "id", "abc", "error", errors.New("rejected john@example.com"))
+
+	want := `msg="Sending to j***@example.com" to=***6789 body="He... (5 chars)" id=abc error="rejected j***@example.com"`
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewInvalidBody(t *testing.T) {
+	if _, err := redact.New(&redact.ClientOptions{Body: "shred"}); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	redact.Must(&redact.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	redact.Must(&redact.Client{}, errMock)
+}
@@ -0,0 +1,350 @@
+// sandbox
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, keeping the emails and SMS the service would have sent in
+// memory so they can be looked at instead, for local development and QA. It serves them
+// itself, as JSON under /sandbox/messages and as a small inbox at /sandbox/, the way the
+// metrics client serves /metrics
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// The channels messages are kept from
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Message is one caught on its way out, Raw is an email's MIME as the SMTP
+// server would have got it, Segments and Encoding are an SMS's
+type Message struct {
+	ID      string    `json:"id"`
+	Channel string    `json:"channel"`
+	Sent    time.Time `json:"sent"`
+
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+
+	Raw string `json:"raw,omitempty"`
+
+	Segments int    `json:"segments,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// The most messages kept, the oldest go first, defaults to 1000
+	Limit int
+
+	// Allows the passing of time to be controlled in tests
+	Now func() time.Time
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	limit int
+
+	// Oldest first, IDs count up from 1 so they never repeat after a clear
+	mu       sync.RWMutex
+	messages []*Message
+	next     int
+
+	router *mux.Router
+
+	now func() time.Time
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "sandbox")
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = 1000
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	c := &Client{
+		logger: opts.Logger,
+
+		limit: opts.Limit,
+
+		now: opts.Now,
+	}
+
+	c.router = c.routes()
+
+	return c, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Email keeps an email email.Client would have sent
+func (c *Client) Email(ctx context.Context, from, to, subject, body string, raw []byte) error {
+	c.add(&Message{
+		Channel: ChannelEmail,
+		From:    from,
+		To:      to,
+		Subject: subject,
+		Body:    body,
+		Raw:     string(raw),
+	})
+
+	return nil
+}
+
+// SMS keeps an SMS sms.Client would have sent
+func (c *Client) SMS(ctx context.Context, from, to, body string, segments int, encoding string) error {
+	c.add(&Message{
+		Channel:  ChannelSMS,
+		From:     from,
+		To:       to,
+		Body:     body,
+		Segments: segments,
+		Encoding: encoding,
+	})
+
+	return nil
+}
+
+func (c *Client) add(msg *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.next++
+	msg.ID = strconv.Itoa(c.next)
+	msg.Sent = c.now()
+
+	c.messages = append(c.messages, msg)
+	if len(c.messages) > c.limit {
+		c.messages = c.messages[len(c.messages)-c.limit:]
+	}
+
+	c.logger.Info("Message kept in the sandbox", "id", msg.ID, "channel", msg.Channel)
+}
+
+// List returns every message kept, newest first
+func (c *Client) List() []*Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	messages := make([]*Message, len(c.messages))
+	for i, msg := range c.messages {
+		messages[len(c.messages)-1-i] = msg
+	}
+
+	return messages
+}
+
+// Get returns the message, nil if it isn't kept
+func (c *Client) Get(id string) *Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, msg := range c.messages {
+		if msg.ID == id {
+			return msg
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a message, reporting whether it was kept
+func (c *Client) Delete(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, msg := range c.messages {
+		if msg.ID == id {
+			c.messages = append(c.messages[:i:i], c.messages[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Clear removes every message
+func (c *Client) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = nil
+}
+
+// ServeHTTP answers everything under /sandbox/, mount it there
+func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.router.ServeHTTP(w, r)
+}
+
+func (c *Client) routes() *mux.Router {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/sandbox/", c.inboxHandler).Methods(http.MethodGet)
+	router.HandleFunc("/sandbox/view/{id}", c.viewHandler).Methods(http.MethodGet)
+
+	// Browsers can only post forms, so the inbox clears with a POST
+	router.HandleFunc("/sandbox/clear", c.clearFormHandler).Methods(http.MethodPost)
+
+	router.HandleFunc("/sandbox/messages", c.listHandler).Methods(http.MethodGet)
+	router.HandleFunc("/sandbox/messages", c.clearHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/sandbox/messages/{id}", c.getHandler).Methods(http.MethodGet)
+	router.HandleFunc("/sandbox/messages/{id}", c.deleteHandler).Methods(http.MethodDelete)
+	router.HandleFunc("/sandbox/messages/{id}/raw", c.rawHandler).Methods(http.MethodGet)
+
+	return router
+}
+
+func (c *Client) listHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.List())
+}
+
+func (c *Client) getHandler(w http.ResponseWriter, r *http.Request) {
+	msg := c.Get(mux.Vars(r)["id"])
+	if msg == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// The message as it would have gone over the wire, an email's MIME, an
+// SMS has nothing more than its body
+func (c *Client) rawHandler(w http.ResponseWriter, r *http.Request) {
+	msg := c.Get(mux.Vars(r)["id"])
+	if msg == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	raw := msg.Raw
+	if raw == "" {
+		raw = msg.Body
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, raw)
+}
+
+func (c *Client) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.Delete(mux.Vars(r)["id"]) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Client) clearHandler(w http.ResponseWriter, r *http.Request) {
+	c.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Client) clearFormHandler(w http.ResponseWriter, r *http.Request) {
+	c.Clear()
+	http.Redirect(w, r, "/sandbox/", http.StatusSeeOther)
+}
+
+func (c *Client) inboxHandler(w http.ResponseWriter, r *http.Request) {
+	c.render(w, "inbox", c.List())
+}
+
+func (c *Client) viewHandler(w http.ResponseWriter, r *http.Request) {
+	msg := c.Get(mux.Vars(r)["id"])
+	if msg == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.render(w, "view", msg)
+}
+
+func (c *Client) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pages.ExecuteTemplate(w, name, data); err != nil {
+		c.logger.Error("Rendering the sandbox failed", "page", name, "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// Kept deliberately plain, it's a development tool not a product
+var pages = template.Must(template.New("sandbox").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`
+{{define "head"}}<!doctype html>
+<html><head><meta charset="utf-8"><title>Sandbox</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4em .8em; border-bottom: 1px solid #ddd; }
+pre { background: #f6f6f6; padding: 1em; white-space: pre-wrap; }
+</style></head><body>{{end}}
+
+{{define "inbox"}}{{template "head"}}
+<h1>Sandbox</h1>
+<form method="post" action="/sandbox/clear"><button>Clear all</button></form>
+{{if .}}<table>
+<tr><th>Sent</th><th>Channel</th><th>To</th><th>Subject / body</th></tr>
+{{range .}}<tr>
+<td>{{time .Sent}}</td><td>{{.Channel}}</td><td>{{.To}}</td>
+<td><a href="/sandbox/view/{{.ID}}">{{if .Subject}}{{.Subject}}{{else}}{{.Body}}{{end}}</a></td>
+</tr>{{end}}
+</table>{{else}}<p>Nothing sent yet.</p>{{end}}
+</body></html>{{end}}
+
+{{define "view"}}{{template "head"}}
+<p><a href="/sandbox/">&larr; Inbox</a></p>
+<h1>{{if .Subject}}{{.Subject}}{{else}}{{.Channel}} message{{end}}</h1>
+<table>
+<tr><th>Channel</th><td>{{.Channel}}</td></tr>
+<tr><th>Sent</th><td>{{time .Sent}}</td></tr>
+<tr><th>From</th><td>{{.From}}</td></tr>
+<tr><th>To</th><td>{{.To}}</td></tr>
+{{if .Segments}}<tr><th>Segments</th><td>{{.Segments}} ({{.Encoding}})</td></tr>{{end}}
+</table>
+<pre>{{.Body}}</pre>
+{{if .Raw}}<p><a href="/sandbox/messages/{{.ID}}/raw">Raw MIME</a></p>{{end}}
+</body></html>{{end}}
+`))
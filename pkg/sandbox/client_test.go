@@ -0,0 +1,214 @@
+package sandbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/sandbox"
+)
+
+var errMock = errors.New("mock error")
+
+func newClient(t *testing.T, limit int) *sandbox.Client {
+	client := sandbox.Must(sandbox.New(&sandbox.ClientOptions{
+		Limit: limit,
+		Now: func() time.Time {
+			return time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		},
+	}))
+
+	if err := client.Email(context.TODO(), "noreply@example.com", "jo@example.com", "Welcome <Jo>", "Hi Jo", []byte("Subject: Welcome\r\n\r\nHi Jo")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.SMS(context.TODO(), "0987654321", "0123456789", "Your code is 1234", 1, "GSM-7"); err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func serve(client *sandbox.Client, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	recorder := httptest.NewRecorder()
+	client.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestNewClient(t *testing.T) {
+	client := newClient(t, 0)
+
+	t.Run("List", func(t *testing.T) {
+		messages := client.List()
+		if len(messages) != 2 || messages[0].Channel != sandbox.ChannelSMS || messages[1].Channel != sandbox.ChannelEmail {
+			t.Fatalf("expected the sms then the email, newest first, got %+v", messages)
+		}
+
+		if messages[1].ID != "1" || messages[0].ID != "2" || !messages[0].Sent.Equal(time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected messages %+v %+v", messages[0], messages[1])
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		if msg := client.Get("1"); msg == nil || msg.Subject != "Welcome <Jo>" || msg.Raw == "" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+
+		if msg := client.Get("9"); msg != nil {
+			t.Errorf("expected nothing, got %+v", msg)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if !client.Delete("1") || client.Delete("1") {
+			t.Error("the email should be deleted once")
+		}
+
+		if len(client.List()) != 1 {
+			t.Errorf("expected one message left, got %v", len(client.List()))
+		}
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		client.Clear()
+		if len(client.List()) != 0 {
+			t.Error("nothing should be left")
+		}
+
+		// IDs carry on so a bookmarked message isn't confused with a new one
+		client.SMS(context.TODO(), "", "0123456789", "again", 1, "GSM-7")
+		if client.List()[0].ID != "3" {
+			t.Errorf("unexpected id %v", client.List()[0].ID)
+		}
+	})
+}
+
+func TestLimit(t *testing.T) {
+	client := newClient(t, 3)
+
+	for i := 0; i < 3; i++ {
+		client.SMS(context.TODO(), "", "0123456789", fmt.Sprint(i), 1, "GSM-7")
+	}
+
+	messages := client.List()
+	if len(messages) != 3 || messages[0].Body != "2" || messages[2].Body != "0" {
+		t.Errorf("only the newest 3 should be kept, got %+v", messages)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	client := newClient(t, 0)
+
+	t.Run("List", func(t *testing.T) {
+		recorder := serve(client, http.MethodGet, "/sandbox/messages")
+
+		var messages []*sandbox.Message
+		if err := json.NewDecoder(recorder.Body).Decode(&messages); err != nil || len(messages) != 2 {
+			t.Errorf("status %v, messages %+v (%v)", recorder.Code, messages, err)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		if recorder := serve(client, http.MethodGet, "/sandbox/messages/2"); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"segments":1`) {
+			t.Errorf("status %v, body %v", recorder.Code, recorder.Body.String())
+		}
+
+		if recorder := serve(client, http.MethodGet, "/sandbox/messages/9"); recorder.Code != http.StatusNotFound {
+			t.Errorf("status %v, want 404", recorder.Code)
+		}
+	})
+
+	t.Run("Raw", func(t *testing.T) {
+		if recorder := serve(client, http.MethodGet, "/sandbox/messages/1/raw"); recorder.Body.String() != "Subject: Welcome\r\n\r\nHi Jo" {
+			t.Errorf("unexpected raw %q", recorder.Body.String())
+		}
+
+		if recorder := serve(client, http.MethodGet, "/sandbox/messages/2/raw"); recorder.Body.String() != "Your code is 1234" {
+			t.Errorf("an sms's raw should be its body, got %q", recorder.Body.String())
+		}
+	})
+
+	t.Run("Inbox", func(t *testing.T) {
+		recorder := serve(client, http.MethodGet, "/sandbox/")
+		if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("status %v, content type %v", recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+
+		body := recorder.Body.String()
+		if !strings.Contains(body, `href="/sandbox/view/1"`) || !strings.Contains(body, "Welcome &lt;Jo&gt;") {
+			t.Errorf("the inbox should link to each message, escaped, got %v", body)
+		}
+	})
+
+	t.Run("View", func(t *testing.T) {
+		recorder := serve(client, http.MethodGet, "/sandbox/view/1")
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `href="/sandbox/messages/1/raw"`) {
+			t.Errorf("status %v, body %v", recorder.Code, recorder.Body.String())
+		}
+
+		if recorder := serve(client, http.MethodGet, "/sandbox/view/9"); recorder.Code != http.StatusNotFound {
+			t.Errorf("status %v, want 404", recorder.Code)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if recorder := serve(client, http.MethodDelete, "/sandbox/messages/2"); recorder.Code != http.StatusNoContent {
+			t.Errorf("status %v, want 204", recorder.Code)
+		}
+
+		if recorder := serve(client, http.MethodDelete, "/sandbox/messages/2"); recorder.Code != http.StatusNotFound {
+			t.Errorf("status %v, want 404", recorder.Code)
+		}
+	})
+
+	t.Run("ClearForm", func(t *testing.T) {
+		recorder := serve(client, http.MethodPost, "/sandbox/clear")
+		if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/sandbox/" {
+			t.Errorf("status %v, location %v", recorder.Code, recorder.Header().Get("Location"))
+		}
+
+		if len(client.List()) != 0 {
+			t.Error("the inbox should be empty")
+		}
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		client.SMS(context.TODO(), "", "0123456789", "again", 1, "GSM-7")
+
+		if recorder := serve(client, http.MethodDelete, "/sandbox/messages"); recorder.Code != http.StatusNoContent || len(client.List()) != 0 {
+			t.Errorf("status %v, %v left", recorder.Code, len(client.List()))
+		}
+	})
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	sandbox.Must(&sandbox.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	sandbox.Must(&sandbox.Client{}, errMock)
+}
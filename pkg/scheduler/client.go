@@ -0,0 +1,299 @@
+// scheduler
+//
+// Holds work that shouldn't happen yet and hands it back to the caller once it
+// is due. It knows nothing about what a job actually is, a job is just a kind
+// and an opaque payload, which keeps it free of any knowledge of core
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Handler is called with each job once it falls due, the kind and payload
+// are handed back exactly as they were passed to Schedule
+type Handler func(ctx context.Context, kind string, payload []byte) error
+
+type Job struct {
+	ID      string
+	Kind    string
+	Payload []byte
+	At      time.Time
+
+	// How many times it has been claimed and not finished, only a
+	// directory store keeps count
+	Attempts int `json:",omitempty"`
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Optional, when set jobs are written to this directory so they survive
+	// a restart and can be scheduled by one process and run by another
+	Dir string
+
+	// How often the run loop checks for due jobs
+	PollInterval time.Duration
+
+	// Optional, health checks fail once more jobs than this are waiting
+	MaxPending int
+
+	// How long a job claimed from Dir can go without finishing before it's
+	// put back to be run again, defaults to 10 minutes. Keep it longer than
+	// any handler takes, or a slow job may be run twice
+	LeaseTimeout time.Duration
+
+	// How many times a job from Dir is tried before it is set aside as
+	// .failed in the directory, defaults to 5
+	MaxAttempts int
+
+	// Allows the passing of time to be controlled in tests
+	Now func() time.Time
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	pollInterval time.Duration
+	maxPending   int
+	now          func() time.Time
+
+	store   store
+	durable bool
+
+	// Closed by Drain, after which no more jobs are claimed
+	mu      sync.Mutex
+	stopped bool
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "scheduler")
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	if opts.LeaseTimeout <= 0 {
+		opts.LeaseTimeout = 10 * time.Minute
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+
+	var jobStore store = newMemoryStore()
+	if opts.Dir != "" {
+		dirStore, err := newDirStore(opts.Logger, opts.Dir, opts.LeaseTimeout, opts.MaxAttempts)
+		if err != nil {
+			return nil, err
+		}
+		jobStore = dirStore
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		pollInterval: opts.PollInterval,
+		maxPending:   opts.MaxPending,
+		now:          opts.Now,
+
+		store:   jobStore,
+		durable: opts.Dir != "",
+
+		stop: make(chan struct{}),
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Schedule stores the job until at, returning an ID that identifies it
+func (c *Client) Schedule(ctx context.Context, at time.Time, kind string, payload []byte) (string, error) {
+	if kind == "" {
+		return "", errors.New("job kind missing")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	err = c.store.put(&Job{
+		ID:      id,
+		Kind:    kind,
+		Payload: payload,
+		At:      at,
+	})
+
+	return id, err
+}
+
+// Get returns the job if it's still waiting to run, nil if it isn't
+func (c *Client) Get(ctx context.Context, id string) (*Job, error) {
+	return c.store.get(id)
+}
+
+// When returns when a job that hasn't run yet is due, reporting whether there was one
+func (c *Client) When(ctx context.Context, id string) (time.Time, bool, error) {
+	job, err := c.store.get(id)
+	if err != nil || job == nil {
+		return time.Time{}, false, err
+	}
+
+	return job.At, true, nil
+}
+
+// Cancel removes a job that hasn't run yet, reporting whether there was one
+func (c *Client) Cancel(ctx context.Context, id string) (bool, error) {
+	return c.store.remove(id)
+}
+
+// Reschedule moves a job that hasn't run yet, reporting whether there was one
+func (c *Client) Reschedule(ctx context.Context, id string, at time.Time) (bool, error) {
+	return c.store.reschedule(id, at)
+}
+
+// Pending returns how many jobs are waiting to run
+func (c *Client) Pending() int {
+	count, err := c.store.count()
+	if err != nil {
+		c.logger.Error("Counting scheduled jobs failed", "error", err)
+	}
+
+	return count
+}
+
+// Run blocks, passing due jobs to h until ctx is cancelled or Drain is called
+func (c *Client) Run(ctx context.Context, h Handler) error {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.RunDue(ctx, h)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue passes every job that is due to h. A job that fails is logged,
+// from a memory store that's the end of it, a directory store keeps it
+// claimed and runs it again once LeaseTimeout has passed
+func (c *Client) RunDue(ctx context.Context, h Handler) {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.running.Add(1)
+	c.mu.Unlock()
+	defer c.running.Done()
+
+	for _, job := range c.takeDue() {
+		err := h(ctx, job.Kind, job.Payload)
+		if err != nil {
+			c.logger.ErrorContext(ctx, "Scheduled job failed", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts+1, "error", err)
+		}
+
+		if err := c.store.finish(job, err); err != nil {
+			c.logger.ErrorContext(ctx, "Finishing scheduled job failed", "job_id", job.ID, "error", err)
+		}
+	}
+}
+
+// Drain stops jobs being claimed and waits for any being handled to finish,
+// reporting work that is abandoned, jobs in a memory store are lost with the
+// process while a directory store keeps them for the next start
+func (c *Client) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.stopped {
+		c.stopped = true
+		close(c.stop)
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.New("scheduled jobs still running were abandoned")
+	}
+
+	if pending := c.Pending(); pending > 0 && !c.durable {
+		return fmt.Errorf("%v scheduled jobs held in memory were abandoned", pending)
+	}
+
+	return nil
+}
+
+// Check reports whether the store can be read and, when MaxPending is set,
+// whether the queue has backed up past it
+func (c *Client) Check(ctx context.Context) error {
+	pending, err := c.store.count()
+	if err != nil {
+		return fmt.Errorf("scheduler store unavailable: %w", err)
+	}
+
+	if c.maxPending > 0 && pending > c.maxPending {
+		return fmt.Errorf("%v scheduled jobs waiting, over the limit of %v", pending, c.maxPending)
+	}
+
+	return nil
+}
+
+func (c *Client) takeDue() []*Job {
+	due, err := c.store.claim(c.now())
+	if err != nil {
+		c.logger.Error("Claiming scheduled jobs failed", "error", err)
+	}
+
+	// Run in the order they were due, not map order
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].At.Before(due[j].At)
+	})
+
+	return due
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
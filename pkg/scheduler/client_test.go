@@ -0,0 +1,419 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/scheduler"
+)
+
+var errMock = errors.New("mock error")
+
+func TestNewClient(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	client, err := scheduler.New(&scheduler.ClientOptions{
+		Now: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var ran []string
+	handler := func(ctx context.Context, kind string, payload []byte) error {
+		ran = append(ran, string(payload))
+		return nil
+	}
+
+	t.Run("Schedule", func(t *testing.T) {
+		if _, err := client.Schedule(context.TODO(), now.Add(2*time.Hour), "test", []byte("later")); err != nil {
+			t.Error(err)
+		}
+		if _, err := client.Schedule(context.TODO(), now.Add(time.Hour), "test", []byte("sooner")); err != nil {
+			t.Error(err)
+		}
+
+		if client.Pending() != 2 {
+			t.Errorf("pending = %v, want 2", client.Pending())
+		}
+	})
+
+	t.Run("NotYetDue", func(t *testing.T) {
+		client.RunDue(context.TODO(), handler)
+
+		if len(ran) != 0 {
+			t.Error("nothing should have run yet")
+		}
+	})
+
+	t.Run("Due", func(t *testing.T) {
+		now = now.Add(3 * time.Hour)
+		client.RunDue(context.TODO(), handler)
+
+		if len(ran) != 2 || ran[0] != "sooner" || ran[1] != "later" {
+			t.Errorf("unexpected run order %v", ran)
+		}
+
+		if client.Pending() != 0 {
+			t.Error("due jobs should have been removed")
+		}
+	})
+}
+
+func TestCancelAndReschedule(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+		Now: func() time.Time { return now },
+	}))
+
+	id, err := client.Schedule(context.TODO(), now.Add(time.Hour), "test", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if found, err := client.Reschedule(context.TODO(), id, now.Add(2*time.Hour)); err != nil || !found {
+		t.Errorf("reschedule found = %v, err = %v", found, err)
+	}
+
+	job, err := client.Get(context.TODO(), id)
+	if err != nil || job == nil || !job.At.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("job should have been moved, got %+v (%v)", job, err)
+	}
+
+	if at, found, err := client.When(context.TODO(), id); err != nil || !found || !at.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("when = %v, %v, %v", at, found, err)
+	}
+
+	if found, _ := client.Cancel(context.TODO(), id); !found {
+		t.Error("job should have been cancelled")
+	}
+
+	if found, _ := client.Cancel(context.TODO(), id); found {
+		t.Error("job should already be gone")
+	}
+
+	if found, _ := client.Reschedule(context.TODO(), id, now); found {
+		t.Error("cancelled job should not be reschedulable")
+	}
+
+	if _, found, _ := client.When(context.TODO(), id); found {
+		t.Error("cancelled job should have no send time")
+	}
+}
+
+// Jobs written by one client are visible to, and run by, another pointed at
+// the same directory, which is how the CLI hands work to the HTTP service
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	writer := scheduler.Must(scheduler.New(&scheduler.ClientOptions{Dir: dir}))
+	runner := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+		Dir: dir,
+		Now: func() time.Time { return now },
+	}))
+
+	id, err := writer.Schedule(context.TODO(), now.Add(time.Hour), "test", []byte(`{"a":1}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := writer.Schedule(context.TODO(), now.Add(time.Hour), "cancelled", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if runner.Pending() != 2 {
+		t.Errorf("pending = %v, want 2", runner.Pending())
+	}
+
+	if found, err := writer.Reschedule(context.TODO(), id, now.Add(-time.Minute)); err != nil || !found {
+		t.Errorf("reschedule found = %v, err = %v", found, err)
+	}
+
+	var ran []string
+	runner.RunDue(context.TODO(), func(ctx context.Context, kind string, payload []byte) error {
+		ran = append(ran, kind+string(payload))
+		return nil
+	})
+
+	if len(ran) != 1 || ran[0] != `test{"a":1}` {
+		t.Errorf("unexpected jobs run %v", ran)
+	}
+
+	if job, _ := writer.Get(context.TODO(), id); job != nil {
+		t.Error("run job should have been removed")
+	}
+
+	// IDs are only ever hex, anything else can't name a job
+	if found, _ := writer.Cancel(context.TODO(), "../"+id); found {
+		t.Error("path like ids should be rejected")
+	}
+}
+
+func TestDirStoreLease(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	opts := func() *scheduler.ClientOptions {
+		return &scheduler.ClientOptions{
+			Dir:          dir,
+			LeaseTimeout: time.Minute,
+			MaxAttempts:  2,
+			Now:          func() time.Time { return now },
+		}
+	}
+
+	client := scheduler.Must(scheduler.New(opts()))
+	id, _ := client.Schedule(context.TODO(), now, "test", nil)
+
+	var runs int
+	failing := func(context.Context, string, []byte) error {
+		runs++
+		return errMock
+	}
+
+	// Ages every lease in the directory past the timeout
+	expire := func() {
+		claims, _ := filepath.Glob(filepath.Join(dir, "*.claimed"))
+		for _, claim := range claims {
+			old := time.Now().Add(-time.Hour)
+			os.Chtimes(claim, old, old)
+		}
+	}
+
+	t.Run("FailedIsKept", func(t *testing.T) {
+		client.RunDue(context.TODO(), failing)
+		client.RunDue(context.TODO(), failing)
+
+		if runs != 1 {
+			t.Errorf("a job with a live lease shouldn't run again, ran %v times", runs)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, id+".claimed")); err != nil {
+			t.Errorf("the lease should be kept, %v", err)
+		}
+	})
+
+	t.Run("RequeuedOnStart", func(t *testing.T) {
+		expire()
+
+		client = scheduler.Must(scheduler.New(opts()))
+		if job, _ := client.Get(context.TODO(), id); job == nil || job.Attempts != 1 {
+			t.Fatalf("the stale claim should be back in the queue, got %+v", job)
+		}
+	})
+
+	t.Run("SetAside", func(t *testing.T) {
+		client.RunDue(context.TODO(), failing)
+		expire()
+		client.RunDue(context.TODO(), failing)
+
+		if runs != 2 || client.Pending() != 0 {
+			t.Errorf("ran %v times, %v pending", runs, client.Pending())
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, id+".failed")); err != nil {
+			t.Errorf("the job should be set aside, %v", err)
+		}
+	})
+
+	t.Run("Succeeded", func(t *testing.T) {
+		id, _ := client.Schedule(context.TODO(), now, "test", nil)
+		client.RunDue(context.TODO(), func(context.Context, string, []byte) error { return nil })
+
+		if matches, _ := filepath.Glob(filepath.Join(dir, id+".*")); len(matches) != 0 {
+			t.Errorf("nothing should be left of a job that ran, got %v", matches)
+		}
+	})
+}
+
+func TestDirStoreBrokenJob(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+		Dir:    dir,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Now:    func() time.Time { return now },
+	}))
+
+	if err := os.WriteFile(filepath.Join(dir, "abc.json"), []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Schedule(context.TODO(), now, "test", nil)
+
+	if err := client.Check(context.TODO()); err != nil {
+		t.Errorf("a broken job shouldn't fail the check, %v", err)
+	}
+
+	var ran int
+	client.RunDue(context.TODO(), func(context.Context, string, []byte) error {
+		ran++
+		return nil
+	})
+
+	if ran != 1 {
+		t.Errorf("the good job should still run, ran %v", ran)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "abc.failed")); err != nil {
+		t.Errorf("the broken job should be set aside, %v", err)
+	}
+}
+
+func TestRescheduleClaimed(t *testing.T) {
+	for name, dir := range map[string]string{"Memory": "", "Dir": t.TempDir()} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+			client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+				Dir: dir,
+				Now: func() time.Time { return now },
+			}))
+
+			id, _ := client.Schedule(context.TODO(), now, "test", nil)
+
+			// Rescheduling from inside the handler is the claim winning the race
+			var found bool
+			client.RunDue(context.TODO(), func(ctx context.Context, kind string, payload []byte) error {
+				found, _ = client.Reschedule(ctx, id, now.Add(time.Hour))
+				return nil
+			})
+
+			if found || client.Pending() != 0 {
+				t.Errorf("a claimed job shouldn't be brought back, found %v, %v pending", found, client.Pending())
+			}
+		})
+	}
+}
+
+func TestScheduleMissingKind(t *testing.T) {
+	client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{}))
+
+	if _, err := client.Schedule(context.TODO(), time.Now(), "", nil); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestRun(t *testing.T) {
+	client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+		PollInterval: time.Millisecond,
+	}))
+
+	if _, err := client.Schedule(context.TODO(), time.Now(), "test", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// A failing job is logged and dropped rather than stopping the loop
+	err := client.Run(ctx, func(ctx context.Context, kind string, payload []byte) error {
+		defer cancel()
+		return errMock
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if client.Pending() != 0 {
+		t.Error("job should have been run")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{}))
+
+	if _, err := client.Schedule(context.TODO(), time.Now().Add(time.Hour), "test", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Jobs held in memory die with the process so they're reported
+	if err := client.Drain(context.TODO()); err == nil {
+		t.Error("abandoned jobs should have been reported")
+	}
+
+	// Nothing is claimed once drained
+	client.RunDue(context.TODO(), func(context.Context, string, []byte) error {
+		t.Error("job should not have been run after drain")
+		return nil
+	})
+
+	if err := client.Run(context.TODO(), nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDrainDurable(t *testing.T) {
+	client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+		Dir: t.TempDir(),
+	}))
+
+	if _, err := client.Schedule(context.TODO(), time.Now().Add(time.Hour), "test", nil); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The directory keeps them for the next start
+	if err := client.Drain(context.TODO()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	client := scheduler.Must(scheduler.New(&scheduler.ClientOptions{
+		MaxPending: 1,
+	}))
+
+	for i := 0; i < 2; i++ {
+		if err := client.Check(context.TODO()); err != nil {
+			t.Errorf("%v pending should be healthy: %v", i, err)
+		}
+
+		if _, err := client.Schedule(context.TODO(), time.Now().Add(time.Hour), "test", nil); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if err := client.Check(context.TODO()); err == nil {
+		t.Error("a backed up queue should be unhealthy")
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	scheduler.Must(&scheduler.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	scheduler.Must(&scheduler.Client{}, errMock)
+}
@@ -0,0 +1,391 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where jobs are held while they wait, the memory store is lost on restart
+// the directory store survives it and can be shared between processes
+type store interface {
+	put(*Job) error
+	get(id string) (*Job, error)
+	remove(id string) (bool, error)
+	// reschedule moves a job that hasn't been claimed in one step, so a
+	// claim can never see it half moved and run it as well
+	reschedule(id string, at time.Time) (bool, error)
+	// claim removes and returns every job due at or before now, a claimed
+	// job belongs to the caller and won't be handed to anyone else
+	claim(now time.Time) ([]*Job, error)
+	// finish is told how a claimed job went, the directory store only lets
+	// go of it once it has succeeded
+	finish(job *Job, err error) error
+	count() (int, error)
+}
+
+type memoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{jobs: map[string]*Job{}}
+}
+
+func (s *memoryStore) put(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *job
+	s.jobs[job.ID] = &copied
+	return nil
+}
+
+func (s *memoryStore) get(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *job
+	return &copied, nil
+}
+
+func (s *memoryStore) remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.jobs[id]
+	delete(s.jobs, id)
+	return ok, nil
+}
+
+func (s *memoryStore) reschedule(id string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if ok {
+		job.At = at
+	}
+
+	return ok, nil
+}
+
+func (s *memoryStore) claim(now time.Time) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*Job
+	for id, job := range s.jobs {
+		if !job.At.After(now) {
+			due = append(due, job)
+			delete(s.jobs, id)
+		}
+	}
+
+	return due, nil
+}
+
+// Jobs in memory are lost with the process anyway, so a failure is only logged
+func (s *memoryStore) finish(job *Job, err error) error {
+	return nil
+}
+
+func (s *memoryStore) count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.jobs), nil
+}
+
+// One JSON file per job, writes go through a temp file and a rename so a
+// reader never sees half a job, and claiming is a rename so only one
+// process can ever win a job. The claimed file is a lease, it's only
+// removed once the job has run, so one whose process crashed, was drained
+// part way or failed goes back in the queue once the lease is stale
+type dirStore struct {
+	logger *slog.Logger
+
+	dir string
+
+	lease       time.Duration
+	maxAttempts int
+}
+
+const (
+	jobExt     = ".json"
+	claimedExt = ".claimed"
+	movingExt  = ".moving"
+	failedExt  = ".failed"
+)
+
+func newDirStore(logger *slog.Logger, dir string, lease time.Duration, maxAttempts int) (*dirStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &dirStore{
+		logger: logger,
+
+		dir: dir,
+
+		lease:       lease,
+		maxAttempts: maxAttempts,
+	}
+
+	// Anything left claimed by a previous run goes back in the queue
+	if err := s.requeue(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *dirStore) path(id string) string {
+	return filepath.Join(s.dir, id+jobExt)
+}
+
+func (s *dirStore) put(job *Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(job.ID))
+}
+
+func (s *dirStore) get(id string) (*Job, error) {
+	if !validID(id) {
+		return nil, nil
+	}
+
+	return s.read(s.path(id))
+}
+
+func (s *dirStore) read(path string) (*Job, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(b, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (s *dirStore) remove(id string) (bool, error) {
+	if !validID(id) {
+		return false, nil
+	}
+
+	err := os.Remove(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Taking the job out from under a claim with a rename first means only
+// one of them can have it, reschedule reports false if it loses
+func (s *dirStore) reschedule(id string, at time.Time) (bool, error) {
+	if !validID(id) {
+		return false, nil
+	}
+
+	moving := filepath.Join(s.dir, id+movingExt)
+	err := os.Rename(s.path(id), moving)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	job, err := s.read(moving)
+	if err == nil && job != nil {
+		job.At = at
+		err = s.put(job)
+	}
+
+	// Put it back as it was rather than lose it
+	if err != nil {
+		os.Rename(moving, s.path(id))
+		return false, err
+	}
+
+	return true, os.Remove(moving)
+}
+
+func (s *dirStore) claim(now time.Time) ([]*Job, error) {
+	if err := s.requeue(); err != nil {
+		return nil, err
+	}
+
+	jobs, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var due []*Job
+	for _, job := range jobs {
+		if job.At.After(now) {
+			continue
+		}
+
+		// Losing the rename means another process claimed it, or it was
+		// cancelled in the meantime, either way it isn't ours to run
+		claimed := filepath.Join(s.dir, job.ID+claimedExt)
+		if err := os.Rename(s.path(job.ID), claimed); err != nil {
+			continue
+		}
+
+		// A rename keeps the file's time, the lease starts now
+		wall := time.Now()
+		os.Chtimes(claimed, wall, wall)
+
+		due = append(due, job)
+	}
+
+	return due, nil
+}
+
+// Only a job that ran lets go of its lease, one that failed is left
+// claimed to be retried once it goes stale
+func (s *dirStore) finish(job *Job, err error) error {
+	if err != nil {
+		return nil
+	}
+
+	return os.Remove(filepath.Join(s.dir, job.ID+claimedExt))
+}
+
+// Puts claims, and reschedules, older than the lease back in the queue,
+// a job that has been tried maxAttempts times is set aside as failed
+// instead so a message that can never be sent isn't retried forever
+func (s *dirStore) requeue() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != claimedExt && ext != movingExt) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < s.lease {
+			continue
+		}
+
+		held := filepath.Join(s.dir, entry.Name())
+		job, err := s.read(held)
+		if err != nil || job == nil {
+			continue
+		}
+
+		if ext == claimedExt {
+			job.Attempts++
+		}
+
+		if job.Attempts >= s.maxAttempts {
+			os.Rename(held, filepath.Join(s.dir, job.ID+failedExt))
+			continue
+		}
+
+		// Written as a new job then the lease dropped, a crash in between
+		// leaves both and the stale lease is simply requeued again
+		if err := s.put(job); err != nil {
+			return err
+		}
+		os.Remove(held)
+	}
+
+	return nil
+}
+
+func (s *dirStore) count() (int, error) {
+	jobs, err := s.list()
+	return len(jobs), err
+}
+
+func (s *dirStore) list() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), jobExt) {
+			continue
+		}
+
+		// One broken file mustn't hold up every other job, it's set aside
+		// as failed like a job that ran out of attempts
+		path := filepath.Join(s.dir, entry.Name())
+		job, err := s.read(path)
+		if err != nil {
+			s.logger.Error("Unreadable scheduled job set aside", "file", entry.Name(), "error", err)
+			os.Rename(path, strings.TrimSuffix(path, jobExt)+failedExt)
+			continue
+		}
+
+		// Claimed or cancelled between listing and reading
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs, nil
+}
+
+// IDs come from callers (an HTTP path for example) so make sure they
+// can't be used to walk out of the directory
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+
+	return true
+}
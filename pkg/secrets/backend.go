@@ -0,0 +1,189 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The backends New can be configured with by name
+const (
+	BackendFile      = "file"
+	BackendEnv       = "env"
+	BackendEncrypted = "encrypted"
+)
+
+// Where container orchestrators mount secrets, one file per secret
+const DefaultDir = "/run/secrets"
+
+// FileBackend reads each secret from a file named after it
+type FileBackend struct {
+	// Defaults to DefaultDir
+	Dir string
+}
+
+func (b *FileBackend) Lookup(ctx context.Context, name string) (string, error) {
+	dir := b.Dir
+	if dir == "" {
+		dir = DefaultDir
+	}
+
+	// Names come from config, but still shouldn't be able to wander off
+	if name == "" || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Editors and echo leave a trailing newline that isn't part of the secret
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// EnvBackend reads secrets from env vars, smtp-password with the prefix
+// SECRET_ is read from SECRET_SMTP_PASSWORD
+type EnvBackend struct {
+	Prefix string
+
+	// Defaults to os.LookupEnv
+	LookupEnv func(string) (string, bool)
+}
+
+func (b *EnvBackend) Lookup(ctx context.Context, name string) (string, error) {
+	lookup := b.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	key := b.Prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+
+	value, ok := lookup(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return value, nil
+}
+
+// EncryptedFileBackend reads secrets from a JSON object of names to values,
+// sealed with AES-256-GCM, see Seal. The file is read on every lookup so
+// replacing it is all rotation takes
+type EncryptedFileBackend struct {
+	Path string
+
+	// 32 bytes, see ParseKey
+	Key []byte
+}
+
+func (b *EncryptedFileBackend) Lookup(ctx context.Context, name string) (string, error) {
+	sealed, err := os.ReadFile(b.Path)
+	if err != nil {
+		return "", err
+	}
+
+	values, err := Open(b.Key, sealed)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return value, nil
+}
+
+// ParseKey decodes a base64 key, as GenerateKey writes them
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("secrets key isn't base64: %w", err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secrets key is %v bytes, it should be 32", len(key))
+	}
+
+	return key, nil
+}
+
+// GenerateKey returns a new random key, base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Seal encrypts secrets into the form EncryptedFileBackend reads, a random
+// nonce followed by the sealed JSON
+func Seal(key []byte, values map[string]string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open reverses Seal
+func Open(key, sealed []byte) (map[string]string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("secrets file is too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("secrets file can't be decrypted, wrong key or corrupted")
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,222 @@
+// secrets
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, fetching credentials from wherever they are kept (files
+// mounted into the container, env vars or an encrypted file) and keeping them fresh so
+// a rotated password is picked up without a restart
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config values starting with this are looked up here rather than used as
+// they are, secret://smtp-password names the secret "smtp-password"
+const RefPrefix = "secret://"
+
+// Returned when a backend has no secret by the name asked for
+var ErrNotFound = errors.New("secret not found")
+
+// Where the secrets are actually kept, Lookup is called on every refresh so
+// it should read the current value rather than remember it
+type Backend interface {
+	Lookup(ctx context.Context, name string) (string, error)
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Required, FileBackend, EnvBackend or EncryptedFileBackend
+	Backend Backend
+
+	// How often the secrets already fetched are fetched again, defaults to a minute
+	RefreshInterval time.Duration
+
+	// Optional, called after a refresh finds a secret has changed
+	OnRotate func(ctx context.Context, name string)
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	backend Backend
+
+	refreshInterval time.Duration
+	onRotate        func(context.Context, string)
+
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "secrets")
+	}
+
+	if opts.Backend == nil {
+		return nil, errors.New("backend missing")
+	}
+
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Minute
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		backend: opts.Backend,
+
+		refreshInterval: opts.RefreshInterval,
+		onRotate:        opts.OnRotate,
+
+		values: map[string]string{},
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// IsRef reports whether a config value names a secret
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// Get returns the secret, fetching it the first time it's asked for and
+// from the cache kept fresh by Run after that
+func (c *Client) Get(ctx context.Context, name string) (string, error) {
+	c.mu.RLock()
+	value, ok := c.values[name]
+	c.mu.RUnlock()
+
+	if ok {
+		return value, nil
+	}
+
+	value, err := c.backend.Lookup(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %w", name, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[name] = value
+	return value, nil
+}
+
+// Resolve returns a config value with any secret reference swapped for
+// the secret, values that aren't references come back as they are
+func (c *Client) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+
+	return c.Get(ctx, strings.TrimPrefix(value, RefPrefix))
+}
+
+// Ref returns a handle that reads the current value each time it's used, for
+// clients that should pick up a rotated secret without being rebuilt. The
+// secret is fetched once here so a missing one is found straight away
+func (c *Client) Ref(ctx context.Context, value string) (*Secret, error) {
+	if !IsRef(value) {
+		return &Secret{value: value}, nil
+	}
+
+	name := strings.TrimPrefix(value, RefPrefix)
+	if _, err := c.Get(ctx, name); err != nil {
+		return nil, err
+	}
+
+	return &Secret{client: c, name: name}, nil
+}
+
+// Refresh fetches every secret again, a secret that can't be fetched keeps
+// its last value so a backend blip doesn't take credentials away
+func (c *Client) Refresh(ctx context.Context) error {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.values))
+	for name := range c.values {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	var errs []error
+	var rotated []string
+
+	for _, name := range names {
+		value, err := c.backend.Lookup(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("secret %q: %w", name, err))
+			continue
+		}
+
+		c.mu.Lock()
+		if c.values[name] != value {
+			c.values[name] = value
+			rotated = append(rotated, name)
+		}
+		c.mu.Unlock()
+	}
+
+	// Told after the lock is released, so they can fetch secrets themselves
+	for _, name := range rotated {
+		c.logger.InfoContext(ctx, "Secret rotated", "secret", name)
+		if c.onRotate != nil {
+			c.onRotate(ctx, name)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run refreshes the secrets until ctx is done
+func (c *Client) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				c.logger.ErrorContext(ctx, "Refreshing secrets failed, keeping the last values", "error", err)
+			}
+		}
+	}
+}
+
+// Secret is a handle on a value that may change, see Client.Ref
+type Secret struct {
+	client *Client
+	name   string
+
+	// Set instead of client for values that weren't references
+	value string
+}
+
+// Value returns the secret as it is now
+func (s *Secret) Value(ctx context.Context) (string, error) {
+	if s.client == nil {
+		return s.value, nil
+	}
+
+	return s.client.Get(ctx, s.name)
+}
@@ -0,0 +1,253 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/pkg/secrets"
+)
+
+var errMock = errors.New("mock error")
+
+// A backend whose values and failures the tests control
+type MockBackend struct {
+	mu      sync.Mutex
+	Values  map[string]string
+	Err     error
+	Lookups int
+}
+
+func (mb *MockBackend) Lookup(ctx context.Context, name string) (string, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.Lookups++
+	if mb.Err != nil {
+		return "", mb.Err
+	}
+
+	value, ok := mb.Values[name]
+	if !ok {
+		return "", secrets.ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (mb *MockBackend) Set(name, value string) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.Values[name] = value
+}
+
+func newClient(backend secrets.Backend, onRotate func(context.Context, string)) *secrets.Client {
+	return secrets.Must(secrets.New(&secrets.ClientOptions{
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Backend:  backend,
+		OnRotate: onRotate,
+	}))
+}
+
+func TestNewClient(t *testing.T) {
+	if _, err := secrets.New(&secrets.ClientOptions{}); err == nil {
+		t.Error("expected an error without a backend")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	backend := &MockBackend{Values: map[string]string{"smtp-password": "hunter2"}}
+	client := newClient(backend, nil)
+
+	tests := map[string]string{
+		"secret://smtp-password": "hunter2",
+		"plain":                  "plain",
+		"":                       "",
+	}
+
+	for in, want := range tests {
+		got, err := client.Resolve(context.Background(), in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+		}
+
+		if got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	// Fetched once, then cached
+	client.Resolve(context.Background(), "secret://smtp-password")
+	if backend.Lookups != 1 {
+		t.Errorf("%v lookups, want 1", backend.Lookups)
+	}
+
+	if _, err := client.Resolve(context.Background(), "secret://missing"); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("expected %v, got %v", secrets.ErrNotFound, err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	backend := &MockBackend{Values: map[string]string{"sms-token": "one"}}
+
+	var rotated []string
+	client := newClient(backend, func(ctx context.Context, name string) {
+		rotated = append(rotated, name)
+	})
+
+	ref, err := client.Ref(context.Background(), "secret://sms-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing changed, nothing rotated
+	if err := client.Refresh(context.Background()); err != nil || len(rotated) != 0 {
+		t.Errorf("refresh %v, rotated %v", err, rotated)
+	}
+
+	backend.Set("sms-token", "two")
+	if err := client.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := ref.Value(context.Background()); value != "two" {
+		t.Errorf("value %q after rotation, want two", value)
+	}
+
+	if len(rotated) != 1 || rotated[0] != "sms-token" {
+		t.Errorf("rotated %v", rotated)
+	}
+
+	// A backend failure keeps the last value rather than losing it
+	backend.Err = errMock
+	if err := client.Refresh(context.Background()); !errors.Is(err, errMock) {
+		t.Errorf("expected %v, got %v", errMock, err)
+	}
+
+	if value, _ := ref.Value(context.Background()); value != "two" {
+		t.Errorf("value %q after a failed refresh, want two kept", value)
+	}
+}
+
+func TestRef(t *testing.T) {
+	client := newClient(&MockBackend{Values: map[string]string{}}, nil)
+
+	if _, err := client.Ref(context.Background(), "secret://missing"); err == nil {
+		t.Error("expected a missing secret to be found out straight away")
+	}
+
+	ref, err := client.Ref(context.Background(), "literal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := ref.Value(context.Background()); value != "literal" {
+		t.Errorf("value %q, want literal", value)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "smtp-password"), []byte("hunter2\n"), 0600)
+
+	backend := &secrets.FileBackend{Dir: dir}
+
+	if value, err := backend.Lookup(context.Background(), "smtp-password"); err != nil || value != "hunter2" {
+		t.Errorf("lookup %q, %v", value, err)
+	}
+
+	if _, err := backend.Lookup(context.Background(), "missing"); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("expected %v, got %v", secrets.ErrNotFound, err)
+	}
+
+	if _, err := backend.Lookup(context.Background(), "../etc/passwd"); err == nil {
+		t.Error("expected a path to be refused")
+	}
+}
+
+func TestEnvBackend(t *testing.T) {
+	backend := &secrets.EnvBackend{
+		Prefix: "SECRET_",
+		LookupEnv: func(key string) (string, bool) {
+			return "hunter2", key == "SECRET_SMTP_PASSWORD"
+		},
+	}
+
+	if value, err := backend.Lookup(context.Background(), "smtp-password"); err != nil || value != "hunter2" {
+		t.Errorf("lookup %q, %v", value, err)
+	}
+
+	if _, err := backend.Lookup(context.Background(), "missing"); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("expected %v, got %v", secrets.ErrNotFound, err)
+	}
+}
+
+func TestEncryptedFileBackend(t *testing.T) {
+	encoded, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := secrets.ParseKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := secrets.Seal(key, map[string]string{"smtp-password": "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	os.WriteFile(path, sealed, 0600)
+
+	backend := &secrets.EncryptedFileBackend{Path: path, Key: key}
+	if value, err := backend.Lookup(context.Background(), "smtp-password"); err != nil || value != "hunter2" {
+		t.Errorf("lookup %q, %v", value, err)
+	}
+
+	if _, err := backend.Lookup(context.Background(), "missing"); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("expected %v, got %v", secrets.ErrNotFound, err)
+	}
+
+	// Another key can't read it
+	other, _ := secrets.GenerateKey()
+	otherKey, _ := secrets.ParseKey(other)
+	if _, err := (&secrets.EncryptedFileBackend{Path: path, Key: otherKey}).Lookup(context.Background(), "smtp-password"); err == nil {
+		t.Error("expected the wrong key to fail")
+	}
+
+	for _, bad := range []string{"not base64!", "c2hvcnQ="} {
+		if _, err := secrets.ParseKey(bad); err == nil {
+			t.Errorf("ParseKey(%q) should have failed", bad)
+		}
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	secrets.Must(&secrets.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	secrets.Must(nil, errMock)
+}
@@ -0,0 +1,280 @@
+// slack
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, posting notifications into chat channels. The recipient is
+// either an incoming-webhook URL, or a channel ID when the client has an API token
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits Slack puts on block text, longer text is rejected outright
+const (
+	maxHeaderLength  = 150
+	maxSectionLength = 3000
+)
+
+// Message is the JSON body for both incoming webhooks and chat.postMessage,
+// Channel is only used by the latter
+type Message struct {
+	Channel string  `json:"channel,omitempty"`
+	Text    string  `json:"text"`
+	Blocks  []Block `json:"blocks"`
+}
+
+type Block struct {
+	Type string `json:"type"`
+	Text *Text  `json:"text,omitempty"`
+}
+
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	HttpClient *http.Client
+
+	// Optional, needed to post to a channel ID rather than a webhook URL
+	Token string
+
+	// Where the chat API lives, defaults to https://slack.com/api
+	APIURL string
+
+	// Only incoming-webhook URLs under this are posted to, defaults to
+	// https://hooks.slack.com/, recipients come from callers so without it
+	// a message could be sent anywhere
+	WebhookURL string
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	httpClient *http.Client
+
+	token      string
+	apiURL     string
+	webhookURL *url.URL
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "slack")
+	}
+
+	if opts.HttpClient == nil {
+		opts.HttpClient = &http.Client{}
+	}
+
+	if opts.APIURL == "" {
+		opts.APIURL = "https://slack.com/api"
+	}
+
+	if opts.WebhookURL == "" {
+		opts.WebhookURL = "https://hooks.slack.com/"
+	}
+
+	webhookURL, err := url.Parse(opts.WebhookURL)
+	if err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		return nil, fmt.Errorf("webhook url %q must be an https url", opts.WebhookURL)
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		httpClient: opts.HttpClient,
+
+		token:      opts.Token,
+		apiURL:     strings.TrimSuffix(opts.APIURL, "/"),
+		webhookURL: webhookURL,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Send posts to an incoming-webhook URL, or to a channel through the chat API
+func (c *Client) Send(ctx context.Context, to, subject, body string) error {
+	if to == "" {
+		return errors.New("slack recipient missing")
+	}
+
+	msg := NewMessage(subject, body)
+
+	if strings.HasPrefix(to, "https://") || strings.HasPrefix(to, "http://") {
+		if !c.isWebhook(to) {
+			return fmt.Errorf("%v is not a slack webhook url", to)
+		}
+		return c.postWebhook(ctx, to, msg)
+	}
+
+	if c.token == "" {
+		return errors.New("posting to a channel requires a token")
+	}
+
+	msg.Channel = to
+	return c.postMessage(ctx, msg)
+}
+
+// NewMessage builds Block Kit blocks from a subject and body, the subject
+// as a header and the body as markdown sections, along with the plain
+// text Slack falls back to in notifications
+func NewMessage(subject, body string) *Message {
+	msg := &Message{}
+
+	if subject != "" {
+		msg.Blocks = append(msg.Blocks, Block{
+			Type: "header",
+			Text: &Text{Type: "plain_text", Text: truncate(subject, maxHeaderLength)},
+		})
+	}
+
+	for _, chunk := range split(body, maxSectionLength) {
+		msg.Blocks = append(msg.Blocks, Block{
+			Type: "section",
+			Text: &Text{Type: "mrkdwn", Text: chunk},
+		})
+	}
+
+	switch {
+	case subject != "" && body != "":
+		msg.Text = subject + "\n" + body
+	case subject != "":
+		msg.Text = subject
+	default:
+		msg.Text = body
+	}
+
+	return msg
+}
+
+// Whether the URL is an incoming webhook under the configured one, over
+// https and without credentials that could redirect where it goes
+func (c *Client) isWebhook(to string) bool {
+	u, err := url.Parse(to)
+	if err != nil {
+		return false
+	}
+
+	base := c.webhookURL
+	return u.Scheme == "https" && u.User == nil && strings.EqualFold(u.Host, base.Host) &&
+		strings.HasPrefix(u.Path, strings.TrimSuffix(base.Path, "/")+"/")
+}
+
+// Incoming webhooks answer with a plain "ok" or an error status
+func (c *Client) postWebhook(ctx context.Context, url string, msg *Message) error {
+	// The webhook URL is its own credential, the token never goes with it
+	resp, err := c.post(ctx, url, "", msg)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("slack webhook responded %v: %s", resp.Status, b)
+	}
+
+	return nil
+}
+
+// The chat API answers 200 even on failure, the outcome is in the body
+func (c *Client) postMessage(ctx context.Context, msg *Message) error {
+	resp, err := c.post(ctx, c.apiURL+"/chat.postMessage", c.token, msg)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack api responded %v", resp.Status)
+	}
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+
+	if !result.OK {
+		return fmt.Errorf("slack api error: %v", result.Error)
+	}
+
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, url, token string, msg *Message) (*http.Response, error) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
+
+// Breaks s into chunks of at most limit runes, preferring to break on
+// a newline so paragraphs stay together
+func split(s string, limit int) []string {
+	var chunks []string
+
+	for s != "" {
+		runes := []rune(s)
+		if len(runes) <= limit {
+			chunks = append(chunks, s)
+			break
+		}
+
+		chunk := string(runes[:limit])
+		if i := strings.LastIndex(chunk, "\n"); i > 0 {
+			chunk = chunk[:i]
+		}
+
+		chunks = append(chunks, chunk)
+		s = strings.TrimPrefix(s[len(chunk):], "\n")
+	}
+
+	return chunks
+}
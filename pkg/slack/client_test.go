@@ -0,0 +1,230 @@
+package slack_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/pkg/slack"
+)
+
+var errMock = errors.New("mock error")
+
+// A stand in for Slack, serving both an incoming webhook and the chat API,
+// holding onto the last message each received
+type fakeSlack struct {
+	*httptest.Server
+
+	webhook     *slack.Message
+	webhookAuth string
+	posted      *slack.Message
+	auth        string
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	fake := &fakeSlack{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services/hook", func(w http.ResponseWriter, r *http.Request) {
+		fake.webhookAuth = r.Header.Get("Authorization")
+		fake.webhook = &slack.Message{}
+		if err := json.NewDecoder(r.Body).Decode(fake.webhook); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/services/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no_service"))
+	})
+	mux.HandleFunc("/api/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		fake.auth = r.Header.Get("Authorization")
+		fake.posted = &slack.Message{}
+		if err := json.NewDecoder(r.Body).Decode(fake.posted); err != nil {
+			t.Error(err)
+		}
+
+		if fake.posted.Channel == "C-missing" {
+			w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	})
+
+	fake.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(fake.Close)
+
+	return fake
+}
+
+func TestNewClient(t *testing.T) {
+	fake := newFakeSlack(t)
+
+	client, err := slack.New(&slack.ClientOptions{
+		HttpClient: fake.Client(),
+		Token:      "xoxb-token",
+		APIURL:     fake.URL + "/api/",
+		WebhookURL: fake.URL + "/services/",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("Webhook", func(t *testing.T) {
+		if err := client.Send(context.TODO(), fake.URL+"/services/hook", "Subject", "Body"); err != nil {
+			t.Error(err)
+		}
+
+		if fake.webhook == nil || fake.webhook.Channel != "" || len(fake.webhook.Blocks) != 2 {
+			t.Errorf("unexpected webhook message %+v", fake.webhook)
+		}
+
+		if fake.webhookAuth != "" {
+			t.Errorf("the token shouldn't be sent to a webhook, got %q", fake.webhookAuth)
+		}
+	})
+
+	t.Run("NotAWebhook", func(t *testing.T) {
+		fake.webhook = nil
+
+		for _, to := range []string{
+			"https://attacker.example/services/hook",
+			strings.Replace(fake.URL, "https://", "http://", 1) + "/services/hook",
+			strings.Replace(fake.URL, "https://", "https://user@", 1) + "/services/hook",
+			fake.URL + "/api/chat.postMessage",
+		} {
+			if err := client.Send(context.TODO(), to, "Subject", "Body"); err == nil {
+				t.Errorf("%v should have been refused", to)
+			}
+		}
+
+		if fake.webhook != nil || fake.posted != nil {
+			t.Error("nothing should have been posted")
+		}
+	})
+
+	t.Run("WebhookError", func(t *testing.T) {
+		if err := client.Send(context.TODO(), fake.URL+"/services/gone", "Subject", "Body"); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+
+	t.Run("Channel", func(t *testing.T) {
+		if err := client.Send(context.TODO(), "C123", "Subject", "Body"); err != nil {
+			t.Error(err)
+		}
+
+		if fake.posted == nil || fake.posted.Channel != "C123" {
+			t.Errorf("unexpected posted message %+v", fake.posted)
+		}
+
+		if fake.auth != "Bearer xoxb-token" {
+			t.Errorf("unexpected authorization %q", fake.auth)
+		}
+	})
+
+	t.Run("ChannelError", func(t *testing.T) {
+		err := client.Send(context.TODO(), "C-missing", "Subject", "Body")
+		if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+			t.Errorf("expected channel_not_found, got %v", err)
+		}
+	})
+
+	t.Run("MissingRecipient", func(t *testing.T) {
+		if err := client.Send(context.TODO(), "", "Subject", "Body"); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+}
+
+func TestChannelWithoutToken(t *testing.T) {
+	client := slack.Must(slack.New(&slack.ClientOptions{}))
+
+	if err := client.Send(context.TODO(), "C123", "Subject", "Body"); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestWebhookURL(t *testing.T) {
+	if _, err := slack.New(&slack.ClientOptions{WebhookURL: "http://hooks.example.com/"}); err == nil {
+		t.Error("a plain http webhook url should be an error")
+	}
+
+	client := slack.Must(slack.New(&slack.ClientOptions{}))
+	if err := client.Send(context.TODO(), "https://hooks.slack.com.attacker.example/services/x", "", "Body"); err == nil || !strings.Contains(err.Error(), "not a slack webhook") {
+		t.Errorf("only hooks.slack.com should be allowed by default, got %v", err)
+	}
+}
+
+func TestNewMessage(t *testing.T) {
+	t.Run("Blocks", func(t *testing.T) {
+		msg := slack.NewMessage("Disk full", "*db-1* is at 99%")
+
+		if msg.Text != "Disk full\n*db-1* is at 99%" {
+			t.Errorf("unexpected fallback text %q", msg.Text)
+		}
+
+		if msg.Blocks[0].Type != "header" || msg.Blocks[0].Text.Type != "plain_text" || msg.Blocks[0].Text.Text != "Disk full" {
+			t.Errorf("unexpected header %+v", msg.Blocks[0])
+		}
+
+		if msg.Blocks[1].Type != "section" || msg.Blocks[1].Text.Type != "mrkdwn" {
+			t.Errorf("unexpected section %+v", msg.Blocks[1])
+		}
+	})
+
+	t.Run("NoSubject", func(t *testing.T) {
+		msg := slack.NewMessage("", "Body")
+
+		if len(msg.Blocks) != 1 || msg.Text != "Body" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		msg := slack.NewMessage(strings.Repeat("s", 200), strings.Repeat("line\n", 1000))
+
+		if n := len([]rune(msg.Blocks[0].Text.Text)); n != 150 {
+			t.Errorf("header is %v runes, want 150", n)
+		}
+
+		if len(msg.Blocks) != 3 {
+			t.Errorf("body should be split over 2 sections, got %v blocks", len(msg.Blocks))
+		}
+
+		for _, block := range msg.Blocks[1:] {
+			if len(block.Text.Text) > 3000 || strings.HasPrefix(block.Text.Text, "\n") {
+				t.Errorf("section badly split, %v long", len(block.Text.Text))
+			}
+		}
+	})
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	slack.Must(&slack.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	slack.Must(&slack.Client{}, errMock)
+}
@@ -7,33 +7,79 @@ package sms
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
 )
 
+// A credential that may be rotated while the client is running, read each
+// time it's needed rather than once, secrets.Secret is one
+type Secret interface {
+	Value(context.Context) (string, error)
+}
+
+// Somewhere to keep messages rather than send them, sandbox.Client is one
+type Sandbox interface {
+	SMS(ctx context.Context, from, to, body string, segments int, encoding string) error
+}
+
 type ClientOptions struct {
-	StdLog *log.Logger
+	Logger *slog.Logger
 
 	FromNumber string
+
+	// Optional, a URL on the SMS provider health checks make sure responds
+	ProviderURL string
+
+	// Optional, health checks send it as a bearer token and treat the
+	// provider refusing it as unhealthy too
+	APIToken Secret
+
+	HttpClient *http.Client
+
+	// Optional, when set messages are kept there instead of being sent
+	Sandbox Sandbox
 }
 
 type Client struct {
-	stdLog *log.Logger
+	logger *slog.Logger
 
 	fromNumber string
+
+	providerURL string
+	apiToken    Secret
+	httpClient  *http.Client
+
+	sandbox Sandbox
 }
 
 func New(opts *ClientOptions) (*Client, error) {
 
-	// If the logger was missed, assume a default
-	if opts.StdLog == nil {
-		opts.StdLog = log.New(os.Stdout, "email", 0)
+	// If the logger was missed, assume a default, recipients and content
+	// are masked so they don't end up sat in plain text in the logs
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+			ReplaceAttr: redact.Must(redact.New(&redact.ClientOptions{})).ReplaceAttr,
+		})).With("component", "sms")
+	}
+
+	if opts.HttpClient == nil {
+		opts.HttpClient = http.DefaultClient
 	}
 
 	return &Client{
-		stdLog: opts.StdLog,
+		logger: opts.Logger,
 
 		fromNumber: opts.FromNumber,
+
+		providerURL: opts.ProviderURL,
+		apiToken:    opts.APIToken,
+		httpClient:  opts.HttpClient,
+
+		sandbox: opts.Sandbox,
 	}, nil
 }
 
@@ -46,10 +92,54 @@ func Must(client *Client, err error) *Client {
 	return client
 }
 
+// Send doesn't call the provider yet, so only Check uses the API token
 func (c *Client) Send(ctx context.Context, to, body string) error {
 
+	if c.sandbox != nil {
+		segments, encoding := c.Segments(body)
+		return c.sandbox.SMS(ctx, c.fromNumber, to, body, segments, encoding)
+	}
+
 	// Complete steps to send sms, for now, we can just log
-	c.stdLog.Printf("Sending SMS: To number: %v, from number %v, Body content: %v", to, c.fromNumber, body)
+	c.logger.InfoContext(ctx, "Sending SMS", "to", to, "from", c.fromNumber, "body", body)
+
+	return nil
+}
+
+// Check makes sure the provider answers, anything short of a 5xx counts as
+// reachable since an unauthenticated HEAD is often refused outright, with a
+// token configured it's sent and a refusal counts as unhealthy
+func (c *Client) Check(ctx context.Context) error {
+	if c.providerURL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.providerURL, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.apiToken != nil {
+		token, err := c.apiToken.Value(ctx)
+		if err != nil {
+			return fmt.Errorf("sms api token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms provider unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("sms provider unhealthy: %v", resp.Status)
+	}
+
+	if c.apiToken != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("sms provider refused the api token: %v", resp.Status)
+	}
 
 	return nil
 }
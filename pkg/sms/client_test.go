@@ -3,6 +3,9 @@ package sms_test
 import (
 	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/B1scuit/example-pattern-service/pkg/sms"
@@ -24,6 +27,145 @@ func TestNewClient(t *testing.T) {
 	})
 }
 
+type MockSandbox struct {
+	SMSMock func(context.Context, string, string, string, int, string) error
+}
+
+func (ms *MockSandbox) SMS(ctx context.Context, from, to, body string, segments int, encoding string) error {
+	return ms.SMSMock(ctx, from, to, body, segments, encoding)
+}
+
+func TestSandbox(t *testing.T) {
+	var kept bool
+
+	client := sms.Must(sms.New(&sms.ClientOptions{
+		FromNumber: "0987654321",
+		Sandbox: &MockSandbox{
+			SMSMock: func(ctx context.Context, from, to, body string, segments int, encoding string) error {
+				kept = from == "0987654321" && to == "0123456789" && body == "Hello" && segments == 1 && encoding == sms.EncodingGSM7
+				return errMock
+			},
+		},
+	}))
+
+	if err := client.Send(context.TODO(), "0123456789", "Hello"); !errors.Is(err, errMock) {
+		t.Errorf("the sandbox's error should be returned, got %v", err)
+	}
+
+	if !kept {
+		t.Error("the sms wasn't handed to the sandbox as expected")
+	}
+}
+
+func TestSegments(t *testing.T) {
+	client := sms.Must(sms.New(&sms.ClientOptions{}))
+
+	tests := map[string]struct {
+		body     string
+		segments int
+		encoding string
+	}{
+		"empty":            {"", 0, sms.EncodingGSM7},
+		"single":           {strings.Repeat("a", 160), 1, sms.EncodingGSM7},
+		"split":            {strings.Repeat("a", 161), 2, sms.EncodingGSM7},
+		"three":            {strings.Repeat("a", 307), 3, sms.EncodingGSM7},
+		"extension":        {strings.Repeat("€", 80), 1, sms.EncodingGSM7},
+		"extension split":  {strings.Repeat("€", 81), 2, sms.EncodingGSM7},
+		"unicode":          {strings.Repeat("ł", 70), 1, sms.EncodingUCS2},
+		"unicode split":    {strings.Repeat("ł", 71), 2, sms.EncodingUCS2},
+		"emoji two units":  {strings.Repeat("😀", 35), 1, sms.EncodingUCS2},
+		"emoji turns ucs2": {strings.Repeat("a", 100) + "😀", 2, sms.EncodingUCS2},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			segments, encoding := client.Segments(test.body)
+			if segments != test.segments || encoding != test.encoding {
+				t.Errorf("got %v %v want %v %v", segments, encoding, test.segments, test.encoding)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer healthy.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	tests := map[string]struct {
+		url     string
+		healthy bool
+	}{
+		"not configured": {"", true},
+		"reachable":      {healthy.URL, true},
+		"erroring":       {broken.URL, false},
+	}
+
+	for name, tt := range tests {
+		client := sms.Must(sms.New(&sms.ClientOptions{ProviderURL: tt.url}))
+
+		if err := client.Check(context.TODO()); (err == nil) != tt.healthy {
+			t.Errorf("%v: unexpected result %v", name, err)
+		}
+	}
+}
+
+// A credential the tests can change, as a rotation would
+type MockSecret struct {
+	ValueMock func(context.Context) (string, error)
+}
+
+func (ms *MockSecret) Value(ctx context.Context) (string, error) {
+	return ms.ValueMock(ctx)
+}
+
+func TestCheckAPIToken(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer current" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer provider.Close()
+
+	token := "current"
+	var tokenErr error
+
+	client := sms.Must(sms.New(&sms.ClientOptions{
+		ProviderURL: provider.URL,
+		APIToken: &MockSecret{
+			ValueMock: func(context.Context) (string, error) {
+				return token, tokenErr
+			},
+		},
+	}))
+
+	if err := client.Check(context.TODO()); err != nil {
+		t.Errorf("expected healthy, got %v", err)
+	}
+
+	// Refused once it's a token the provider no longer accepts
+	token = "revoked"
+	if err := client.Check(context.TODO()); err == nil {
+		t.Error("expected a refused token to be unhealthy")
+	}
+
+	tokenErr = errMock
+	if err := client.Check(context.TODO()); !errors.Is(err, errMock) {
+		t.Errorf("expected %v, got %v", errMock, err)
+	}
+
+	// Sending doesn't use the token, so it isn't held up by it
+	if err := client.Send(context.TODO(), "0123456789", ""); err != nil {
+		t.Errorf("expected send to ignore the token, got %v", err)
+	}
+}
+
 func TestMustClean(t *testing.T) {
 	// This deferal function allows for the testing
 	//of panics as it blocks the os.Exit using recover()
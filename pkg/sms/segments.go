@@ -0,0 +1,63 @@
+package sms
+
+import "strings"
+
+// The encodings an SMS body is sent in, GSM-7 unless it has a character
+// the GSM alphabet doesn't, a single emoji turns the whole message UCS-2
+const (
+	EncodingGSM7 = "GSM-7"
+	EncodingUCS2 = "UCS-2"
+)
+
+// The GSM 03.38 alphabet, and the extension characters that take an
+// escape and so two septets each
+const (
+	gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "\f^{}\\[~]|€"
+)
+
+// Segments reports how many messages the body is split into and the
+// encoding that decides it. A message that fits in one has 160 GSM-7
+// characters or 70 UCS-2 ones, split messages lose some of each part to
+// the header that joins them back together
+func (c *Client) Segments(body string) (int, string) {
+	if body == "" {
+		return 0, EncodingGSM7
+	}
+
+	septets, gsm := 0, true
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			septets++
+		case strings.ContainsRune(gsm7Extension, r):
+			septets += 2
+		default:
+			gsm = false
+		}
+	}
+
+	if gsm {
+		return parts(septets, 160, 153), EncodingGSM7
+	}
+
+	// UCS-2 counts UTF-16 code units, anything outside the BMP takes two
+	units := 0
+	for _, r := range body {
+		units++
+		if r > 0xFFFF {
+			units++
+		}
+	}
+
+	return parts(units, 70, 67), EncodingUCS2
+}
+
+func parts(length, single, multi int) int {
+	if length <= single {
+		return 1
+	}
+
+	return (length + multi - 1) / multi
+}
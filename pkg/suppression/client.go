@@ -0,0 +1,329 @@
+// suppression
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, holding the addresses nothing should be sent to (bounces,
+// complaints, people who asked to be left alone). Like directory it's kept in memory with
+// an optional JSON file, which is read again whenever another process has changed it so
+// the CLI and the HTTP service can share one list. Changes are made holding a lock file
+// next to it, so two processes changing the list at once don't lose either change
+package suppression
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suppression is an address on the list, the JSON is the file format
+type Suppression struct {
+	Address string    `json:"address"`
+	Reason  string    `json:"reason,omitempty"`
+	Added   time.Time `json:"added"`
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Optional, where the list is persisted
+	Path string
+
+	// Allows the passing of time to be controlled in tests
+	Now func() time.Time
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*Suppression
+
+	// The file as it was last read or written, so changes made by another
+	// process are noticed. The size as well since a quick rewrite can land
+	// within the modtime resolution of coarse filesystems
+	modTime time.Time
+	size    int64
+}
+
+// How long a lock file can be held before it's assumed the process that
+// took it died, far longer than a read and write of the list takes
+const staleLock = 10 * time.Second
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "suppression")
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	c := &Client{
+		logger: opts.Logger,
+
+		path: opts.Path,
+		now:  opts.Now,
+
+		entries: map[string]*Suppression{},
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Suppressed reports whether the address is on the list
+func (c *Client) Suppressed(ctx context.Context, address string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		return false, err
+	}
+
+	_, ok := c.entries[normalise(address)]
+	return ok, nil
+}
+
+// Add puts the address on the list, adding one already there updates the reason
+func (c *Client) Add(ctx context.Context, address, reason string) error {
+	key := normalise(address)
+	if key == "" {
+		return errors.New("address missing")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unlock, err := c.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := c.load(); err != nil {
+		return err
+	}
+
+	previous, existed := c.entries[key]
+	c.entries[key] = &Suppression{Address: key, Reason: reason, Added: c.now()}
+
+	// Put the old value back if it couldn't be saved, so memory and disk agree
+	if err := c.save(); err != nil {
+		if existed {
+			c.entries[key] = previous
+		} else {
+			delete(c.entries, key)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Remove takes the address off the list, reporting whether it was on it
+func (c *Client) Remove(ctx context.Context, address string) (bool, error) {
+	key := normalise(address)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unlock, err := c.lock(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if err := c.load(); err != nil {
+		return false, err
+	}
+
+	previous, ok := c.entries[key]
+	if !ok {
+		return false, nil
+	}
+
+	delete(c.entries, key)
+
+	if err := c.save(); err != nil {
+		c.entries[key] = previous
+		return false, err
+	}
+
+	return true, nil
+}
+
+// List returns a copy of every entry, sorted by address
+func (c *Client) List(ctx context.Context) ([]*Suppression, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Suppression, 0, len(c.entries))
+	for _, entry := range c.entries {
+		copied := *entry
+		entries = append(entries, &copied)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Address < entries[j].Address
+	})
+
+	return entries, nil
+}
+
+// Addresses are compared case insensitively, Jo@Example.com bouncing
+// means jo@example.com will too
+func normalise(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// Reads the file if it has changed since it was last read, callers must
+// hold the lock
+func (c *Client) load() error {
+	if c.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(c.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// First run, the file is created on the first write
+		return nil
+	case err != nil:
+		return err
+	case info.ModTime().Equal(c.modTime) && info.Size() == c.size:
+		return nil
+	}
+
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+
+	var list []*Suppression
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("suppression list %v: %w", c.path, err)
+	}
+
+	entries := make(map[string]*Suppression, len(list))
+	for _, entry := range list {
+		entry.Address = normalise(entry.Address)
+		entries[entry.Address] = entry
+	}
+
+	c.entries = entries
+	c.modTime, c.size = info.ModTime(), info.Size()
+
+	return nil
+}
+
+// Writes through a temp file and a rename so a crash never leaves half a
+// list on disk, callers must hold the lock
+func (c *Client) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	list := make([]*Suppression, 0, len(c.entries))
+	for _, entry := range c.entries {
+		list = append(list, entry)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".suppression-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+
+	// Our own write isn't a change that needs reading back
+	if info, err := os.Stat(c.path); err == nil {
+		c.modTime, c.size = info.ModTime(), info.Size()
+	}
+
+	return nil
+}
+
+// Takes the lock file so the load and save of a change aren't interleaved
+// with another process's, callers must hold the lock. Reading doesn't need
+// it, the rename in save means the file is only ever seen whole
+func (c *Client) lock(ctx context.Context) (func(), error) {
+	if c.path == "" {
+		return func() {}, nil
+	}
+
+	path := c.path + ".lock"
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		// Left behind by a process that died holding it
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			c.logger.WarnContext(ctx, "Removing a stale suppression list lock", "path", path)
+			os.Remove(path)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("suppression list locked: %w", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package suppression_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/suppression"
+)
+
+var errMock = errors.New("mock error")
+
+func TestNewClient(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	client, err := suppression.New(&suppression.ClientOptions{
+		Now: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		if err := client.Add(context.TODO(), " Jo@Example.com ", "bounced"); err != nil {
+			t.Error(err)
+		}
+
+		suppressed, err := client.Suppressed(context.TODO(), "jo@example.com")
+		if err != nil || !suppressed {
+			t.Errorf("suppressed = %v, %v, want true", suppressed, err)
+		}
+	})
+
+	t.Run("AddMissing", func(t *testing.T) {
+		if err := client.Add(context.TODO(), "  ", ""); err == nil {
+			t.Error("an empty address should be refused")
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		if err := client.Add(context.TODO(), "al@example.com", ""); err != nil {
+			t.Error(err)
+		}
+
+		entries, err := client.List(context.TODO())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(entries) != 2 || entries[0].Address != "al@example.com" || entries[1].Address != "jo@example.com" {
+			t.Errorf("unexpected entries %+v", entries)
+			return
+		}
+
+		if entries[1].Reason != "bounced" || !entries[1].Added.Equal(now) {
+			t.Errorf("unexpected entry %+v", entries[1])
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		removed, err := client.Remove(context.TODO(), "JO@example.com")
+		if err != nil || !removed {
+			t.Errorf("removed = %v, %v, want true", removed, err)
+		}
+
+		removed, err = client.Remove(context.TODO(), "jo@example.com")
+		if err != nil || removed {
+			t.Errorf("removed = %v, %v, want false", removed, err)
+		}
+
+		suppressed, _ := client.Suppressed(context.TODO(), "jo@example.com")
+		if suppressed {
+			t.Error("jo@example.com should no longer be suppressed")
+		}
+	})
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppressions.json")
+
+	first := suppression.Must(suppression.New(&suppression.ClientOptions{Path: path}))
+	if err := first.Add(context.TODO(), "jo@example.com", "complained"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("Reloaded", func(t *testing.T) {
+		second := suppression.Must(suppression.New(&suppression.ClientOptions{Path: path}))
+
+		suppressed, err := second.Suppressed(context.TODO(), "jo@example.com")
+		if err != nil || !suppressed {
+			t.Errorf("suppressed = %v, %v, want true", suppressed, err)
+		}
+	})
+
+	t.Run("ChangedElsewhere", func(t *testing.T) {
+		second := suppression.Must(suppression.New(&suppression.ClientOptions{Path: path}))
+
+		// Make sure the rewrite gets a different modtime on coarse filesystems
+		time.Sleep(10 * time.Millisecond)
+
+		if _, err := second.Remove(context.TODO(), "jo@example.com"); err != nil {
+			t.Error(err)
+			return
+		}
+
+		suppressed, err := first.Suppressed(context.TODO(), "jo@example.com")
+		if err != nil || suppressed {
+			t.Errorf("suppressed = %v, %v, want false once another client removed it", suppressed, err)
+		}
+	})
+
+	t.Run("SameModTime", func(t *testing.T) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A rewrite that lands within the modtime resolution is still seen
+		os.WriteFile(path, []byte(`[{"address":"jo@example.com"}]`), 0o600)
+		os.Chtimes(path, info.ModTime(), info.ModTime())
+
+		suppressed, err := first.Suppressed(context.TODO(), "jo@example.com")
+		if err != nil || !suppressed {
+			t.Errorf("suppressed = %v, %v, want true once the file was rewritten", suppressed, err)
+		}
+	})
+
+	t.Run("Locked", func(t *testing.T) {
+		os.WriteFile(path+".lock", nil, 0o600)
+		defer os.Remove(path + ".lock")
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := first.Add(ctx, "sam@example.com", ""); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected to wait for the lock, got %v", err)
+		}
+
+		// Unless whoever took it is long gone
+		stale := time.Now().Add(-time.Minute)
+		os.Chtimes(path+".lock", stale, stale)
+
+		if err := first.Add(context.TODO(), "sam@example.com", ""); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, err := suppression.New(&suppression.ClientOptions{Path: path}); err == nil {
+			t.Error("a corrupt file should fail")
+		}
+	})
+}
+
+func TestConcurrentProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppressions.json")
+
+	// Two clients stand in for the CLI and the service, each with its own
+	// in memory list so only the lock file keeps them apart
+	clients := []*suppression.Client{
+		suppression.Must(suppression.New(&suppression.ClientOptions{Path: path})),
+		suppression.Must(suppression.New(&suppression.ClientOptions{Path: path})),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := clients[i%2].Add(context.TODO(), fmt.Sprintf("user%v@example.com", i), ""); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	list, err := suppression.Must(suppression.New(&suppression.ClientOptions{Path: path})).List(context.TODO())
+	if err != nil || len(list) != 20 {
+		t.Errorf("%v addresses on the list, want 20, %v", len(list), err)
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	suppression.Must(&suppression.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	suppression.Must(&suppression.Client{}, errMock)
+}
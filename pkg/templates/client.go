@@ -0,0 +1,266 @@
+// templates
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, holding named subject/body templates and rendering them with
+// the data a caller passes. Templates are parsed up front so a broken one stops startup
+// rather than a send
+//
+// A template can have a variant per locale, keyed "<name>.<locale>" (welcome.fr-FR), and
+// the plain "<name>" is used when no variant matches
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Template is the source of a named template, both parts are text/template
+type Template struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Optional, every <name>.json and <name>.<locale>.json file in the
+	// directory is loaded as a Template
+	Dir string
+
+	// Optional, keyed the same way as the files without the .json,
+	// added to (and overriding) anything loaded from Dir
+	Templates map[string]*Template
+
+	// Tried after the requested locale and before the plain template
+	DefaultLocale string
+}
+
+type parsed struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	defaultLocale string
+
+	// Template name then locale, "" being the template without a locale
+	templates map[string]map[string]*parsed
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "templates")
+	}
+
+	sources := map[string]*Template{}
+
+	if opts.Dir != "" {
+		loaded, err := loadDir(opts.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for key, tmpl := range loaded {
+			sources[key] = tmpl
+		}
+	}
+
+	for key, tmpl := range opts.Templates {
+		sources[key] = tmpl
+	}
+
+	templates := map[string]map[string]*parsed{}
+	for key, source := range sources {
+		name, locale, _ := strings.Cut(key, ".")
+
+		p, err := parse(key, source)
+		if err != nil {
+			return nil, err
+		}
+
+		if templates[name] == nil {
+			templates[name] = map[string]*parsed{}
+		}
+		templates[name][locale] = p
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		defaultLocale: opts.DefaultLocale,
+
+		templates: templates,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Render executes the named template in the closest locale available,
+// returning the subject and body
+func (c *Client) Render(ctx context.Context, name, locale string, data map[string]any) (string, string, error) {
+	variants, ok := c.templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("template %q not found", name)
+	}
+
+	var tmpl *parsed
+	var matched string
+	for _, candidate := range c.fallbacks(locale) {
+		if tmpl, ok = variants[candidate]; ok {
+			matched = candidate
+			break
+		}
+	}
+
+	if tmpl == nil {
+		return "", "", fmt.Errorf("template %q has no variant for locale %q", name, locale)
+	}
+
+	// Formatting follows the locale asked for, even when the words had to
+	// fall back, a fr-CA reader still expects their own dates and numbers
+	if locale == "" {
+		locale = matched
+	}
+	if locale == "" {
+		locale = c.defaultLocale
+	}
+	funcs := Funcs(locale)
+
+	subject, err := execute(tmpl.subject, funcs, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	body, err := execute(tmpl.body, funcs, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return subject, body, nil
+}
+
+// The locales tried, in order, for a requested locale, fr-CA becomes
+// fr-CA, fr, then the default locale and its language, then no locale
+func (c *Client) fallbacks(locale string) []string {
+	var chain []string
+	seen := map[string]bool{}
+
+	add := func(l string) {
+		if l != "" && !seen[l] {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+
+	for _, l := range []string{locale, c.defaultLocale} {
+		add(l)
+		if language, _, ok := strings.Cut(l, "-"); ok {
+			add(language)
+		}
+	}
+
+	return append(chain, "")
+}
+
+// Names lists every template, sorted, without their locales
+func (c *Client) Names() []string {
+	names := make([]string, 0, len(c.templates))
+	for name := range c.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Locales lists the locale variants a template has, "" being the plain one
+func (c *Client) Locales(name string) []string {
+	locales := make([]string, 0, len(c.templates[name]))
+	for locale := range c.templates[name] {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+func parse(name string, source *Template) (*parsed, error) {
+	if source == nil {
+		return nil, fmt.Errorf("template %q is empty", name)
+	}
+
+	// The helpers are parsed with placeholder formatting, each render
+	// swaps in the formatting for the locale being rendered
+	funcs := Funcs("")
+
+	// A missing key is almost always a caller forgetting some data, failing
+	// is better than sending someone "Hello <no value>"
+	subject, err := template.New(name + ".subject").Option("missingkey=error").Funcs(funcs).Parse(source.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("template %q subject: %w", name, err)
+	}
+
+	body, err := template.New(name + ".body").Option("missingkey=error").Funcs(funcs).Parse(source.Body)
+	if err != nil {
+		return nil, fmt.Errorf("template %q body: %w", name, err)
+	}
+
+	return &parsed{subject: subject, body: body}, nil
+}
+
+// Renders from a clone so the locale's helpers can be bound without
+// racing other renders of the same template
+func execute(tmpl *template.Template, funcs template.FuncMap, data map[string]any) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := clone.Funcs(funcs).Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+func loadDir(dir string) (map[string]*Template, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]*Template{}
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var tmpl Template
+		if err := json.Unmarshal(b, &tmpl); err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+
+		templates[strings.TrimSuffix(filepath.Base(path), ".json")] = &tmpl
+	}
+
+	return templates, nil
+}
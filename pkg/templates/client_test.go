@@ -0,0 +1,174 @@
+package templates_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/pkg/templates"
+)
+
+var errMock = errors.New("mock error")
+
+func TestNewClient(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "welcome.json"), []byte(`{"subject": "Welcome {{.name}}", "body": "Hi {{.name}}, thanks for joining"}`), 0o600)
+	os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte(`not a template`), 0o600)
+
+	client, err := templates.New(&templates.ClientOptions{
+		Dir: dir,
+		Templates: map[string]*templates.Template{
+			"reset": {Subject: "Reset your password", Body: "Use {{.code}}"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Run("Render", func(t *testing.T) {
+		subject, body, err := client.Render(context.TODO(), "welcome", "", map[string]any{"name": "Sam"})
+		if err != nil {
+			t.Error(err)
+		}
+
+		if subject != "Welcome Sam" || body != "Hi Sam, thanks for joining" {
+			t.Errorf("unexpected render %q %q", subject, body)
+		}
+	})
+
+	t.Run("MissingData", func(t *testing.T) {
+		if _, _, err := client.Render(context.TODO(), "reset", "", nil); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, _, err := client.Render(context.TODO(), "missing", "", nil); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		names := client.Names()
+		if len(names) != 2 || names[0] != "reset" || names[1] != "welcome" {
+			t.Errorf("unexpected names %v", names)
+		}
+	})
+}
+
+func TestLocales(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "invoice.fr.json"), []byte(`{"subject": "Facture", "body": "Total {{formatNumber .total 2}} au {{formatDate .due}}"}`), 0o600)
+
+	client := templates.Must(templates.New(&templates.ClientOptions{
+		Dir:           dir,
+		DefaultLocale: "en-GB",
+		Templates: map[string]*templates.Template{
+			"invoice":       {Subject: "Invoice", Body: "Total {{formatNumber .total 2}} due {{formatDate .due}}"},
+			"invoice.en-US": {Subject: "Invoice (US)", Body: "Total {{formatNumber .total 2}} due {{formatDate .due}}"},
+			"invoice.de-DE": {Subject: "Rechnung", Body: "Summe {{formatNumber .total 2}} bis {{formatDate .due}}"},
+			"notice.de":     {Subject: "Hinweis", Body: "Hallo"},
+		},
+	}))
+
+	data := map[string]any{"total": 1234.5, "due": "2022-06-01T09:00:00Z"}
+
+	tests := []struct {
+		name        string
+		template    string
+		locale      string
+		wantSubject string
+		wantBody    string
+		wantError   bool
+	}{
+		{"exact", "invoice", "de-DE", "Rechnung", "Summe 1.234,50 bis 01.06.2022", false},
+		{"language fallback", "invoice", "fr-CA", "Facture", "Total 1\u00a0234,50 au 01/06/2022", false},
+		{"default template", "invoice", "ja-JP", "Invoice", "Total 1,234.50 due 2022/06/01", false},
+		{"no locale", "invoice", "", "Invoice", "Total 1,234.50 due 01/06/2022", false},
+		{"us", "invoice", "en-US", "Invoice (US)", "Total 1,234.50 due 06/01/2022", false},
+		{"no variant at all", "notice", "fr-FR", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, err := client.Render(context.TODO(), tt.template, tt.locale, data)
+			if (err != nil) != tt.wantError {
+				t.Errorf("error = %v, want error %v", err, tt.wantError)
+			}
+
+			if subject != tt.wantSubject || body != tt.wantBody {
+				t.Errorf("got %q %q, want %q %q", subject, body, tt.wantSubject, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Locales", func(t *testing.T) {
+		locales := client.Locales("invoice")
+		if len(locales) != 4 || locales[0] != "" || locales[1] != "de-DE" {
+			t.Errorf("unexpected locales %v", locales)
+		}
+	})
+}
+
+func TestFormatErrors(t *testing.T) {
+	client := templates.Must(templates.New(&templates.ClientOptions{
+		Templates: map[string]*templates.Template{
+			"date":   {Body: "{{formatDate .v}}"},
+			"number": {Body: "{{formatNumber .v 0}}"},
+		},
+	}))
+
+	for _, name := range []string{"date", "number"} {
+		if _, _, err := client.Render(context.TODO(), name, "", map[string]any{"v": []int{1}}); err == nil {
+			t.Errorf("%v: error should have been returned", name)
+		}
+	}
+}
+
+func TestNewInvalidTemplate(t *testing.T) {
+	_, err := templates.New(&templates.ClientOptions{
+		Templates: map[string]*templates.Template{
+			"broken": {Body: "{{.name"},
+		},
+	})
+
+	if err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestNewInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{`), 0o600)
+
+	if _, err := templates.New(&templates.ClientOptions{Dir: dir}); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	templates.Must(&templates.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	templates.Must(&templates.Client{}, errMock)
+}
@@ -0,0 +1,149 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// How a locale writes dates and numbers, kept to the handful of locales
+// we send in, anything else falls back by language then to en-GB. French
+// groups thousands with a non-breaking space so numbers don't wrap
+type format struct {
+	date     string
+	dateTime string
+	decimal  string
+	group    string
+}
+
+var formats = map[string]format{
+	"en-GB": {date: "02/01/2006", dateTime: "02/01/2006 15:04", decimal: ".", group: ","},
+	"en-US": {date: "01/02/2006", dateTime: "01/02/2006 3:04 PM", decimal: ".", group: ","},
+	"fr-FR": {date: "02/01/2006", dateTime: "02/01/2006 15:04", decimal: ",", group: "\u00a0"},
+	"de-DE": {date: "02.01.2006", dateTime: "02.01.2006 15:04", decimal: ",", group: "."},
+	"es-ES": {date: "02/01/2006", dateTime: "02/01/2006 15:04", decimal: ",", group: "."},
+	"it-IT": {date: "02/01/2006", dateTime: "02/01/2006 15:04", decimal: ",", group: "."},
+	"nl-NL": {date: "02-01-2006", dateTime: "02-01-2006 15:04", decimal: ",", group: "."},
+	"ja-JP": {date: "2006/01/02", dateTime: "2006/01/02 15:04", decimal: ".", group: ","},
+}
+
+// The locale a bare language code means
+var languages = map[string]string{
+	"en": "en-GB",
+	"fr": "fr-FR",
+	"de": "de-DE",
+	"es": "es-ES",
+	"it": "it-IT",
+	"nl": "nl-NL",
+	"ja": "ja-JP",
+}
+
+func formatFor(locale string) format {
+	if f, ok := formats[locale]; ok {
+		return f
+	}
+
+	language, _, _ := strings.Cut(locale, "-")
+	if l, ok := languages[language]; ok {
+		return formats[l]
+	}
+
+	return formats["en-GB"]
+}
+
+// Funcs returns the helpers available inside templates, formatting for locale
+//
+//	{{formatDate .due}}         02/01/2006 in en-GB, 01/02/2006 in en-US
+//	{{formatDateTime .due}}     with the time of day
+//	{{formatNumber .total 2}}   1,234.50 in en-GB, 1.234,50 in de-DE
+//
+// Dates can be a time.Time or an RFC3339 string, as they arrive from JSON
+func Funcs(locale string) template.FuncMap {
+	f := formatFor(locale)
+
+	return template.FuncMap{
+		"formatDate": func(v any) (string, error) {
+			t, err := toTime(v)
+			if err != nil {
+				return "", err
+			}
+			return t.Format(f.date), nil
+		},
+		"formatDateTime": func(v any) (string, error) {
+			t, err := toTime(v)
+			if err != nil {
+				return "", err
+			}
+			return t.Format(f.dateTime), nil
+		},
+		"formatNumber": func(v any, decimals int) (string, error) {
+			n, err := toFloat(v)
+			if err != nil {
+				return "", err
+			}
+			return formatNumber(n, decimals, f.decimal, f.group), nil
+		},
+	}
+}
+
+func formatNumber(n float64, decimals int, decimal, group string) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	s := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(s, ".")
+
+	// Group the whole part in threes from the right
+	var sb strings.Builder
+	if n < 0 && strings.Trim(s, "0.") != "" {
+		sb.WriteString("-")
+	}
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteString(group)
+		}
+		sb.WriteRune(r)
+	}
+
+	if fraction != "" {
+		sb.WriteString(decimal)
+		sb.WriteString(fraction)
+	}
+
+	return sb.String()
+}
+
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return time.Parse(time.RFC3339, t)
+	}
+
+	return time.Time{}, fmt.Errorf("can't format %T as a date", v)
+}
+
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		return strconv.ParseFloat(n, 64)
+	}
+
+	return 0, fmt.Errorf("can't format %T as a number", v)
+}
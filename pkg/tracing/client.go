@@ -0,0 +1,361 @@
+// tracing
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, recording spans in the shape OpenTelemetry uses and handing
+// them to an exporter in batches. Trace context travels between services in the W3C
+// traceparent header, which is all we need to join up with anyone else's traces
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/redact"
+)
+
+// The header trace context is read from and written to
+const HeaderTraceparent = "traceparent"
+
+// Anywhere finished spans can be sent
+type Exporter interface {
+	Export(context.Context, []*SpanData) error
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	// Reported as service.name on every span
+	ServiceName string
+
+	Exporter Exporter
+
+	// Masks addresses in span errors before they leave the service, which
+	// quote whatever the provider was given. Defaults to redacting
+	Redact *redact.Client
+
+	// How often Run hands finished spans to the exporter, defaults to 5 seconds
+	FlushInterval time.Duration
+
+	// Spans held waiting for a flush, past this new spans are dropped so a
+	// dead collector can't take the service down with it. Defaults to 2048
+	MaxQueue int
+
+	// Allows the passing of time to be controlled in tests
+	Now func() time.Time
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	serviceName string
+	exporter    Exporter
+	redact      *redact.Client
+
+	flushInterval time.Duration
+	maxQueue      int
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending []*SpanData
+	dropped int
+	stop    chan struct{}
+	stopped bool
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "tracing")
+	}
+
+	if opts.Exporter == nil {
+		return nil, errors.New("exporter missing")
+	}
+
+	if opts.ServiceName == "" {
+		opts.ServiceName = "example-pattern-service"
+	}
+
+	if opts.Redact == nil {
+		opts.Redact = redact.Must(redact.New(&redact.ClientOptions{}))
+	}
+
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = 2048
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		serviceName: opts.ServiceName,
+		exporter:    opts.Exporter,
+		redact:      opts.Redact,
+
+		flushInterval: opts.FlushInterval,
+		maxQueue:      opts.MaxQueue,
+
+		now: opts.Now,
+
+		stop: make(chan struct{}),
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Identifies a span and the trace it belongs to, carried in the context
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+type contextKey struct{}
+
+func fromContext(ctx context.Context) (spanContext, bool) {
+	sc, ok := ctx.Value(contextKey{}).(spanContext)
+	return sc, ok
+}
+
+// Extract returns ctx carrying the parent described by a traceparent header,
+// a missing or malformed header is ignored and a new trace started instead
+func (c *Client) Extract(ctx context.Context, traceparent string) context.Context {
+	sc, ok := parseTraceparent(traceparent)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// Traceparent formats the span in ctx for passing on to another service,
+// empty if there isn't one
+func Traceparent(ctx context.Context) string {
+	sc, ok := fromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// Only version 00 is defined, 00-<trace id>-<parent id>-<flags>
+func parseTraceparent(header string) (spanContext, bool) {
+	var sc spanContext
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+
+	// All zero IDs are explicitly invalid
+	if sc.traceID == [16]byte{} || sc.spanID == [8]byte{} {
+		return sc, false
+	}
+
+	sc.sampled = flags[0]&1 == 1
+
+	return sc, true
+}
+
+// Start begins a span as a child of the one in ctx, or a new trace when
+// there isn't one. Spans under an unsampled parent are passed along but
+// never recorded, respecting the caller's sampling decision
+func (c *Client) Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent, hasParent := fromContext(ctx)
+
+	sc := spanContext{sampled: true}
+	if hasParent {
+		sc.traceID = parent.traceID
+		sc.sampled = parent.sampled
+	} else {
+		rand.Read(sc.traceID[:])
+	}
+	rand.Read(sc.spanID[:])
+
+	span := &Span{
+		client:  c,
+		sampled: sc.sampled,
+		data: &SpanData{
+			Name:       name,
+			TraceID:    hex.EncodeToString(sc.traceID[:]),
+			SpanID:     hex.EncodeToString(sc.spanID[:]),
+			Start:      c.now(),
+			Attributes: map[string]string{},
+		},
+	}
+
+	if hasParent {
+		span.data.ParentSpanID = hex.EncodeToString(parent.spanID[:])
+	}
+
+	return context.WithValue(ctx, contextKey{}, sc), span
+}
+
+func (c *Client) record(data *SpanData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) >= c.maxQueue {
+		c.dropped++
+		return
+	}
+
+	c.pending = append(c.pending, data)
+}
+
+// Flush hands every finished span to the exporter
+func (c *Client) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	spans, dropped := c.pending, c.dropped
+	c.pending, c.dropped = nil, 0
+	c.mu.Unlock()
+
+	if dropped > 0 {
+		c.logger.WarnContext(ctx, "Dropped spans, the export queue was full", "dropped", dropped)
+	}
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	for _, span := range spans {
+		span.ServiceName = c.serviceName
+	}
+
+	return c.exporter.Export(ctx, spans)
+}
+
+// Run blocks, flushing spans every FlushInterval until ctx is cancelled or
+// Drain is called
+func (c *Client) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.stop:
+			return nil
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				c.logger.ErrorContext(ctx, "Exporting spans failed", "error", err)
+			}
+		}
+	}
+}
+
+// Drain stops Run and flushes whatever is left, meant to come last on
+// shutdown so the spans of work drained before it are kept
+func (c *Client) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.stopped {
+		c.stopped = true
+		close(c.stop)
+	}
+	c.mu.Unlock()
+
+	if err := c.Flush(ctx); err != nil {
+		return fmt.Errorf("spans abandoned: %w", err)
+	}
+
+	return nil
+}
+
+// SpanData is a finished span as it's handed to an exporter
+type SpanData struct {
+	ServiceName string
+
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+
+	Start time.Time
+	End   time.Time
+
+	Attributes map[string]string
+
+	// Set when the span ended with an error
+	Error string
+}
+
+// Span is one in progress, set attributes on it and End it once the work is done
+type Span struct {
+	client  *Client
+	sampled bool
+
+	mu    sync.Mutex
+	data  *SpanData
+	ended bool
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes[key] = value
+}
+
+func (s *Span) End(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ending twice is a mistake, but not one worth a duplicate span over
+	if s.ended {
+		return
+	}
+	s.ended = true
+
+	s.data.End = s.client.now()
+	if err != nil {
+		s.data.Error = s.client.redact.Text(err.Error())
+	}
+
+	if s.sampled {
+		s.client.record(s.data)
+	}
+}
@@ -0,0 +1,232 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/B1scuit/example-pattern-service/pkg/tracing"
+)
+
+var errMock = errors.New("mock error")
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newClient(t *testing.T, exporter tracing.Exporter) *tracing.Client {
+	client, err := tracing.New(&tracing.ClientOptions{
+		ServiceName: "test",
+		Exporter:    exporter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestNewClient(t *testing.T) {
+	var exporter tracing.MemoryExporter
+	client := newClient(t, &exporter)
+
+	ctx, parent := client.Start(context.TODO(), "parent")
+	_, child := client.Start(ctx, "child")
+	child.SetAttribute("channel", "sms")
+	child.End(errMock)
+	parent.End(nil)
+
+	// Nothing is exported until flushed
+	if len(exporter.Spans()) != 0 {
+		t.Error("spans exported before flush")
+	}
+
+	if err := client.Flush(context.TODO()); err != nil {
+		t.Error(err)
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %v spans, want 2", len(spans))
+	}
+
+	childData, parentData := spans[0], spans[1]
+
+	if childData.TraceID != parentData.TraceID || childData.ParentSpanID != parentData.SpanID {
+		t.Errorf("child %+v isn't a child of %+v", childData, parentData)
+	}
+
+	if parentData.ParentSpanID != "" {
+		t.Error("parent should start a new trace")
+	}
+
+	if childData.Error != errMock.Error() || childData.Attributes["channel"] != "sms" {
+		t.Errorf("unexpected child %+v", childData)
+	}
+
+	if childData.ServiceName != "test" {
+		t.Errorf("service name %q", childData.ServiceName)
+	}
+}
+
+func TestErrorRedacted(t *testing.T) {
+	var exporter tracing.MemoryExporter
+	client := newClient(t, &exporter)
+
+	_, span := client.Start(context.TODO(), "send")
+	span.End(fmt.Errorf("rejected example@example.com: %w", errMock))
+
+	client.Flush(context.TODO())
+
+	if spans := exporter.Spans(); len(spans) != 1 || strings.Contains(spans[0].Error, "example@example.com") {
+		t.Errorf("address left in %+v", spans)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	var exporter tracing.MemoryExporter
+	client := newClient(t, &exporter)
+
+	tests := map[string]struct {
+		header     string
+		wantParent string
+		wantSpan   bool
+	}{
+		"valid":      {traceparent, "00f067aa0ba902b7", true},
+		"missing":    {"", "", true},
+		"malformed":  {"00-nothex-00f067aa0ba902b7-01", "", true},
+		"zero trace": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", true},
+		"unsampled":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "", false},
+	}
+
+	for name, tt := range tests {
+		exporter.Reset()
+
+		ctx := client.Extract(context.TODO(), tt.header)
+		ctx, span := client.Start(ctx, name)
+		span.End(nil)
+		client.Flush(context.TODO())
+
+		// The trace carries on whether or not it's recorded
+		if got := tracing.Traceparent(ctx); tt.wantParent != "" && !strings.HasPrefix(got, "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+			t.Errorf("%v: traceparent %q should continue the trace", name, got)
+		}
+
+		spans := exporter.Spans()
+		if !tt.wantSpan {
+			if len(spans) != 0 {
+				t.Errorf("%v: unsampled span recorded", name)
+			}
+			continue
+		}
+
+		if len(spans) != 1 || spans[0].ParentSpanID != tt.wantParent {
+			t.Errorf("%v: unexpected spans %+v", name, spans)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	var exporter tracing.MemoryExporter
+	client := newClient(t, &exporter)
+
+	_, span := client.Start(context.TODO(), "span")
+	span.End(nil)
+
+	if err := client.Drain(context.TODO()); err != nil {
+		t.Error(err)
+	}
+
+	if len(exporter.Spans()) != 1 {
+		t.Error("drain should have flushed the span")
+	}
+
+	// Run returns straight away once drained
+	if err := client.Run(context.TODO()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]any
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %v %v", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer collector.Close()
+
+	client := newClient(t, &tracing.OTLPExporter{Endpoint: collector.URL + "/v1/traces"})
+
+	ctx := client.Extract(context.TODO(), traceparent)
+	_, span := client.Start(ctx, "core.Task1")
+	span.End(errMock)
+
+	if err := client.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(body)
+	for _, want := range []string{
+		`"key":"service.name","value":{"stringValue":"test"}`,
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"parentSpanId":"00f067aa0ba902b7"`,
+		`"name":"core.Task1"`,
+		`"status":{"code":2,"message":"mock error"}`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("missing %v from %v", want, string(b))
+		}
+	}
+}
+
+func TestOTLPExporterFailure(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	client := newClient(t, &tracing.OTLPExporter{Endpoint: collector.URL})
+
+	_, span := client.Start(context.TODO(), "span")
+	span.End(nil)
+
+	if err := client.Drain(context.TODO()); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestNewMissingExporter(t *testing.T) {
+	if _, err := tracing.New(&tracing.ClientOptions{}); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	tracing.Must(&tracing.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	tracing.Must(&tracing.Client{}, errMock)
+}
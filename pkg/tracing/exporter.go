@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MemoryExporter keeps every span it's given, for tests and debugging
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (me *MemoryExporter) Export(ctx context.Context, spans []*SpanData) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.spans = append(me.spans, spans...)
+	return nil
+}
+
+// Spans returns everything exported so far, oldest first
+func (me *MemoryExporter) Spans() []*SpanData {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	return append([]*SpanData(nil), me.spans...)
+}
+
+func (me *MemoryExporter) Reset() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.spans = nil
+}
+
+// The collector's default OTLP/HTTP traces endpoint
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// OTLPExporter POSTs spans to an OpenTelemetry collector using the JSON
+// encoding of OTLP/HTTP, which needs nothing beyond the standard library
+type OTLPExporter struct {
+	// Defaults to DefaultOTLPEndpoint
+	Endpoint string
+
+	// Optional, sent with every request, for collectors that want auth
+	Headers map[string]string
+
+	HttpClient *http.Client
+}
+
+func (oe *OTLPExporter) Export(ctx context.Context, spans []*SpanData) error {
+	endpoint := oe.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+
+	httpClient := oe.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	b, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range oe.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded %v", resp.Status)
+	}
+
+	return nil
+}
+
+// Just the parts of the OTLP trace request we fill in, see
+// opentelemetry-proto's trace_service.proto for the full shape
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// Values from the OTLP enums
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// Groups spans by service so each gets its own resource
+func otlpRequest(spans []*SpanData) *otlpExportRequest {
+	byService := map[string][]otlpSpan{}
+	var services []string
+
+	for _, span := range spans {
+		if _, ok := byService[span.ServiceName]; !ok {
+			services = append(services, span.ServiceName)
+		}
+
+		status := otlpStatus{Code: otlpStatusOK}
+		if span.Error != "" {
+			status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+
+		byService[span.ServiceName] = append(byService[span.ServiceName], otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            status,
+		})
+	}
+
+	request := &otlpExportRequest{}
+	for _, service := range services {
+		request.ResourceSpans = append(request.ResourceSpans, otlpResourceSpans{
+			Resource: otlpResource{
+				Attributes: otlpAttributes(map[string]string{"service.name": service}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/B1scuit/example-pattern-service/pkg/tracing"},
+				Spans: byService[service],
+			}},
+		})
+	}
+
+	return request
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpAttribute, len(keys))
+	for i, key := range keys {
+		out[i] = otlpAttribute{Key: key, Value: otlpValue{StringValue: attributes[key]}}
+	}
+
+	return out
+}
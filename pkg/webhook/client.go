@@ -0,0 +1,476 @@
+// webhook
+//
+// This follows the exact same pattern as core and can be treated as an isolated "mini-core"
+// of it's own responsiblilty, delivering notifications to HTTP endpoints our consumers own.
+// Each payload is signed so the receiver can check it came from us and hasn't been replayed
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The headers every delivery carries, the signature covers the timestamp
+// and the raw body joined with a "." so neither can be changed on their own
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload is the JSON body POSTed to the endpoint
+type Payload struct {
+	ID        string `json:"id"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Endpoint overrides the client defaults for a single URL
+type Endpoint struct {
+	Secret  string
+	Timeout time.Duration
+}
+
+// LoadEndpoints reads Endpoints from JSON keyed by URL, the timeout is a
+// duration (5s, 1m30s) and either can be left out to use the default
+//
+//	{"https://example.com/hooks": {"secret": "...", "timeout": "30s"}}
+func LoadEndpoints(r io.Reader) (map[string]Endpoint, error) {
+	var raw map[string]struct {
+		Secret  string `json:"secret"`
+		Timeout string `json:"timeout"`
+	}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	endpoints := make(map[string]Endpoint, len(raw))
+	for url, e := range raw {
+		endpoint := Endpoint{Secret: e.Secret}
+
+		if e.Timeout != "" {
+			timeout, err := time.ParseDuration(e.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("endpoint %q: %w", url, err)
+			}
+			if timeout <= 0 {
+				return nil, fmt.Errorf("endpoint %q: timeout must be positive", url)
+			}
+			endpoint.Timeout = timeout
+		}
+
+		endpoints[url] = endpoint
+	}
+
+	return endpoints, nil
+}
+
+type ClientOptions struct {
+	Logger *slog.Logger
+
+	HttpClient *http.Client
+
+	// Used to sign payloads for any endpoint without a secret of its own
+	Secret string
+
+	// How long a single attempt may take, defaults to 10 seconds
+	Timeout time.Duration
+
+	// Attempts after the first, with RetryBackoff doubling between each
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// Optional, keyed by URL
+	Endpoints map[string]Endpoint
+
+	// Optional, when set only URLs in Endpoints or on one of these hosts
+	// are sent to, anything else a caller asks for is refused
+	AllowedHosts []string
+
+	// Loopback, private and link-local addresses are refused by default so
+	// a caller can't aim a signed request at something inside our network,
+	// or at a cloud metadata endpoint. Only for local development and tests
+	AllowPrivateNetworks bool
+
+	// Optional, called before each retry so they can be counted
+	OnRetry func(url string)
+
+	// Allows the passing of time to be controlled in tests
+	Now func() time.Time
+}
+
+type Client struct {
+	logger *slog.Logger
+
+	httpClient *http.Client
+
+	secret  string
+	timeout time.Duration
+
+	maxRetries   int
+	retryBackoff time.Duration
+
+	endpoints    map[string]Endpoint
+	allowedHosts map[string]bool
+	allowPrivate bool
+
+	onRetry func(url string)
+
+	now func() time.Time
+}
+
+func New(opts *ClientOptions) (*Client, error) {
+
+	// If the logger was missed, assume a default
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil)).With("component", "webhook")
+	}
+
+	// Unsigned payloads can't be trusted by the receiver, so don't send any
+	if opts.Secret == "" {
+		return nil, errors.New("signing secret missing")
+	}
+
+	if opts.HttpClient == nil {
+		opts.HttpClient = &http.Client{}
+	}
+
+	// The URL is checked before sending, but a hostname can resolve to
+	// anything, so the address actually dialled is checked as well
+	if !opts.AllowPrivateNetworks {
+		opts.HttpClient = guarded(opts.HttpClient)
+	}
+
+	allowedHosts := map[string]bool{}
+	for _, host := range opts.AllowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowedHosts[host] = true
+		}
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+
+	if opts.OnRetry == nil {
+		opts.OnRetry = func(string) {}
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return &Client{
+		logger: opts.Logger,
+
+		httpClient: opts.HttpClient,
+
+		secret:  opts.Secret,
+		timeout: opts.Timeout,
+
+		maxRetries:   opts.MaxRetries,
+		retryBackoff: opts.RetryBackoff,
+
+		endpoints:    opts.Endpoints,
+		allowedHosts: allowedHosts,
+		allowPrivate: opts.AllowPrivateNetworks,
+
+		onRetry: opts.OnRetry,
+
+		now: opts.Now,
+	}, nil
+}
+
+// Forces a clean completion of New() for initalisation
+func Must(client *Client, err error) *Client {
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
+
+// Send POSTs a signed payload to the URL, retrying failures that might
+// succeed next time, every attempt carries the same ID so the receiver
+// can tell a retry from a new notification
+func (c *Client) Send(ctx context.Context, url, subject, body string) error {
+	if url == "" {
+		return errors.New("endpoint url missing")
+	}
+
+	if err := c.check(url); err != nil {
+		return err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	secret, timeout := c.secret, c.timeout
+	if endpoint, ok := c.endpoints[url]; ok {
+		if endpoint.Secret != "" {
+			secret = endpoint.Secret
+		}
+		if endpoint.Timeout > 0 {
+			timeout = endpoint.Timeout
+		}
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		// The timestamp is taken per attempt so a slow retry isn't
+		// rejected by the receiver as a replay
+		err = c.post(ctx, url, secret, timeout, &Payload{
+			ID:        id,
+			Subject:   subject,
+			Body:      body,
+			Timestamp: c.now().Unix(),
+		})
+
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) || attempt >= c.maxRetries {
+			return err
+		}
+
+		c.logger.WarnContext(ctx, "Webhook failed, retrying", "id", id, "url", url, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		c.onRetry(url)
+	}
+}
+
+func (c *Client) post(ctx context.Context, url, secret string, timeout time.Duration, payload *Payload) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	timestamp := strconv.FormatInt(payload.Timestamp, 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, payload.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, b))
+
+	resp, err := c.httpClient.Do(req)
+
+	// Resolving to somewhere we won't send will resolve there next time too
+	var refused *refusedError
+	if errors.As(err, &refused) {
+		return &permanentError{err}
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("endpoint responded %v", resp.Status)
+	}
+
+	// Anything else is the receiver telling us the request is wrong,
+	// sending it again won't change their mind
+	return &permanentError{fmt.Errorf("endpoint responded %v", resp.Status)}
+}
+
+// Whether the URL is one we'll send to at all, a URL that isn't will never
+// become one so it's a permanent error rather than something to retry
+func (c *Client) check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &permanentError{fmt.Errorf("unsupported url scheme %q", u.Scheme)}
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return &permanentError{errors.New("endpoint url has no host")}
+	}
+
+	if _, ok := c.endpoints[rawURL]; len(c.allowedHosts) > 0 && !ok && !c.allowedHosts[host] {
+		return &permanentError{fmt.Errorf("host %v is not allowed", host)}
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil && !c.allowPrivate && private(addr) {
+		return &permanentError{&refusedError{addr}}
+	}
+
+	return nil
+}
+
+// Returns a copy of the client that refuses to connect to a private
+// address. Requests go direct rather than through a proxy so the address
+// checked is the endpoint's, a transport that isn't an *http.Transport
+// can't be changed so only the URL check applies to it
+func guarded(client *http.Client) *http.Client {
+	transport, ok := client.Transport.(*http.Transport)
+	if client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return client
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+
+			if private(addr) {
+				return &refusedError{addr}
+			}
+
+			return nil
+		},
+	}
+
+	transport = transport.Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	copied := *client
+	copied.Transport = transport
+
+	return &copied
+}
+
+// Ranges that aren't on the public internet, IsPrivate covers 10/8,
+// 172.16/12, 192.168/16 and fc00::/7
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+func private(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+
+	for _, prefix := range reserved {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type refusedError struct {
+	addr netip.Addr
+}
+
+func (e *refusedError) Error() string {
+	return fmt.Sprintf("refusing to send to private address %v", e.addr)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Sign returns the signature header value for a body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify is for receivers, it checks the signature matches and that the
+// timestamp is within tolerance of now so a captured request can't be replayed
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration, now time.Time) error {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	age := now.Sub(time.Unix(sent, 0))
+	if age > tolerance || age < -tolerance {
+		return errors.New("timestamp outside tolerance")
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,321 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/B1scuit/example-pattern-service/pkg/webhook"
+)
+
+var errMock = errors.New("mock error")
+
+const secret = "shh"
+
+// A receiver that checks every request the way a consumer would, responding
+// with whatever status the test asks for on each attempt
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := atomic.AddInt32(&attempts, 1)
+
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(secret, r.Header.Get(webhook.HeaderSignature), r.Header.Get(webhook.HeaderTimestamp), body, time.Minute, time.Now()); err != nil {
+			t.Error(err)
+		}
+
+		var payload webhook.Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+
+		if payload.ID == "" || payload.ID != r.Header.Get(webhook.HeaderID) {
+			t.Errorf("id %q doesn't match header %q", payload.ID, r.Header.Get(webhook.HeaderID))
+		}
+
+		status := http.StatusOK
+		if int(attempt) <= len(statuses) {
+			status = statuses[attempt-1]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &attempts
+}
+
+func newClient(t *testing.T, opts *webhook.ClientOptions) *webhook.Client {
+	opts.Secret = secret
+	opts.RetryBackoff = time.Millisecond
+
+	// The receivers are all on localhost
+	opts.AllowPrivateNetworks = true
+
+	client, err := webhook.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestNewClient(t *testing.T) {
+	server, attempts := receiver(t)
+	client := newClient(t, &webhook.ClientOptions{})
+
+	t.Run("Send", func(t *testing.T) {
+		if err := client.Send(context.TODO(), server.URL, "Subject", "Body"); err != nil {
+			t.Error(err)
+		}
+
+		if *attempts != 1 {
+			t.Errorf("attempts = %v, want 1", *attempts)
+		}
+	})
+
+	t.Run("MissingURL", func(t *testing.T) {
+		if err := client.Send(context.TODO(), "", "Subject", "Body"); err == nil {
+			t.Error("error should have been returned")
+		}
+	})
+}
+
+func TestNewMissingSecret(t *testing.T) {
+	if _, err := webhook.New(&webhook.ClientOptions{}); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantError    bool
+		wantAttempts int32
+	}{
+		{"server error then success", []int{500, 502}, false, 3},
+		{"rate limited then success", []int{429}, false, 2},
+		{"retries exhausted", []int{500, 500, 500, 500}, true, 3},
+		{"client error isn't retried", []int{400}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, attempts := receiver(t, tt.statuses...)
+
+			var retries int32
+			client := newClient(t, &webhook.ClientOptions{
+				MaxRetries: 2,
+				OnRetry: func(url string) {
+					retries++
+				},
+			})
+
+			err := client.Send(context.TODO(), server.URL, "Subject", "Body")
+			if (err != nil) != tt.wantError {
+				t.Errorf("error = %v, want error %v", err, tt.wantError)
+			}
+
+			if *attempts != tt.wantAttempts {
+				t.Errorf("attempts = %v, want %v", *attempts, tt.wantAttempts)
+			}
+
+			if retries != tt.wantAttempts-1 {
+				t.Errorf("retries = %v, want %v", retries, tt.wantAttempts-1)
+			}
+		})
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	client := newClient(t, &webhook.ClientOptions{
+		Endpoints: map[string]webhook.Endpoint{
+			slow.URL: {Timeout: 10 * time.Millisecond},
+		},
+	})
+
+	if err := client.Send(context.TODO(), slow.URL, "Subject", "Body"); err == nil {
+		t.Error("error should have been returned")
+	}
+}
+
+func TestEndpointSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("other", r.Header.Get(webhook.HeaderSignature), r.Header.Get(webhook.HeaderTimestamp), body, time.Minute, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	client := newClient(t, &webhook.ClientOptions{
+		Endpoints: map[string]webhook.Endpoint{
+			server.URL: {Secret: "other"},
+		},
+	})
+
+	if err := client.Send(context.TODO(), server.URL, "Subject", "Body"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadEndpoints(t *testing.T) {
+	endpoints, err := webhook.LoadEndpoints(strings.NewReader(`{
+		"https://example.com/slow": {"timeout": "30s"},
+		"https://example.com/other": {"secret": "other"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]webhook.Endpoint{
+		"https://example.com/slow":  {Timeout: 30 * time.Second},
+		"https://example.com/other": {Secret: "other"},
+	}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("endpoints %+v, want %+v", endpoints, want)
+	}
+
+	for _, invalid := range []string{`[]`, `{"https://example.com": {"timeout": "soon"}}`, `{"https://example.com": {"timeout": "-1s"}}`} {
+		if _, err := webhook.LoadEndpoints(strings.NewReader(invalid)); err == nil {
+			t.Errorf("%v should be an error", invalid)
+		}
+	}
+}
+
+func TestRefusedURLs(t *testing.T) {
+	server, attempts := receiver(t)
+
+	client := webhook.Must(webhook.New(&webhook.ClientOptions{
+		Secret:       secret,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}))
+
+	for name, url := range map[string]string{
+		"loopback":  server.URL,
+		"localhost": strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+		"metadata":  "http://169.254.169.254/latest/meta-data/",
+		"private":   "https://10.0.0.1/hook",
+		"mapped":    "http://[::ffff:192.168.0.1]/hook",
+		"scheme":    "ftp://example.com/hook",
+		"no host":   "https:///hook",
+		"invalid":   "http://exa mple.com/%zz",
+	} {
+		var retries int32
+		client := client
+		if name == "localhost" {
+			// Only caught once dialled, and still not retried
+			client = webhook.Must(webhook.New(&webhook.ClientOptions{
+				Secret:       secret,
+				MaxRetries:   2,
+				RetryBackoff: time.Millisecond,
+				OnRetry:      func(string) { retries++ },
+			}))
+		}
+
+		if err := client.Send(context.TODO(), url, "Subject", "Body"); err == nil {
+			t.Errorf("%v should have been refused", name)
+		}
+
+		if retries != 0 {
+			t.Errorf("%v shouldn't be retried, retried %v times", name, retries)
+		}
+	}
+
+	if *attempts != 0 {
+		t.Errorf("nothing should have reached the receiver, got %v", *attempts)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	server, attempts := receiver(t)
+
+	client := newClient(t, &webhook.ClientOptions{
+		AllowedHosts: []string{"hooks.example.com"},
+		Endpoints: map[string]webhook.Endpoint{
+			server.URL: {},
+		},
+	})
+
+	if err := client.Send(context.TODO(), server.URL, "Subject", "Body"); err != nil {
+		t.Errorf("a configured endpoint should be allowed, %v", err)
+	}
+
+	if err := client.Send(context.TODO(), server.URL+"/other", "Subject", "Body"); err == nil {
+		t.Error("a url that isn't an endpoint or on an allowed host should be refused")
+	}
+
+	if *attempts != 1 {
+		t.Errorf("attempts = %v, want 1", *attempts)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1654041600, 0)
+	body := []byte(`{"id":"1"}`)
+	signature := webhook.Sign(secret, "1654041600", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		now       time.Time
+		wantError bool
+	}{
+		{"valid", secret, "1654041600", body, now, false},
+		{"wrong secret", "guess", "1654041600", body, now, true},
+		{"changed body", secret, "1654041600", []byte(`{"id":"2"}`), now, true},
+		{"changed timestamp", secret, "1654041601", body, now, true},
+		{"replayed", secret, "1654041600", body, now.Add(time.Hour), true},
+		{"invalid timestamp", secret, "yesterday", body, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhook.Verify(tt.secret, signature, tt.timestamp, tt.body, 5*time.Minute, tt.now)
+			if (err != nil) != tt.wantError {
+				t.Errorf("error = %v, want error %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestMustClean(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Error(r)
+		}
+	}()
+
+	webhook.Must(&webhook.Client{}, nil)
+}
+
+func TestMustPanic(t *testing.T) {
+	// This deferal function allows for the testing
+	//of panics as it blocks the os.Exit using recover()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic should have thrown")
+		}
+	}()
+
+	webhook.Must(&webhook.Client{}, errMock)
+}